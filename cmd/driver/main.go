@@ -1,15 +1,28 @@
 package main
 
 import (
+	"context"
+	"log"
+	"os"
 	"os/user"
+	"path/filepath"
 	"strconv"
+	"syscall"
+	// the plugin image has no time zone database for server_tz
+	_ "time/tzdata"
 
 	pkgLogger "github.com/t1d333/docker-volume-ftp-driver/pkg/logger"
 
 	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/admin"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/audit"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/filecache"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/hostlimit"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/metrics"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/mountmngr"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/statemngr"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/tracing"
 	pkgVolume "github.com/t1d333/docker-volume-ftp-driver/internal/volume"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/volume/repository"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/volume/service"
@@ -20,7 +33,35 @@ const (
 )
 
 func main() {
-	logger := pkgLogger.NewLogger()
+	logConf, err := pkgLogger.ConfigFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("failed to read logger configuration: %s", err.Error())
+	}
+
+	logger, logLevel, err := pkgLogger.NewLogger(logConf)
+	if err != nil {
+		log.Fatalf("failed to create logger: %s", err.Error())
+	}
+
+	pkgLogger.ToggleDebugOnSignal(logLevel, logger, syscall.SIGUSR1)
+
+	traceConf, err := tracing.ConfigFromEnv(os.Getenv, filepath.Join(statemngr.StateDir(mountpoint), "traces.json"))
+	if err != nil {
+		logger.Fatalf("failed to read tracing configuration: %s", err.Error())
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), traceConf)
+	if err != nil {
+		logger.Fatalf("failed to set up tracing: %s", err.Error())
+		return
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Errorf("failed to flush traces: %s", err.Error())
+		}
+	}()
+
 	rep := repository.CreateInMemoryRepository(logger)
 
 	stateManager, err := statemngr.NewStateManager(mountpoint, logger, rep)
@@ -28,14 +69,87 @@ func main() {
 		logger.Fatalf("failed to create state manager: %s", err.Error())
 		return
 	}
-	ftpManager := ftpmngr.NewFTPManager(logger)
-	mountManager := mountmngr.NewMountManager(logger)
-	serv, err := service.CreateFTPService(mountpoint, ftpManager, mountManager, stateManager, rep, logger)
+
+	auditOpts, err := audit.OptionsFromEnv(os.Getenv, filepath.Join(statemngr.StateDir(mountpoint), "audit.log"))
+	if err != nil {
+		logger.Fatalf("failed to read audit log configuration: %s", err.Error())
+		return
+	}
+
+	auditLog := audit.NewNopLog()
+	if auditOpts != nil {
+		if auditLog, err = audit.NewFileLog(auditOpts); err != nil {
+			logger.Fatalf("failed to open audit log: %s", err.Error())
+			return
+		}
+	}
+	defer auditLog.Close()
+
+	ftpOpts, err := ftpmngr.OptionsFromEnv(os.Getenv)
+	if err != nil {
+		logger.Fatalf("failed to read ftp configuration: %s", err.Error())
+		return
+	}
+
+	mountOpts, err := mountmngr.OptionsFromEnv(os.Getenv)
+	if err != nil {
+		logger.Fatalf("failed to read mount configuration: %s", err.Error())
+		return
+	}
+	mountOpts.DialTimeout = ftpOpts.DialTimeout
+	mountOpts.SpoolDir = filepath.Join(statemngr.StateDir(mountpoint), "spool")
+
+	limitOpts, err := hostlimit.OptionsFromEnv(os.Getenv)
+	if err != nil {
+		logger.Fatalf("failed to read host limit configuration: %s", err.Error())
+		return
+	}
+	limiter := hostlimit.New(limitOpts)
+	ftpOpts.Limiter = limiter
+	mountOpts.Limiter = limiter
+
+	cacheOpts, err := filecache.OptionsFromEnv(os.Getenv, filepath.Join(statemngr.StateDir(mountpoint), "cache"))
+	if err != nil {
+		logger.Fatalf("failed to read cache configuration: %s", err.Error())
+		return
+	}
+	cache, err := filecache.New(cacheOpts)
+	if err != nil {
+		logger.Fatalf("failed to open file cache: %s", err.Error())
+		return
+	}
+	mountOpts.Cache = cache
+
+	ftpManager := ftpmngr.NewFTPManager(ftpOpts, logger)
+	mountManager := mountmngr.NewMountManager(mountOpts, logger)
+	serv, err := service.CreateFTPService(mountpoint, ftpManager, mountManager, stateManager, rep, auditLog, limiter, cache, logger)
 	if err != nil {
 		logger.Fatalf("failed to create service: %s", err.Error())
 		return
 	}
 
+	adminServer := admin.NewServer(os.Getenv("ADMIN_ADDR"), os.Getenv("ADMIN_TOKEN"), logger)
+	adminServer.Handle("/metrics", metrics.Handler())
+	adminServer.Handle("/health", admin.HealthHandler(serv.Health))
+	adminServer.Handle("/ready", admin.ReadyHandler(serv.Health))
+	adminServer.Handle("/loglevel", logLevel)
+	adminServer.Handle("/volumes/refresh", admin.RefreshHandler(serv.Refresh))
+	if cache.Enabled() {
+		adminServer.Handle("/cache/purge", admin.PurgeHandler(func() (int, int64) {
+			stats := cache.Purge()
+			return stats.Entries, stats.Size
+		}))
+	}
+	if auditOpts != nil {
+		adminServer.Handle("/audit/verify", admin.AuditHandler(func() (int, error) { return audit.Verify(auditOpts.Path) }))
+	}
+
+	go func() {
+		if err := adminServer.Serve(); err != nil {
+			logger.Errorf("admin endpoints stopped: %s", err.Error())
+		}
+	}()
+
 	driver := pkgVolume.InitializeNewFTPDriver(serv, logger)
 	handler := volume.NewHandler(driver)
 	u, _ := user.Lookup("root")
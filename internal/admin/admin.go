@@ -0,0 +1,140 @@
+// Package admin serves the operational http endpoints of the driver, such as
+// metrics, on an address separate from the plugin socket.
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pkgLogger "github.com/t1d333/docker-volume-ftp-driver/pkg/logger"
+)
+
+const (
+	// DefaultAddr places the admin socket next to the plugin socket, docker
+	// exposes this directory on the host.
+	DefaultAddr = "unix:///run/docker/plugins/ftp-driver-admin.sock"
+	// Disabled is the address which turns the admin endpoints off.
+	Disabled = "off"
+
+	unixPrefix        = "unix://"
+	bearerPrefix      = "Bearer "
+	readHeaderTimeout = 10 * time.Second
+)
+
+// Server serves the admin endpoints. Requests which change the driver, any
+// method but GET and HEAD, need the token when one is set. Without a token
+// they are only accepted on a unix socket or from the loopback interface.
+type Server struct {
+	addr   string
+	token  string
+	mux    *http.ServeMux
+	logger pkgLogger.Logger
+}
+
+func NewServer(addr, token string, logger pkgLogger.Logger) *Server {
+	if addr == "" {
+		addr = DefaultAddr
+	}
+
+	return &Server{addr: addr, token: token, mux: http.NewServeMux(), logger: logger}
+}
+
+// Handle registers the handler for the given pattern.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, s.authorize(handler))
+}
+
+// authorize rejects the requests changing the driver which are not
+// authorized.
+func (s *Server) authorize(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if s.token != "" {
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, bearerPrefix) ||
+				subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, bearerPrefix)), []byte(s.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		} else if !strings.HasPrefix(s.addr, unixPrefix) && !isLoopback(r.RemoteAddr) {
+			http.Error(w, "forbidden without admin token", http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Serve listens on the address of the server and serves requests until the
+// listener fails. It returns immediately if the server is disabled.
+func (s *Server) Serve() error {
+	if s.addr == Disabled {
+		return nil
+	}
+
+	listener, err := Listen(s.addr)
+	if err != nil {
+		return fmt.Errorf("failed admin.Listen in admin.Server.Serve: %w", err)
+	}
+
+	s.logger.Infof("serve admin endpoints on %s", s.addr)
+
+	server := &http.Server{Handler: s.mux, ReadHeaderTimeout: readHeaderTimeout}
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("unable to serve admin endpoints in admin.Server.Serve: %w", err)
+	}
+
+	return nil
+}
+
+// Listen listens on a unix socket for addresses of the form unix:///path and
+// on a tcp port otherwise.
+func Listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, unixPrefix) {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, unixPrefix)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create socket directory in admin.Listen: %w", err)
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to remove stale socket in admin.Listen: %w", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// only root may talk to the driver
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("unable to restrict socket in admin.Listen: %w", err)
+	}
+
+	return listener, nil
+}
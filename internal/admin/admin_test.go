@@ -0,0 +1,124 @@
+package admin
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	t.Run("unix socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sub", "admin.sock")
+
+		listener, err := Listen("unix://" + path)
+		require.Nil(t, err)
+		defer listener.Close()
+
+		assert.Equal(t, "unix", listener.Addr().Network())
+		assert.Equal(t, path, listener.Addr().String())
+
+		info, err := os.Stat(path)
+		require.Nil(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("stale unix socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "admin.sock")
+
+		stale, err := net.Listen("unix", path)
+		require.Nil(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+
+		listener, err := Listen("unix://" + path)
+		require.Nil(t, err)
+		listener.Close()
+	})
+
+	t.Run("tcp port", func(t *testing.T) {
+		listener, err := Listen("127.0.0.1:0")
+		require.Nil(t, err)
+		defer listener.Close()
+
+		assert.Equal(t, "tcp", listener.Addr().Network())
+	})
+}
+
+func TestHandle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+
+	server := NewServer("unix://"+path, "", nil)
+	server.Handle("/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "pong")
+	}))
+
+	listener, err := Listen(server.addr)
+	require.Nil(t, err)
+
+	go func() { _ = http.Serve(listener, server.mux) }()
+	defer listener.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+
+	resp, err := client.Get("http://admin/ping")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "pong", string(body))
+}
+
+func TestAuthorize(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	request := func(method, remoteAddr, auth string) *http.Request {
+		r := httptest.NewRequest(method, "/loglevel", nil)
+		r.RemoteAddr = remoteAddr
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		addr     string
+		token    string
+		request  *http.Request
+		expected int
+	}{
+		{name: "read from anywhere", addr: ":9273", request: request("GET", "192.0.2.1:1234", ""), expected: http.StatusNoContent},
+		{name: "change from localhost", addr: ":9273", request: request("PUT", "127.0.0.1:1234", ""), expected: http.StatusNoContent},
+		{name: "change from the network", addr: ":9273", request: request("PUT", "192.0.2.1:1234", ""), expected: http.StatusForbidden},
+		{name: "change on the unix socket", addr: DefaultAddr, request: request("POST", "@", ""), expected: http.StatusNoContent},
+		{name: "change with token", addr: ":9273", token: "secret", request: request("PUT", "192.0.2.1:1234", "Bearer secret"), expected: http.StatusNoContent},
+		{name: "change with wrong token", addr: ":9273", token: "secret", request: request("PUT", "127.0.0.1:1234", "Bearer other"), expected: http.StatusUnauthorized},
+		{name: "change without token", addr: DefaultAddr, token: "secret", request: request("POST", "@", "secret"), expected: http.StatusUnauthorized},
+		{name: "read with token set", addr: ":9273", token: "secret", request: request("GET", "192.0.2.1:1234", ""), expected: http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := NewServer(test.addr, test.token, nil)
+			server.Handle("/loglevel", handler)
+
+			recorder := httptest.NewRecorder()
+			server.mux.ServeHTTP(recorder, test.request)
+			assert.Equal(t, test.expected, recorder.Code)
+		})
+	}
+}
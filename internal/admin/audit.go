@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/audit"
+)
+
+type auditReport struct {
+	Valid  bool   `json:"valid"`
+	Events int    `json:"events"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AuditHandler verifies the audit log with verify. It responds with 409 if
+// the hash chain is broken, the error is reported with its credentials
+// redacted.
+func AuditHandler(verify func() (int, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count, err := verify()
+
+		report := auditReport{Valid: err == nil, Events: count}
+		status := http.StatusOK
+		if err != nil {
+			report.Error = audit.RedactCredentials(err.Error())
+			status = http.StatusConflict
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
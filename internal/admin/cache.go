@@ -0,0 +1,28 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type purgeReport struct {
+	Entries int   `json:"entries"`
+	Size    int64 `json:"size"`
+}
+
+// PurgeHandler empties the file cache with purge, which returns the number
+// and the size of the removed files. It only accepts POST.
+func PurgeHandler(purge func() (int, int64)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		entries, size := purge()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(purgeReport{Entries: entries, Size: size})
+	})
+}
@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurgeHandler(t *testing.T) {
+	purged := 0
+	purge := func() (int, int64) {
+		purged++
+		return 3, 1024
+	}
+
+	t.Run("purged", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		PurgeHandler(purge).ServeHTTP(recorder, httptest.NewRequest("POST", "/cache/purge", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"entries":3,"size":1024}`, recorder.Body.String())
+		assert.Equal(t, 1, purged)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		PurgeHandler(purge).ServeHTTP(recorder, httptest.NewRequest("GET", "/cache/purge", nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+		assert.Equal(t, 1, purged)
+	})
+}
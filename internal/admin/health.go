@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+// HealthHandler reports the health of the plugin and its mounted volumes. It
+// responds with 503 if any check failed.
+func HealthHandler(check func(ctx context.Context) *models.HealthReport) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := check(r.Context())
+		writeReport(w, report, report.Healthy())
+	})
+}
+
+// ReadyHandler reports whether the plugin can serve requests. Unlike
+// HealthHandler it ignores failing volume mounts.
+func ReadyHandler(check func(ctx context.Context) *models.HealthReport) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := check(r.Context())
+		writeReport(w, report, report.Ready())
+	})
+}
+
+func writeReport(w http.ResponseWriter, report *models.HealthReport, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+func TestHealthHandler(t *testing.T) {
+	tests := map[string]struct {
+		report       *models.HealthReport
+		healthStatus int
+		readyStatus  int
+	}{
+		"healthy": {
+			report: &models.HealthReport{
+				Status:  models.HealthOK,
+				Checks:  []models.HealthCheck{models.NewHealthCheck("state", nil)},
+				Volumes: []models.HealthCheck{models.NewHealthCheck("test", nil)},
+			},
+			healthStatus: http.StatusOK,
+			readyStatus:  http.StatusOK,
+		},
+		"degraded volume": {
+			report: &models.HealthReport{
+				Status:  models.HealthDegraded,
+				Checks:  []models.HealthCheck{models.NewHealthCheck("state", nil)},
+				Volumes: []models.HealthCheck{models.NewHealthCheck("test", errors.New("mountpoint is not mounted"))},
+			},
+			healthStatus: http.StatusServiceUnavailable,
+			readyStatus:  http.StatusOK,
+		},
+		"degraded plugin": {
+			report: &models.HealthReport{
+				Status:  models.HealthDegraded,
+				Checks:  []models.HealthCheck{models.NewHealthCheck("fuse_device", errors.New("no such file"))},
+				Volumes: []models.HealthCheck{},
+			},
+			healthStatus: http.StatusServiceUnavailable,
+			readyStatus:  http.StatusServiceUnavailable,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			check := func(context.Context) *models.HealthReport { return test.report }
+
+			recorder := httptest.NewRecorder()
+			HealthHandler(check).ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+			assert.Equal(t, test.healthStatus, recorder.Code)
+
+			got := &models.HealthReport{}
+			require.Nil(t, json.NewDecoder(recorder.Body).Decode(got))
+			assert.Equal(t, test.report, got)
+
+			recorder = httptest.NewRecorder()
+			ReadyHandler(check).ServeHTTP(recorder, httptest.NewRequest("GET", "/ready", nil))
+			assert.Equal(t, test.readyStatus, recorder.Code)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/audit"
+)
+
+type volumeReport struct {
+	Volume string `json:"volume"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RefreshHandler syncs the mirrored volume named by the name query parameter
+// with refresh. It only accepts POST and responds with 500 if the sync
+// failed, the error is reported with its credentials redacted.
+func RefreshHandler(refresh func(ctx context.Context, name string) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "missing volume name", http.StatusBadRequest)
+			return
+		}
+
+		report := volumeReport{Volume: name}
+		status := http.StatusOK
+		if err := refresh(r.Context(), name); err != nil {
+			report.Error = audit.RedactCredentials(err.Error())
+			status = http.StatusInternalServerError
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,87 @@
+// Package audit records the lifecycle of the volumes in an append-only log.
+//
+// Every event is a JSON line holding the hash of the previous event, so
+// removing or changing an event breaks the chain which Verify detects. The
+// chain continues across rotated files.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Actions of the volume lifecycle.
+const (
+	ActionCreate  = "create"
+	ActionMount   = "mount"
+	ActionUnmount = "unmount"
+	ActionRemove  = "remove"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+type Event struct {
+	Seq         uint64    `json:"seq"`
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	Volume      string    `json:"volume"`
+	ContainerID string    `json:"container_id,omitempty"`
+	Endpoint    string    `json:"endpoint,omitempty"`
+	Outcome     string    `json:"outcome"`
+	Error       string    `json:"error,omitempty"`
+	PrevHash    string    `json:"prev_hash"`
+	Hash        string    `json:"hash"`
+}
+
+// Log records audit events.
+type Log interface {
+	Record(event *Event) error
+	Close() error
+}
+
+// NewEvent returns an event for action on volume with the outcome of err.
+func NewEvent(action, volume string, err error) *Event {
+	event := &Event{Action: action, Volume: volume, Outcome: OutcomeSuccess}
+	if err != nil {
+		event.Outcome = OutcomeFailure
+		event.Error = err.Error()
+	}
+
+	return event
+}
+
+// hash computes the hash of event which covers every field but Hash.
+func hash(event *Event) (string, error) {
+	unhashed := *event
+	unhashed.Hash = ""
+
+	data, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", fmt.Errorf("unable to serialize event in audit.hash: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type nopLog struct{}
+
+// NewNopLog returns a log which drops every event.
+func NewNopLog() Log {
+	return nopLog{}
+}
+
+func (nopLog) Record(event *Event) error {
+	return nil
+}
+
+func (nopLog) Close() error {
+	return nil
+}
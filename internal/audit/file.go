@@ -0,0 +1,300 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxSize  = 10 << 20
+	DefaultMaxFiles = 5
+)
+
+const redacted = "********"
+
+type Options struct {
+	Path string
+	// MaxSize is the size in bytes after which the file is rotated.
+	MaxSize int64
+	// MaxFiles is the number of rotated files kept next to Path.
+	MaxFiles int
+}
+
+type fileLog struct {
+	opts *Options
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	seq      uint64
+	lastHash string
+}
+
+// NewFileLog opens the log at opts.Path and continues its chain. Rotated files
+// are named Path.1 (the most recent) to Path.MaxFiles.
+func NewFileLog(opts *Options) (Log, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = DefaultMaxFiles
+	}
+
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create audit log directory in audit.NewFileLog: %w", err)
+	}
+
+	l := &fileLog{opts: opts}
+
+	last, err := lastEvent(append([]string{opts.Path}, rotatedPaths(opts.Path, 1)...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed audit.lastEvent in audit.NewFileLog: %w", err)
+	}
+
+	if last != nil {
+		l.seq = last.Seq
+		l.lastHash = last.Hash
+	}
+
+	if err := l.open(); err != nil {
+		return nil, fmt.Errorf("failed fileLog.open in audit.NewFileLog: %w", err)
+	}
+
+	return l, nil
+}
+
+func (l *fileLog) open() error {
+	file, err := os.OpenFile(l.opts.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open audit log in audit.fileLog.open: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("unable to stat audit log in audit.fileLog.open: %w", err)
+	}
+
+	l.file = file
+	l.size = info.Size()
+
+	return nil
+}
+
+// Record completes the sequence number, time and hashes of event and appends
+// it to the log. Credentials quoted by the error of event are redacted.
+func (l *fileLog) Record(event *Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return errors.New("audit log is closed")
+	}
+
+	event.Error = RedactCredentials(event.Error)
+
+	event.Seq = l.seq + 1
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	event.PrevHash = l.lastHash
+
+	sum, err := hash(event)
+	if err != nil {
+		return fmt.Errorf("failed audit.hash in audit.fileLog.Record: %w", err)
+	}
+	event.Hash = sum
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to serialize event in audit.fileLog.Record: %w", err)
+	}
+	data = append(data, '\n')
+
+	if l.size > 0 && l.size+int64(len(data)) > l.opts.MaxSize {
+		if err := l.rotate(); err != nil {
+			return fmt.Errorf("failed fileLog.rotate in audit.fileLog.Record: %w", err)
+		}
+	}
+
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("unable to write event in audit.fileLog.Record: %w", err)
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("unable to sync audit log in audit.fileLog.Record: %w", err)
+	}
+
+	l.seq = event.Seq
+	l.lastHash = event.Hash
+
+	return nil
+}
+
+// rotate shifts the rotated files, dropping the oldest one, and starts a new
+// file.
+func (l *fileLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("unable to close audit log in audit.fileLog.rotate: %w", err)
+	}
+	l.file = nil
+
+	rotated := rotatedPaths(l.opts.Path, l.opts.MaxFiles)
+	if err := os.Remove(rotated[len(rotated)-1]); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove oldest audit log in audit.fileLog.rotate: %w", err)
+	}
+
+	for i := len(rotated) - 1; i > 0; i-- {
+		if err := os.Rename(rotated[i-1], rotated[i]); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to rotate audit log in audit.fileLog.rotate: %w", err)
+		}
+	}
+
+	if err := os.Rename(l.opts.Path, rotated[0]); err != nil {
+		return fmt.Errorf("unable to rotate audit log in audit.fileLog.rotate: %w", err)
+	}
+
+	return l.open()
+}
+
+func (l *fileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+// rotatedPaths returns the names of count rotated files of path, the most
+// recent first.
+func rotatedPaths(path string, count int) []string {
+	res := make([]string, 0, count)
+	for i := 1; i <= count; i++ {
+		res = append(res, fmt.Sprintf("%s.%d", path, i))
+	}
+
+	return res
+}
+
+// lastEvent returns the last event of the first file in paths which holds
+// one.
+func lastEvent(paths ...string) (*Event, error) {
+	for _, path := range paths {
+		var last *Event
+		err := readEvents(path, func(event *Event) error {
+			last = event
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		if last != nil {
+			return last, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// readEvents calls fn for every event of the file at path.
+func readEvents(path string, fn func(event *Event) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(data) != 0 {
+			event := &Event{}
+			if err := json.Unmarshal(data, event); err != nil {
+				return fmt.Errorf("invalid event at %s:%d: %w", path, line, err)
+			}
+
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to read audit log in audit.readEvents: %w", err)
+		}
+	}
+}
+
+// Environment variables read by OptionsFromEnv.
+const (
+	EnvPath     = "AUDIT_LOG"
+	EnvMaxSize  = "AUDIT_LOG_MAX_SIZE"
+	EnvMaxFiles = "AUDIT_LOG_MAX_FILES"
+
+	// Disabled is the AUDIT_LOG value which turns the audit log off.
+	Disabled = "off"
+)
+
+// OptionsFromEnv reads the audit log options with getenv, the log is written
+// to defaultPath unless AUDIT_LOG is set. It returns nil if the audit log is
+// disabled.
+func OptionsFromEnv(getenv func(string) string, defaultPath string) (*Options, error) {
+	opts := &Options{Path: getenv(EnvPath), MaxSize: DefaultMaxSize, MaxFiles: DefaultMaxFiles}
+
+	switch opts.Path {
+	case Disabled:
+		return nil, nil
+	case "":
+		opts.Path = defaultPath
+	}
+
+	if value := getenv(EnvMaxSize); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid %s value '%s' in audit.OptionsFromEnv", EnvMaxSize, value)
+		}
+		opts.MaxSize = size
+	}
+
+	if value := getenv(EnvMaxFiles); value != "" {
+		files, err := strconv.Atoi(value)
+		if err != nil || files <= 0 {
+			return nil, fmt.Errorf("invalid %s value '%s' in audit.OptionsFromEnv", EnvMaxFiles, value)
+		}
+		opts.MaxFiles = files
+	}
+
+	return opts, nil
+}
+
+// credentials matches the password of ftp urls and of the user option of
+// curlftpfs, which errors of the mounts may quote.
+var credentials = regexp.MustCompile(`(ftp://[^:/@\s]*:|user=[^:,\s]*:)[^@,\s]+`)
+
+// RedactCredentials replaces the passwords of ftp urls and of the user option
+// of curlftpfs in msg.
+func RedactCredentials(msg string) string {
+	return credentials.ReplaceAllString(msg, "${1}"+redacted)
+}
@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+)
+
+// Verify checks the hash chain of the log at path and of its rotated files,
+// oldest first, and returns the number of verified events. The first event
+// of the oldest file is trusted to link to events dropped by rotation.
+func Verify(path string) (int, error) {
+	paths := []string{path}
+	for i := 1; ; i++ {
+		rotated := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(rotated); err != nil {
+			break
+		}
+		paths = append([]string{rotated}, paths...)
+	}
+
+	var prev *Event
+	count := 0
+
+	for _, p := range paths {
+		err := readEvents(p, func(event *Event) error {
+			sum, err := hash(event)
+			if err != nil {
+				return err
+			}
+
+			if sum != event.Hash {
+				return fmt.Errorf("event %d in %s was modified", event.Seq, p)
+			}
+
+			if prev != nil {
+				if event.PrevHash != prev.Hash {
+					return fmt.Errorf("event %d in %s does not follow event %d", event.Seq, p, prev.Seq)
+				}
+
+				if event.Seq != prev.Seq+1 {
+					return fmt.Errorf("events %d to %d are missing before %s", prev.Seq+1, event.Seq-1, p)
+				}
+			}
+
+			prev = event
+			count++
+
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return count, fmt.Errorf("audit log verification failed: %w", err)
+		}
+	}
+
+	return count, nil
+}
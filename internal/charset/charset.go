@@ -0,0 +1,126 @@
+// Package charset transcodes the file names of ftp servers which do not
+// use UTF-8.
+package charset
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// UTF8 is the name of the encoding names are kept in.
+const UTF8 = "utf-8"
+
+// asciiProbe must survive the encoding unchanged, the names are joined and
+// split on '/' in the encoded form.
+const asciiProbe = "/.-_ 0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// ErrUnsupported is returned for encodings not usable for file names.
+var ErrUnsupported = errors.New("encoding not supported")
+
+// Codec transcodes names between UTF-8 and the encoding of the server. A nil
+// *Codec keeps the names unchanged.
+type Codec struct {
+	name string
+	enc  encoding.Encoding
+}
+
+// New returns the codec of the encoding called name, e.g. cp1251 or
+// windows-1251. Empty names and UTF-8 return a nil codec.
+func New(name string) (*Codec, error) {
+	canonical, err := Canonical(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if canonical == "" {
+		return nil, nil
+	}
+
+	enc, _ := htmlindex.Get(canonical)
+
+	return &Codec{name: canonical, enc: enc}, nil
+}
+
+// Canonical returns the canonical name of the encoding called name, or an
+// empty string for UTF-8. Encodings which change ASCII, e.g. UTF-16, are not
+// supported.
+func Canonical(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, name)
+	}
+
+	canonical, err := htmlindex.Name(enc)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, name)
+	}
+
+	if canonical == UTF8 {
+		return "", nil
+	}
+
+	encoded, err := enc.NewEncoder().String(asciiProbe)
+	if err != nil || encoded != asciiProbe {
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, name)
+	}
+
+	decoded, err := enc.NewDecoder().String(asciiProbe)
+	if err != nil || decoded != asciiProbe {
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, name)
+	}
+
+	return canonical, nil
+}
+
+// Name returns the canonical name of the encoding, UTF-8 for a nil codec.
+func (c *Codec) Name() string {
+	if c == nil {
+		return UTF8
+	}
+
+	return c.name
+}
+
+// Encode returns name in the encoding of the server. Names with characters
+// the encoding lacks can not be encoded.
+func (c *Codec) Encode(name string) (string, error) {
+	if c == nil {
+		return name, nil
+	}
+
+	res, err := c.enc.NewEncoder().String(name)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode '%s' as %s: %w", name, c.name, err)
+	}
+
+	return res, nil
+}
+
+// Decode returns the name listed by the server in UTF-8. Names which do not
+// survive the way back, e.g. with bytes the encoding does not define, can
+// not be decoded.
+func (c *Codec) Decode(name string) (string, error) {
+	if c == nil {
+		return name, nil
+	}
+
+	res, err := c.enc.NewDecoder().String(name)
+	if err == nil {
+		// the server could not be asked for a name which encodes differently
+		if encoded, encErr := c.enc.NewEncoder().String(res); encErr != nil || encoded != name {
+			err = errors.New("invalid byte sequence")
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to decode %q as %s: %w", name, c.name, err)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,104 @@
+package charset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name      string
+		canonical string
+		ok        bool
+	}{
+		{name: "", canonical: "", ok: true},
+		{name: "utf8", canonical: "", ok: true},
+		{name: "UTF-8", canonical: "", ok: true},
+		{name: "cp1251", canonical: "windows-1251", ok: true},
+		{name: "Windows-1251", canonical: "windows-1251", ok: true},
+		{name: "koi8-r", canonical: "koi8-r", ok: true},
+		{name: "shift_jis", canonical: "shift_jis", ok: true},
+		{name: "latin1", canonical: "windows-1252", ok: true},
+		{name: "utf-16le", ok: false},
+		{name: "replacement", ok: false},
+		{name: "ebcdic", ok: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			canonical, err := Canonical(test.name)
+			if !test.ok {
+				assert.ErrorIs(t, err, ErrUnsupported)
+				return
+			}
+
+			require.Nil(t, err)
+			assert.Equal(t, test.canonical, canonical)
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		encoding string
+		name     string
+		encoded  string
+	}{
+		{encoding: "cp1251", name: "Отчёт 2023.txt", encoded: "\xce\xf2\xf7\xb8\xf2 2023.txt"},
+		{encoding: "koi8-r", name: "папка", encoded: "\xd0\xc1\xd0\xcb\xc1"},
+		{encoding: "shift_jis", name: "日本.txt", encoded: "\x93\xfa\x96\x7b.txt"},
+		{encoding: "cp1251", name: "plain.txt", encoded: "plain.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.encoding+" "+test.name, func(t *testing.T) {
+			codec, err := New(test.encoding)
+			require.Nil(t, err)
+
+			encoded, err := codec.Encode(test.name)
+			require.Nil(t, err)
+			assert.Equal(t, test.encoded, encoded)
+
+			decoded, err := codec.Decode(encoded)
+			require.Nil(t, err)
+			assert.Equal(t, test.name, decoded)
+		})
+	}
+}
+
+func TestCodec(t *testing.T) {
+	t.Run("utf-8 keeps names", func(t *testing.T) {
+		codec, err := New("utf-8")
+		require.Nil(t, err)
+		assert.Nil(t, codec)
+		assert.Equal(t, UTF8, codec.Name())
+
+		encoded, err := codec.Encode("Отчёт")
+		require.Nil(t, err)
+		assert.Equal(t, "Отчёт", encoded)
+	})
+
+	t.Run("character missing in encoding", func(t *testing.T) {
+		codec, err := New("cp1251")
+		require.Nil(t, err)
+
+		_, err = codec.Encode("日本")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("byte undefined in encoding", func(t *testing.T) {
+		codec, err := New("cp1251")
+		require.Nil(t, err)
+
+		// 0x98 is the only byte windows-1251 leaves undefined
+		_, err = codec.Decode("a\x98b")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("unsupported encoding", func(t *testing.T) {
+		_, err := New("utf-16")
+		assert.ErrorIs(t, err, ErrUnsupported)
+	})
+}
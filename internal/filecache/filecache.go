@@ -0,0 +1,289 @@
+// Package filecache is a size bounded on-disk cache of downloaded files. The
+// least recently used files are evicted first, the cache survives restarts.
+package filecache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+// EnvSizeMB is the environment variable read by OptionsFromEnv.
+const EnvSizeMB = "CACHE_SIZE_MB"
+
+const DefaultSizeMB = 1024
+
+// Options configures a Cache. MaxSize of 0 disables the cache.
+type Options struct {
+	Dir     string
+	MaxSize int64
+}
+
+// OptionsFromEnv reads the cache options with getenv, the files are kept in
+// dir.
+func OptionsFromEnv(getenv func(string) string, dir string) (*Options, error) {
+	opts := &Options{Dir: dir, MaxSize: DefaultSizeMB << 20}
+
+	if value := getenv(EnvSizeMB); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 0 || size > 1<<40 {
+			return nil, fmt.Errorf("invalid %s value '%s' in filecache.OptionsFromEnv", EnvSizeMB, value)
+		}
+		opts.MaxSize = size << 20
+	}
+
+	return opts, nil
+}
+
+// Key identifies a version of a remote file. A file changed on the server
+// gets a new key, the old version ages out of the cache.
+type Key struct {
+	FTP     *models.FTPConnectionOpt
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+func (k Key) name() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d\x00%s\x00%d\x00%d",
+		strings.ToLower(k.FTP.Host), k.FTP.Port, k.Path, k.Size, k.ModTime.UnixNano())))
+	return hex.EncodeToString(sum[:])
+}
+
+// Stats describes the content and the use of the cache.
+type Stats struct {
+	Entries   int
+	Size      int64
+	MaxSize   int64
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+// Cache is safe for concurrent use. A nil Cache caches nothing.
+type Cache struct {
+	opts *Options
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	stats   Stats
+}
+
+type cacheEntry struct {
+	name string
+	size int64
+}
+
+// New opens the cache in opts.Dir and indexes the files kept there, the most
+// recently used first.
+func New(opts *Options) (*Cache, error) {
+	c := &Cache{opts: opts, lru: list.New(), entries: make(map[string]*list.Element)}
+	c.stats.MaxSize = opts.MaxSize
+
+	if opts.MaxSize == 0 {
+		return c, nil
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create cache dir in filecache.New: %w", err)
+	}
+
+	type found struct {
+		name  string
+		size  int64
+		mtime time.Time
+	}
+
+	files := make([]found, 0)
+	err := filepath.WalkDir(opts.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		// leftovers of interrupted stores
+		if strings.HasPrefix(d.Name(), ".") {
+			return os.Remove(p)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		files = append(files, found{name: d.Name(), size: info.Size(), mtime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to index cache dir in filecache.New: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].mtime.After(files[j].mtime) })
+	for _, f := range files {
+		c.entries[f.name] = c.lru.PushBack(&cacheEntry{name: f.name, size: f.size})
+		c.stats.Size += f.size
+	}
+	c.stats.Entries = len(files)
+	c.evict(0)
+
+	return c, nil
+}
+
+// Enabled reports whether c caches files.
+func (c *Cache) Enabled() bool {
+	return c != nil && c.opts.MaxSize > 0
+}
+
+func (c *Cache) path(name string) string {
+	return filepath.Join(c.opts.Dir, name[:2], name)
+}
+
+// Open returns the cached file of key, or false on a miss. The file must be
+// closed by the caller, it stays readable when it is evicted meanwhile.
+func (c *Cache) Open(key Key) (*os.File, bool) {
+	if !c.Enabled() {
+		return nil, false
+	}
+
+	name := key.name()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[name]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	file, err := os.Open(c.path(name))
+	if err != nil {
+		c.remove(elem)
+		c.stats.Misses++
+		return nil, false
+	}
+
+	// the time of the file keeps the order of use across restarts
+	now := time.Now()
+	_ = os.Chtimes(c.path(name), now, now)
+	c.lru.MoveToFront(elem)
+	c.stats.Hits++
+
+	return file, true
+}
+
+// Put stores size bytes read from r under key. Files larger than the cache
+// are not stored.
+func (c *Cache) Put(key Key, r io.Reader, size int64) error {
+	if !c.Enabled() || size > c.opts.MaxSize {
+		return nil
+	}
+
+	name := key.name()
+	if err := os.MkdirAll(filepath.Dir(c.path(name)), 0700); err != nil {
+		return fmt.Errorf("unable to create cache dir in filecache.Put: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path(name)), ".put-")
+	if err != nil {
+		return fmt.Errorf("unable to create cache file in filecache.Put: %w", err)
+	}
+
+	n, err := io.Copy(tmp, io.LimitReader(r, size))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n != size {
+		err = fmt.Errorf("short read of %d of %d bytes", n, size)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("unable to write cache file in filecache.Put: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[name]; ok {
+		c.remove(elem)
+	}
+
+	c.evict(size)
+
+	if err := os.Rename(tmp.Name(), c.path(name)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("unable to store cache file in filecache.Put: %w", err)
+	}
+
+	c.entries[name] = c.lru.PushFront(&cacheEntry{name: name, size: size})
+	c.stats.Entries++
+	c.stats.Size += size
+
+	return nil
+}
+
+// Purge removes all cached files and returns the stats of the removed ones.
+func (c *Cache) Purge() Stats {
+	if !c.Enabled() {
+		return Stats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := Stats{Entries: c.stats.Entries, Size: c.stats.Size}
+
+	for elem := c.lru.Front(); elem != nil; elem = c.lru.Front() {
+		c.remove(elem)
+	}
+
+	return purged
+}
+
+// Stats returns the stats of the cache.
+func (c *Cache) Stats() Stats {
+	if !c.Enabled() {
+		return Stats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// evict removes the least recently used files until size more bytes fit,
+// c.mu must be held.
+func (c *Cache) evict(size int64) {
+	for c.stats.Size+size > c.opts.MaxSize {
+		elem := c.lru.Back()
+		if elem == nil {
+			return
+		}
+
+		c.remove(elem)
+		c.stats.Evictions++
+	}
+}
+
+// remove deletes the file of elem, c.mu must be held.
+func (c *Cache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.name)
+	c.stats.Entries--
+	c.stats.Size -= entry.size
+
+	_ = os.Remove(c.path(entry.name))
+}
@@ -0,0 +1,139 @@
+package filecache
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+func testKey(path string, size int64) Key {
+	return Key{
+		FTP:     &models.FTPConnectionOpt{Host: "ftp.example.com", Port: 21},
+		Path:    path,
+		Size:    size,
+		ModTime: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func put(t *testing.T, cache *Cache, key Key, data string) {
+	require.Nil(t, cache.Put(key, strings.NewReader(data), int64(len(data))))
+}
+
+func read(t *testing.T, cache *Cache, key Key) (string, bool) {
+	file, ok := cache.Open(key)
+	if !ok {
+		return "", false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	require.Nil(t, err)
+
+	return string(data), true
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	opts, err := OptionsFromEnv(func(string) string { return "" }, "/cache")
+	require.Nil(t, err)
+	assert.Equal(t, &Options{Dir: "/cache", MaxSize: DefaultSizeMB << 20}, opts)
+
+	opts, err = OptionsFromEnv(func(string) string { return "0" }, "/cache")
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), opts.MaxSize)
+
+	_, err = OptionsFromEnv(func(string) string { return "-1" }, "/cache")
+	assert.NotNil(t, err)
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := New(&Options{Dir: dir, MaxSize: 10})
+	require.Nil(t, err)
+
+	first, second, third := testKey("/a", 4), testKey("/b", 4), testKey("/c", 4)
+
+	t.Run("put and open", func(t *testing.T) {
+		_, ok := read(t, cache, first)
+		assert.False(t, ok)
+
+		put(t, cache, first, "aaaa")
+		data, ok := read(t, cache, first)
+		assert.True(t, ok)
+		assert.Equal(t, "aaaa", data)
+	})
+
+	t.Run("changed file is a miss", func(t *testing.T) {
+		changed := first
+		changed.ModTime = changed.ModTime.Add(time.Second)
+
+		_, ok := read(t, cache, changed)
+		assert.False(t, ok)
+	})
+
+	t.Run("least recently used is evicted", func(t *testing.T) {
+		put(t, cache, second, "bbbb")
+
+		// opening first makes second the least recently used file
+		_, ok := read(t, cache, first)
+		require.True(t, ok)
+
+		put(t, cache, third, "cccc")
+
+		_, ok = read(t, cache, second)
+		assert.False(t, ok)
+		_, ok = read(t, cache, first)
+		assert.True(t, ok)
+
+		stats := cache.Stats()
+		assert.Equal(t, 2, stats.Entries)
+		assert.Equal(t, int64(8), stats.Size)
+		assert.Equal(t, int64(1), stats.Evictions)
+	})
+
+	t.Run("files larger than the cache are skipped", func(t *testing.T) {
+		put(t, cache, testKey("/big", 11), "01234567890")
+		assert.Equal(t, 2, cache.Stats().Entries)
+	})
+
+	t.Run("content survives restart", func(t *testing.T) {
+		require.Nil(t, os.WriteFile(filepath.Join(dir, ".put-leftover"), []byte("x"), 0600))
+
+		reopened, err := New(&Options{Dir: dir, MaxSize: 10})
+		require.Nil(t, err)
+
+		data, ok := read(t, reopened, third)
+		assert.True(t, ok)
+		assert.Equal(t, "cccc", data)
+		assert.Equal(t, int64(8), reopened.Stats().Size)
+		assert.NoFileExists(t, filepath.Join(dir, ".put-leftover"))
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		assert.Equal(t, Stats{Entries: 2, Size: 8}, cache.Purge())
+		assert.Equal(t, 0, cache.Stats().Entries)
+
+		_, ok := read(t, cache, first)
+		assert.False(t, ok)
+	})
+}
+
+func TestDisabled(t *testing.T) {
+	var cache *Cache
+	assert.False(t, cache.Enabled())
+	assert.Nil(t, cache.Put(testKey("/a", 1), strings.NewReader("a"), 1))
+
+	cache, err := New(&Options{Dir: t.TempDir()})
+	require.Nil(t, err)
+	assert.False(t, cache.Enabled())
+
+	_, ok := cache.Open(testKey("/a", 1))
+	assert.False(t, ok)
+	assert.Equal(t, Stats{}, cache.Purge())
+}
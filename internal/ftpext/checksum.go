@@ -0,0 +1,172 @@
+package ftpext
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/textproto"
+	"strings"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// Hash commands.
+const (
+	CommandHash    = "HASH"
+	CommandXSHA256 = "XSHA256"
+	CommandXMD5    = "XMD5"
+	CommandXCRC    = "XCRC"
+)
+
+// algorithms are the supported checksum algorithms, strongest first, with
+// their name in HASH and their own command.
+var algorithms = []struct {
+	name    string
+	command string
+	new     func() hash.Hash
+}{
+	{name: "SHA-256", command: CommandXSHA256, new: sha256.New},
+	{name: "MD5", command: CommandXMD5, new: md5.New},
+	{name: "CRC32", command: CommandXCRC, new: func() hash.Hash { return crc32.NewIEEE() }},
+}
+
+// Checksum is a way of the server to compute the checksum of a file.
+type Checksum struct {
+	// Command is HASH or one of the algorithm specific commands.
+	Command string
+	// Algorithm is the name of the algorithm as listed by HASH.
+	Algorithm string
+}
+
+// MismatchError is returned when the checksum of a transferred file differs
+// between the local copy and the server.
+type MismatchError struct {
+	Path      string
+	Algorithm string
+	Local     string
+	Remote    string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s checksum of '%s' is %s locally and %s on the server", e.Algorithm, e.Path, e.Local, e.Remote)
+}
+
+// NegotiateChecksum picks the strongest checksum the server advertises in
+// features. HASH is preferred over the algorithm specific commands.
+func NegotiateChecksum(features map[string]string) (Checksum, bool) {
+	if desc, ok := features[CommandHash]; ok {
+		listed := make(map[string]struct{})
+		for _, name := range strings.Split(desc, ";") {
+			listed[strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(name), "*"))] = struct{}{}
+		}
+
+		for _, algorithm := range algorithms {
+			if _, ok := listed[algorithm.name]; ok {
+				return Checksum{Command: CommandHash, Algorithm: algorithm.name}, true
+			}
+		}
+	}
+
+	for _, algorithm := range algorithms {
+		if _, ok := features[algorithm.command]; ok {
+			return Checksum{Command: algorithm.command, Algorithm: algorithm.name}, true
+		}
+	}
+
+	return Checksum{}, false
+}
+
+func (c Checksum) new() hash.Hash {
+	for _, algorithm := range algorithms {
+		if algorithm.name == c.Algorithm {
+			return algorithm.new()
+		}
+	}
+
+	return nil
+}
+
+// Local returns the checksum of the content of r in lower case hex.
+func (c Checksum) Local(r io.Reader) (string, error) {
+	h := c.new()
+	if h == nil {
+		return "", fmt.Errorf("unknown checksum algorithm %s", c.Algorithm)
+	}
+
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Remote asks the server for the checksum of the file p and returns it in
+// lower case hex.
+func (c Checksum) Remote(cmd Cmd, p string) (string, error) {
+	h := c.new()
+	if h == nil {
+		return "", fmt.Errorf("unknown checksum algorithm %s", c.Algorithm)
+	}
+
+	if c.Command == CommandHash {
+		code, msg, err := cmd("OPTS HASH %s", c.Algorithm)
+		if err != nil {
+			return "", err
+		}
+		if code != ftp.StatusCommandOK {
+			return "", &textproto.Error{Code: code, Msg: msg}
+		}
+	}
+
+	code, msg, err := cmd("%s %s", c.Command, p)
+	if err != nil {
+		return "", err
+	}
+	if code < 200 || code >= 300 {
+		return "", &textproto.Error{Code: code, Msg: msg}
+	}
+
+	sum, ok := parseSum(msg, h.Size()*2)
+	if !ok {
+		return "", fmt.Errorf("no %s checksum in reply %q", c.Algorithm, msg)
+	}
+
+	return sum, nil
+}
+
+// parseSum finds the hex checksum of the given length in a reply such as
+// "SHA-256 0-49 <sum> name" for HASH or "<sum>" for the older commands.
+// Servers drop the leading zeros of CRC32 sums, shorter sums are padded.
+func parseSum(msg string, length int) (string, bool) {
+	for _, field := range strings.Fields(msg) {
+		if len(field) > length || !isHex(field) {
+			continue
+		}
+
+		if len(field) < length && length != 8 {
+			continue
+		}
+
+		return strings.Repeat("0", length-len(field)) + strings.ToLower(field), true
+	}
+
+	return "", false
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,87 @@
+package ftpext
+
+import (
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr/ftptest"
+)
+
+func TestNegotiateChecksum(t *testing.T) {
+	tests := []struct {
+		name     string
+		features map[string]string
+		checksum Checksum
+		ok       bool
+	}{
+		{name: "none", features: map[string]string{"SIZE": ""}, ok: false},
+		{name: "hash", features: map[string]string{"HASH": "SHA-1;MD5*;CRC32", "XSHA256": ""}, checksum: Checksum{Command: "HASH", Algorithm: "MD5"}, ok: true},
+		{name: "hash without known algorithm", features: map[string]string{"HASH": "SHA-512", "XCRC": ""}, checksum: Checksum{Command: "XCRC", Algorithm: "CRC32"}, ok: true},
+		{name: "strongest command", features: map[string]string{"XCRC": "", "XMD5": "", "XSHA256": ""}, checksum: Checksum{Command: "XSHA256", Algorithm: "SHA-256"}, ok: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checksum, ok := NegotiateChecksum(test.features)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.checksum, checksum)
+		})
+	}
+}
+
+func TestParseSum(t *testing.T) {
+	sum, ok := parseSum("SHA-256 0-3 ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad abc", 64)
+	assert.True(t, ok)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", sum)
+
+	sum, ok = parseSum("352441C2", 8)
+	assert.True(t, ok)
+	assert.Equal(t, "352441c2", sum)
+
+	sum, ok = parseSum("52441C2", 8)
+	assert.True(t, ok)
+	assert.Equal(t, "052441c2", sum)
+
+	_, ok = parseSum("file not found", 32)
+	assert.False(t, ok)
+}
+
+func TestChecksum(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	server.WriteFile("/file", []byte("content"))
+	cmd := dialCmd(t, server)
+
+	for _, checksum := range []Checksum{
+		{Command: CommandHash, Algorithm: "SHA-256"},
+		{Command: CommandHash, Algorithm: "CRC32"},
+		{Command: CommandXSHA256, Algorithm: "SHA-256"},
+		{Command: CommandXMD5, Algorithm: "MD5"},
+		{Command: CommandXCRC, Algorithm: "CRC32"},
+	} {
+		t.Run(checksum.Command+" "+checksum.Algorithm, func(t *testing.T) {
+			remote, err := checksum.Remote(cmd, "/file")
+			require.Nil(t, err)
+
+			local, err := checksum.Local(strings.NewReader("content"))
+			require.Nil(t, err)
+			assert.Equal(t, local, remote)
+
+			local, err = checksum.Local(strings.NewReader("c0ntent"))
+			require.Nil(t, err)
+			assert.NotEqual(t, local, remote)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := Checksum{Command: CommandXMD5, Algorithm: "MD5"}.Remote(cmd, "/missing")
+		var protoErr *textproto.Error
+		require.ErrorAs(t, err, &protoErr)
+		assert.Equal(t, 550, protoErr.Code)
+	})
+}
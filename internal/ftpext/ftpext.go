@@ -0,0 +1,75 @@
+// Package ftpext implements ftp extensions which are not exposed by the ftp
+// client library on top of a function sending raw commands.
+package ftpext
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// Cmd sends a command on the control connection and returns the reply
+// whatever its code is.
+type Cmd func(format string, args ...interface{}) (int, string, error)
+
+// Raw returns a Cmd sending commands on conn, the control connection of a
+// logged in ftp client which must be idle while the commands run. The reply
+// is read byte by byte, nothing after it is taken from conn and the client
+// keeps reading its own replies. A Cmd failing with something else than an
+// ftp reply leaves conn in an unknown state, the client must be closed.
+func Raw(conn net.Conn) Cmd {
+	r := textproto.NewReader(bufio.NewReaderSize(byteReader{conn}, 16))
+
+	return func(format string, args ...interface{}) (int, string, error) {
+		if _, err := fmt.Fprintf(conn, format+"\r\n", args...); err != nil {
+			return 0, "", err
+		}
+
+		return r.ReadResponse(-1)
+	}
+}
+
+// byteReader reads at most one byte at a time, a buffered reader on top of
+// it never reads past the line it returns.
+type byteReader struct {
+	r io.Reader
+}
+
+func (b byteReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+
+	return b.r.Read(p)
+}
+
+// Features returns the FEAT reply of the server, keyed by upper case command.
+// Servers without FEAT have no features.
+func Features(cmd Cmd) (map[string]string, error) {
+	res := make(map[string]string)
+
+	code, msg, err := cmd("FEAT")
+	if err != nil {
+		return res, err
+	}
+
+	if code != ftp.StatusSystem {
+		return res, nil
+	}
+
+	for _, line := range strings.Split(msg, "\n") {
+		if !strings.HasPrefix(line, " ") {
+			continue
+		}
+
+		command, desc, _ := strings.Cut(strings.TrimSpace(line), " ")
+		res[strings.ToUpper(command)] = desc
+	}
+
+	return res, nil
+}
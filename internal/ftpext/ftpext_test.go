@@ -0,0 +1,77 @@
+package ftpext
+
+import (
+	"fmt"
+	"net"
+	"net/textproto"
+	"testing"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr/ftptest"
+)
+
+// dialCmd returns a Cmd of a logged in raw connection to the server.
+func dialCmd(t *testing.T, server *ftptest.Server) Cmd {
+	conn, err := textproto.Dial("tcp", fmt.Sprintf("%s:%d", server.Host, server.Port))
+	require.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	_, _, err = conn.ReadResponse(220)
+	require.Nil(t, err)
+
+	cmd := func(format string, args ...interface{}) (int, string, error) {
+		if _, err := conn.Cmd(format, args...); err != nil {
+			return 0, "", err
+		}
+		return conn.ReadResponse(-1)
+	}
+
+	_, _, err = cmd("USER %s", server.User)
+	require.Nil(t, err)
+	code, _, err := cmd("PASS %s", server.Password)
+	require.Nil(t, err)
+	require.Equal(t, 230, code)
+
+	return cmd
+}
+
+func TestFeatures(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	server.SetFeatures("SIZE", "HASH SHA-256*;MD5")
+
+	features, err := Features(dialCmd(t, server))
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{"SIZE": "", "HASH": "SHA-256*;MD5"}, features)
+}
+
+func TestRaw(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	server.SetFeatures("SIZE")
+
+	var netConn net.Conn
+	conn, err := ftp.Dial(fmt.Sprintf("%s:%d", server.Host, server.Port), ftp.DialWithDialFunc(func(network, address string) (net.Conn, error) {
+		var err error
+		netConn, err = net.Dial(network, address)
+		return netConn, err
+	}))
+	require.Nil(t, err)
+	defer conn.Quit()
+	require.Nil(t, conn.Login(server.User, server.Password))
+
+	// the client stays in sync with the server around the raw commands
+	for i := 0; i < 3; i++ {
+		features, err := Features(Raw(netConn))
+		require.Nil(t, err)
+		assert.Equal(t, map[string]string{"SIZE": ""}, features)
+
+		require.Nil(t, conn.NoOp())
+	}
+}
@@ -0,0 +1,36 @@
+package ftpmngr
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpext"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/tracing"
+)
+
+func (mngr *ftpmngr) Capabilities(ctx context.Context, opt *models.FTPConnectionOpt) (_ *models.ServerCapabilities, err error) {
+	ctx, span := tracing.Start(ctx, "ftpmngr.Capabilities", serverAttrs(opt)...)
+	defer func() { tracing.End(span, err) }()
+
+	conn, err := mngr.acquire(ctx, opt)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to ftp server in ftpmngr.Capabilities: %w", err)
+	}
+
+	var features map[string]string
+	err = mngr.raw(ctx, conn, func(cmd ftpext.Cmd) {
+		features, _ = ftpext.Features(cmd)
+	})
+	mngr.release(opt, conn, err)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get ftp server features in ftpmngr.Capabilities: %w", err)
+	}
+
+	caps := &models.ServerCapabilities{Features: features, CheckedAt: time.Now()}
+	mngr.log(ctx).Debugw("discovered ftp server features", "addr", getURL(opt), "features", caps.Supported())
+
+	return caps, nil
+}
@@ -0,0 +1,53 @@
+package ftpmngr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr/ftptest"
+	"go.uber.org/zap"
+)
+
+func TestCapabilities(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	mngr := NewFTPManager(DefaultOptions(), logger)
+
+	t.Run("default features", func(t *testing.T) {
+		caps, err := mngr.Capabilities(context.Background(), server.Opt())
+		require.Nil(t, err)
+		assert.Equal(t, []string{"EPSV", "MDTM", "MLST", "REST", "SIZE", "UTF8"}, caps.Supported())
+		assert.Equal(t, "STREAM", caps.Features["REST"])
+		assert.False(t, caps.CheckedAt.IsZero())
+	})
+
+	t.Run("minimal server", func(t *testing.T) {
+		server.SetFeatures("SIZE", "XCRC")
+		defer server.SetFeatures(ftptest.DefaultFeatures...)
+
+		caps, err := mngr.Capabilities(context.Background(), server.Opt())
+		require.Nil(t, err)
+		assert.Equal(t, []string{"SIZE", "XCRC"}, caps.Supported())
+		assert.True(t, caps.Lacks("EPSV"))
+
+		// FEAT is sent on the pooled connection
+		assert.Equal(t, 1, server.Accepted())
+	})
+
+	t.Run("invalid password", func(t *testing.T) {
+		opt := server.Opt()
+		opt.Password = "invalid"
+
+		_, err := mngr.Capabilities(context.Background(), opt)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,82 @@
+package ftpmngr
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+// dial opens the control connection to the ftp server. The returned
+// connection has a deadline for reading the greeting of the server.
+func (mngr *ftpmngr) dial(ctx context.Context, opt *models.FTPConnectionOpt) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, mngr.opts.DialTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", getURL(opt))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to ftp server in ftpmngr.dial: %w", err)
+	}
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to set deadline in ftpmngr.dial: %w", err)
+	}
+
+	return conn, nil
+}
+
+// dialFunc returns the dial function of the ftp client. The first call hands
+// out the control connection, later calls open data connections.
+func (mngr *ftpmngr) dialFunc(control net.Conn) func(network, address string) (net.Conn, error) {
+	var once sync.Once
+
+	return func(network, address string) (net.Conn, error) {
+		conn := net.Conn(nil)
+		once.Do(func() { conn = control })
+		if conn != nil {
+			return conn, nil
+		}
+
+		return net.DialTimeout(network, address, mngr.opts.DialTimeout)
+	}
+}
+
+// loginDeadline returns the deadline of the login on a new connection, the
+// earlier of the login timeout and the deadline of ctx.
+func (mngr *ftpmngr) loginDeadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(mngr.opts.LoginTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+
+	return deadline
+}
+
+// interrupt closes conn when ctx is done before stop is called, which
+// unblocks a pending read or write. stop returns ctx.Err() if conn was
+// closed.
+func interrupt(ctx context.Context, conn net.Conn) (stop func() error) {
+	done := make(chan struct{})
+	res := make(chan error, 1)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			res <- ctx.Err()
+		case <-done:
+			res <- nil
+		}
+	}()
+
+	return func() error {
+		close(done)
+		return <-res
+	}
+}
@@ -1,8 +1,29 @@
 package ftpmngr
 
-import "github.com/t1d333/docker-volume-ftp-driver/internal/models"
+import (
+	"context"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
 
 type FTPManager interface {
-	CheckConnection(opt *models.FTPConnectionOpt) error
-	CheckRemoteDir(remotepath string, opt *models.FTPConnectionOpt) error
+	// Capabilities returns the features the server lists in its FEAT reply.
+	Capabilities(ctx context.Context, opt *models.FTPConnectionOpt) (*models.ServerCapabilities, error)
+	CheckConnection(ctx context.Context, opt *models.FTPConnectionOpt) error
+	CheckRemoteDir(ctx context.Context, remotepath string, opt *models.FTPConnectionOpt) error
+	RemoveRemoteDir(ctx context.Context, remotepath string, opt *models.FTPConnectionOpt) error
+	Usage(ctx context.Context, remotepath string, opt *models.FTPConnectionOpt) (*models.VolumeUsage, error)
+	// Download copies the tree below remotepath into dir and returns the
+	// snapshot of the copied entries.
+	Download(ctx context.Context, remotepath, dir string, opt *models.FTPConnectionOpt) (models.StageSnapshot, error)
+	// Sync updates the copy of remotepath in dir which previous describes,
+	// downloading only the files changed since. The returned snapshot
+	// describes dir, also when the sync failed.
+	Sync(ctx context.Context, remotepath, dir string, previous models.StageSnapshot, opt *models.FTPConnectionOpt) (models.StageSnapshot, error)
+	// Upload copies the changes made in dir since snapshot was taken to
+	// remotepath. Nothing is changed and a *ConflictError is returned when
+	// paths were also changed on the server. Files are stored under the
+	// temporary name of the partial pattern and renamed into place, an empty
+	// pattern stores them in place.
+	Upload(ctx context.Context, dir, remotepath string, snapshot models.StageSnapshot, partial string, opt *models.FTPConnectionOpt) error
 }
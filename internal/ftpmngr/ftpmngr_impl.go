@@ -1,69 +1,204 @@
 package ftpmngr
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/textproto"
+	"sync"
+	"time"
 
 	"github.com/jlaffaye/ftp"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/metrics"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/retry"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/tracing"
 	pkgLogger "github.com/t1d333/docker-volume-ftp-driver/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ftpmngr struct {
-	logger pkgLogger.Logger
+	logger     pkgLogger.Logger
+	opts       *Options
+	pools      *sync.Map
+	usageCache *sync.Map
+	usageTTL   time.Duration
 }
 
 func getURL(opt *models.FTPConnectionOpt) string {
 	return fmt.Sprintf("%s:%d", opt.Host, opt.Port)
 }
 
-func NewFTPManager(logger pkgLogger.Logger) FTPManager {
-	return &ftpmngr{logger: logger}
+func NewFTPManager(opts *Options, logger pkgLogger.Logger) FTPManager {
+	return &ftpmngr{logger: logger, opts: opts, pools: new(sync.Map), usageCache: new(sync.Map), usageTTL: usageCacheTTL}
 }
 
-func (mngr *ftpmngr) CheckConnection(opt *models.FTPConnectionOpt) error {
-	conn, err := mngr.getConnection(opt)
+// log returns the logger with the request fields carried by ctx.
+func (mngr *ftpmngr) log(ctx context.Context) pkgLogger.Logger {
+	return pkgLogger.FromContext(ctx, mngr.logger)
+}
+
+// retryPolicy returns the driver-wide retry policy with the overrides of the
+// volume applied.
+func (mngr *ftpmngr) retryPolicy(opt *models.FTPConnectionOpt) models.RetryPolicy {
+	return mngr.opts.Retry.Override(opt.Retry)
+}
+
+// logRetry returns the retry callback logging failed connection attempts.
+func (mngr *ftpmngr) logRetry(ctx context.Context, opt *models.FTPConnectionOpt) func(attempt int, err error) {
+	return func(attempt int, err error) {
+		mngr.log(ctx).Warnw("retrying ftp connection", "addr", getURL(opt), "attempt", attempt, "error", err.Error())
+	}
+}
+
+// serverAttrs describes the ftp server in span attributes.
+func serverAttrs(opt *models.FTPConnectionOpt) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("net.peer.name", opt.Host),
+		attribute.Int("net.peer.port", opt.Port),
+	}
+}
+
+func (mngr *ftpmngr) CheckConnection(ctx context.Context, opt *models.FTPConnectionOpt) (err error) {
+	ctx, span := tracing.Start(ctx, "ftpmngr.CheckConnection", serverAttrs(opt)...)
+	defer func() { tracing.End(span, err) }()
+
+	conn, err := mngr.acquire(ctx, opt)
 	if err == nil {
-		if err := conn.Quit(); err != nil {
-			mngr.logger.Errorf("failed to close ftp connection: %s", err.Error())
-		}
+		mngr.release(opt, conn, nil)
 	} else {
+		metrics.ConnectionCheckFailures.WithLabelValues(getURL(opt)).Inc()
 		return fmt.Errorf("failed to connect to ftp server: %w", err)
 	}
 
 	return nil
 }
 
-func (mngr *ftpmngr) getConnection(opt *models.FTPConnectionOpt) (*ftp.ServerConn, error) {
-	conn, err := ftp.Dial(getURL(opt))
+// getConnection connects and logs in to the ftp server, transient failures
+// are retried with the retry policy of the volume.
+func (mngr *ftpmngr) getConnection(ctx context.Context, opt *models.FTPConnectionOpt) (*pooledConn, error) {
+	var conn *pooledConn
+
+	err := retry.Do(ctx, mngr.retryPolicy(opt), func(ctx context.Context) (err error) {
+		conn, err = mngr.connect(ctx, opt)
+		return err
+	}, mngr.logRetry(ctx, opt))
 	if err != nil {
-		mngr.logger.Errorf("unable to connect to ftp server: %s", err.Error())
-		return nil, fmt.Errorf("unable to connect to ftp server in ftpmngr.getConnection: %w", err)
+		return nil, err
 	}
 
-	if err := conn.Login(opt.User, opt.Password); err != nil {
-		mngr.logger.Errorf("unable to login to ftp server: %s", err.Error())
-		return nil, fmt.Errorf("unable to login to ftp server in ftpmngr.getConnection: %w", err)
+	return conn, nil
+}
+
+func (mngr *ftpmngr) connect(ctx context.Context, opt *models.FTPConnectionOpt) (_ *pooledConn, err error) {
+	mngr.log(ctx).Debugw("connecting to ftp server", "addr", getURL(opt), "user", opt.User)
+
+	_, span := tracing.Start(ctx, "ftp.dial", serverAttrs(opt)...)
+	netConn, err := mngr.dial(ctx, opt)
+	if err != nil {
+		tracing.End(span, err)
+		mngr.log(ctx).Errorf("unable to connect to ftp server: %s", err.Error())
+		return nil, fmt.Errorf("failed ftpmngr.dial in ftpmngr.connect: %w", err)
 	}
 
-	return conn, nil
+	stop := interrupt(ctx, netConn)
+	defer func() {
+		if ctxErr := stop(); ctxErr != nil && err == nil {
+			err = fmt.Errorf("unable to connect to ftp server in ftpmngr.connect: %w", ctxErr)
+		}
+	}()
+
+	conn, err := ftp.Dial(getURL(opt), ftp.DialWithDialFunc(mngr.dialFunc(netConn)))
+	tracing.End(span, err)
+	if err != nil {
+		netConn.Close()
+		mngr.log(ctx).Errorf("unable to connect to ftp server: %s", err.Error())
+		return nil, fmt.Errorf("unable to connect to ftp server in ftpmngr.connect: %w", err)
+	}
+
+	_, span = tracing.Start(ctx, "ftp.login", attribute.String("ftp.user", opt.User))
+	if err = netConn.SetDeadline(mngr.loginDeadline(ctx)); err == nil {
+		err = conn.Login(opt.User, opt.Password)
+	}
+	tracing.End(span, err)
+	if err != nil {
+		_ = conn.Quit()
+		mngr.log(ctx).Errorf("unable to login to ftp server: %s", err.Error())
+		return nil, fmt.Errorf("unable to login to ftp server in ftpmngr.connect: %w", err)
+	}
+
+	if err = netConn.SetDeadline(time.Time{}); err != nil {
+		_ = conn.Quit()
+		return nil, fmt.Errorf("unable to reset deadline in ftpmngr.connect: %w", err)
+	}
+
+	return &pooledConn{ServerConn: conn, netConn: netConn}, nil
 }
 
-func (mngr *ftpmngr) CheckRemoteDir(remotepath string, opt *models.FTPConnectionOpt) error {
-	conn, err := mngr.getConnection(opt)
+func (mngr *ftpmngr) CheckRemoteDir(ctx context.Context, remotepath string, opt *models.FTPConnectionOpt) (err error) {
+	ctx, span := tracing.Start(ctx, "ftpmngr.CheckRemoteDir", append(serverAttrs(opt), attribute.String("ftp.path", remotepath))...)
+	defer func() { tracing.End(span, err) }()
+
+	conn, err := mngr.acquire(ctx, opt)
 	if err != nil {
-		mngr.logger.Errorf("unable to check remote dir: %s", err.Error())
+		mngr.log(ctx).Errorf("unable to check remote dir: %s", err.Error())
 		return fmt.Errorf("unable to connect to ftp server in ftpmngr.CheckRemoteDir: %w", err)
 	}
 
+	_, cwdSpan := tracing.Start(ctx, "ftp.cwd", attribute.String("ftp.path", remotepath))
 	err = conn.ChangeDir(remotepath)
+	tracing.End(cwdSpan, err)
+	mngr.release(opt, conn, err)
 	if err != nil {
-		mngr.logger.Errorf("unable to find remote dir: %s", err.Error())
+		mngr.log(ctx).Errorf("unable to find remote dir: %s", err.Error())
 		return errors.New("remote dir not found")
 	}
 
-	if err := conn.Quit(); err != nil {
-		mngr.logger.Errorf("Failed to close ftp connection: %s", err.Error())
+	return nil
+}
+
+func (mngr *ftpmngr) RemoveRemoteDir(ctx context.Context, remotepath string, opt *models.FTPConnectionOpt) (err error) {
+	ctx, span := tracing.Start(ctx, "ftpmngr.RemoveRemoteDir", append(serverAttrs(opt), attribute.String("ftp.path", remotepath))...)
+	defer func() { tracing.End(span, err) }()
+
+	conn, err := mngr.acquire(ctx, opt)
+	if err != nil {
+		mngr.log(ctx).Errorf("unable to remove remote dir: %s", err.Error())
+		return fmt.Errorf("unable to connect to ftp server in ftpmngr.RemoveRemoteDir: %w", err)
+	}
+
+	dir, err := conn.CurrentDir()
+	if err != nil {
+		mngr.release(opt, conn, err)
+		return fmt.Errorf("unable to get working dir in ftpmngr.RemoveRemoteDir: %w", err)
+	}
+
+	err = conn.RemoveDirRecur(remotepath)
+
+	// RemoveDirRecur changes into the dir and back to its parent, the
+	// connection goes back to the pool in the dir it was taken in
+	cwd, cwdErr := conn.CurrentDir()
+	if cwdErr == nil && cwd != dir {
+		cwdErr = conn.ChangeDir(dir)
+	}
+
+	if cwdErr != nil {
+		mngr.discard(opt, conn)
+	} else {
+		mngr.release(opt, conn, err)
+	}
+
+	if err != nil {
+		// changing into the dir comes first, a missing dir leaves the
+		// working dir as it was
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) && protoErr.Code == ftp.StatusFileUnavailable && cwd == dir {
+			mngr.log(ctx).Warnf("remote dir '%s' does not exist, nothing to remove", remotepath)
+			return nil
+		}
+
+		mngr.log(ctx).Errorf("unable to remove remote dir: %s", err.Error())
+		return fmt.Errorf("unable to remove remote dir in ftpmngr.RemoveRemoteDir: %w", err)
 	}
 
 	return nil
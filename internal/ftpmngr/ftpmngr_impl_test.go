@@ -0,0 +1,337 @@
+package ftpmngr
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr/ftptest"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestCheckConnection(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	mngr := NewFTPManager(DefaultOptions(), logger)
+
+	t.Run("success connection", func(t *testing.T) {
+		err := mngr.CheckConnection(context.Background(), server.Opt())
+		assert.Nil(t, err)
+	})
+
+	t.Run("invalid password", func(t *testing.T) {
+		opt := server.Opt()
+		opt.Password = "invalid"
+
+		err := mngr.CheckConnection(context.Background(), opt)
+		assert.Error(t, err)
+	})
+}
+
+func TestCheckRemoteDir(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	server.MkdirAll("/data/test")
+	mngr := NewFTPManager(DefaultOptions(), logger)
+
+	t.Run("existing dir", func(t *testing.T) {
+		err := mngr.CheckRemoteDir(context.Background(), "/data/test", server.Opt())
+		assert.Nil(t, err)
+	})
+
+	t.Run("not existing dir", func(t *testing.T) {
+		err := mngr.CheckRemoteDir(context.Background(), "/data/notExists", server.Opt())
+		assert.Error(t, err)
+	})
+}
+
+func TestRemoveRemoteDir(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	mngr := NewFTPManager(DefaultOptions(), logger)
+
+	t.Run("remove dir recursively", func(t *testing.T) {
+		server.WriteFile("/jobs/1/artifact.bin", []byte("data"))
+		server.WriteFile("/jobs/1/logs/build.log", []byte("log"))
+		server.WriteFile("/jobs/2/artifact.bin", []byte("data"))
+
+		err := mngr.RemoveRemoteDir(context.Background(), "/jobs/1", server.Opt())
+		require.Nil(t, err)
+
+		assert.False(t, server.Exists("/jobs/1"))
+		assert.False(t, server.Exists("/jobs/1/logs/build.log"))
+		assert.True(t, server.Exists("/jobs/2/artifact.bin"))
+
+		// the pooled connection is back in the dir it was taken in
+		conn, err := mngr.(*ftpmngr).acquire(context.Background(), server.Opt())
+		require.Nil(t, err)
+		dir, err := conn.CurrentDir()
+		mngr.(*ftpmngr).release(server.Opt(), conn, err)
+		require.Nil(t, err)
+		assert.Equal(t, "/", dir)
+	})
+
+	t.Run("remove not existing dir", func(t *testing.T) {
+		err := mngr.RemoveRemoteDir(context.Background(), "/notExists", server.Opt())
+		assert.Nil(t, err)
+	})
+
+	t.Run("failure inside the dir", func(t *testing.T) {
+		server.WriteFile("/jobs/4/artifact.bin", []byte("data"))
+		server.Fail("RMD", 1)
+
+		err := mngr.RemoveRemoteDir(context.Background(), "/jobs/4", server.Opt())
+		assert.Error(t, err)
+		assert.True(t, server.Exists("/jobs/4"))
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		server.MkdirAll("/jobs/3")
+		opt := server.Opt()
+		opt.Password = "invalid"
+
+		err := mngr.RemoveRemoteDir(context.Background(), "/jobs/3", opt)
+		assert.Error(t, err)
+		assert.True(t, server.Exists("/jobs/3"))
+	})
+}
+
+func TestUsage(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	t.Run("size walk without server extensions", func(t *testing.T) {
+		server, err := ftptest.NewServer("user", "password")
+		require.Nil(t, err)
+		defer server.Close()
+
+		server.WriteFile("/data/a.bin", make([]byte, 100))
+		server.WriteFile("/data/sub/b.bin", make([]byte, 50))
+		server.WriteFile("/other/c.bin", make([]byte, 1000))
+
+		mngr := NewFTPManager(DefaultOptions(), logger)
+
+		usage, err := mngr.Usage(context.Background(), "/data", server.Opt())
+		require.Nil(t, err)
+
+		assert.Equal(t, int64(150), usage.Used)
+		assert.Equal(t, int64(-1), usage.Available)
+		assert.Equal(t, int64(-1), usage.AccountUsed)
+		assert.Equal(t, int64(-1), usage.Quota)
+		assert.Equal(t, []string{models.UsageSourceWalk}, usage.Sources)
+		assert.False(t, usage.Truncated)
+	})
+
+	t.Run("server extensions", func(t *testing.T) {
+		server, err := ftptest.NewServer("user", "password")
+		require.Nil(t, err)
+		defer server.Close()
+
+		server.SetFeatures(append(ftptest.DefaultFeatures, "AVBL")...)
+		server.SetAvailable(4096)
+		server.SetQuota(8192)
+		server.WriteFile("/data/a.bin", make([]byte, 100))
+		server.WriteFile("/other/b.bin", make([]byte, 1000))
+
+		mngr := NewFTPManager(DefaultOptions(), logger)
+
+		usage, err := mngr.Usage(context.Background(), "/data", server.Opt())
+		require.Nil(t, err)
+
+		// the quota covers the account, used only the volume
+		assert.Equal(t, int64(100), usage.Used)
+		assert.Equal(t, int64(1100), usage.AccountUsed)
+		assert.Equal(t, int64(4096), usage.Available)
+		assert.Equal(t, int64(8192), usage.Quota)
+		assert.Equal(t, []string{models.UsageSourceAVBL, models.UsageSourceSiteQuota, models.UsageSourceWalk}, usage.Sources)
+
+		// the commands and the walk share a pooled connection
+		assert.Equal(t, 1, server.Accepted())
+	})
+
+	t.Run("failures are not cached", func(t *testing.T) {
+		server, err := ftptest.NewServer("user", "password")
+		require.Nil(t, err)
+		defer server.Close()
+
+		server.WriteFile("/data/a.bin", make([]byte, 100))
+		server.Fail("MLSD", 1)
+
+		mngr := NewFTPManager(DefaultOptions(), logger)
+
+		_, err = mngr.Usage(context.Background(), "/data", server.Opt())
+		require.NotNil(t, err)
+
+		usage, err := mngr.Usage(context.Background(), "/data", server.Opt())
+		require.Nil(t, err)
+		assert.Equal(t, int64(100), usage.Used)
+	})
+
+	t.Run("cached usage", func(t *testing.T) {
+		server, err := ftptest.NewServer("user", "password")
+		require.Nil(t, err)
+		defer server.Close()
+
+		server.WriteFile("/data/a.bin", make([]byte, 100))
+
+		mngr := NewFTPManager(DefaultOptions(), logger)
+
+		_, err = mngr.Usage(context.Background(), "/data", server.Opt())
+		require.Nil(t, err)
+
+		server.WriteFile("/data/b.bin", make([]byte, 100))
+
+		usage, err := mngr.Usage(context.Background(), "/data", server.Opt())
+		require.Nil(t, err)
+		assert.Equal(t, int64(100), usage.Used)
+
+		expired := NewFTPManager(DefaultOptions(), logger)
+		expired.(*ftpmngr).usageTTL = 0
+
+		_, err = expired.Usage(context.Background(), "/data", server.Opt())
+		require.Nil(t, err)
+
+		server.WriteFile("/data/c.bin", make([]byte, 100))
+
+		usage, err = expired.Usage(context.Background(), "/data", server.Opt())
+		require.Nil(t, err)
+		assert.Equal(t, int64(300), usage.Used)
+	})
+}
+
+func TestConnectionTimeout(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	// the listener accepts connections but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer listener.Close()
+
+	go func() {
+		conns := make([]net.Conn, 0)
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	opt := &models.FTPConnectionOpt{Host: "127.0.0.1", Port: addr.Port, User: "user", Password: "password"}
+
+	t.Run("dial timeout", func(t *testing.T) {
+		mngr := NewFTPManager(&Options{DialTimeout: 100 * time.Millisecond, LoginTimeout: time.Second, PoolSize: 1}, logger)
+
+		begin := time.Now()
+		err := mngr.CheckConnection(context.Background(), opt)
+		assert.Error(t, err)
+		assert.Less(t, time.Since(begin), time.Second)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		mngr := NewFTPManager(DefaultOptions(), logger)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		begin := time.Now()
+		_, err := mngr.Usage(ctx, "/", opt)
+		assert.Error(t, err)
+		assert.Less(t, time.Since(begin), time.Second)
+	})
+}
+
+func TestRetry(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	opts := DefaultOptions()
+	opts.Retry = models.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, Codes: []int{421}}
+	mngr := NewFTPManager(opts, logger)
+
+	tests := []struct {
+		name     string
+		rejects  int
+		retry    *models.RetryPolicy
+		accepted int
+		err      bool
+	}{
+		{name: "no failures", rejects: 0, accepted: 1},
+		{name: "transient failures", rejects: 2, accepted: 3},
+		{name: "attempts used up", rejects: 5, accepted: 3, err: true},
+		{name: "volume without retries", rejects: 1, retry: &models.RetryPolicy{MaxAttempts: 1}, accepted: 1, err: true},
+		{name: "volume with more attempts", rejects: 4, retry: &models.RetryPolicy{MaxAttempts: 5}, accepted: 5},
+		{name: "code not retried", rejects: 1, retry: &models.RetryPolicy{Codes: []int{450}}, accepted: 1, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, err := ftptest.NewServer("user", "password")
+			require.Nil(t, err)
+			defer server.Close()
+
+			server.Reject(test.rejects)
+			opt := server.Opt()
+			opt.Retry = test.retry
+
+			err = mngr.CheckConnection(context.Background(), opt)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, test.accepted, server.Accepted())
+		})
+	}
+
+	t.Run("raw connection", func(t *testing.T) {
+		server, err := ftptest.NewServer("user", "password")
+		require.Nil(t, err)
+		defer server.Close()
+
+		server.Reject(2)
+
+		_, err = mngr.Usage(context.Background(), "/", server.Opt())
+		assert.Nil(t, err)
+	})
+}
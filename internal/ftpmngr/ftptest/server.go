@@ -0,0 +1,909 @@
+// Package ftptest provides an in-memory FTP server for use in tests.
+package ftptest
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/textproto"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+// DefaultFeatures is the FEAT reply of a freshly created Server.
+var DefaultFeatures = []string{"EPSV", "MDTM", "MLST type*;size*;modify*;", "REST STREAM", "SIZE", "UTF8"}
+
+type entry struct {
+	dir   bool
+	data  []byte
+	mtime time.Time
+}
+
+// Server is an FTP server listening on the loopback interface and serving
+// an in-memory file tree. Only the subset of commands used by the driver is
+// implemented.
+type Server struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+
+	listener net.Listener
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	features  []string
+	location  *time.Location
+	available int64
+	quota     int64
+	rejects   int
+	failures  map[string]int
+	cuts      map[string]int64
+	corrupts  map[string]int
+	accepted  int
+	wg        sync.WaitGroup
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// NewServer starts a Server accepting the given credentials.
+func NewServer(user, password string) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen in ftptest.NewServer: %w", err)
+	}
+
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &Server{
+		Host:      addr.IP.String(),
+		Port:      addr.Port,
+		User:      user,
+		Password:  password,
+		listener:  listener,
+		entries:   map[string]*entry{"/": {dir: true, mtime: time.Now()}},
+		features:  DefaultFeatures,
+		location:  time.UTC,
+		available: -1,
+		quota:     -1,
+		failures:  make(map[string]int),
+		cuts:      make(map[string]int64),
+		corrupts:  make(map[string]int),
+		conns:     make(map[net.Conn]struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// Opt returns connection options pointing at the server.
+func (s *Server) Opt() *models.FTPConnectionOpt {
+	return &models.FTPConnectionOpt{
+		Host:     s.Host,
+		Port:     s.Port,
+		User:     s.User,
+		Password: s.Password,
+	}
+}
+
+// Close stops the server and closes all client connections.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// SetFeatures replaces the FEAT reply of the server. REST is refused unless
+// "REST STREAM" is listed.
+func (s *Server) SetFeatures(features ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.features = features
+}
+
+// SetLocation sets the time zone of the times in LIST replies, UTC by
+// default. MLSD and MDTM are always in UTC.
+func (s *Server) SetLocation(loc *time.Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.location = loc
+}
+
+// SetAvailable sets the free space reported by AVBL. A negative value
+// disables the command.
+func (s *Server) SetAvailable(available int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.available = available
+}
+
+// Reject makes the server greet the next n connections with 421 "too many
+// connections" and close them, like a server at its connection limit.
+func (s *Server) Reject(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejects = n
+}
+
+// Fail makes the server answer the next n cmd commands with 426 "transfer
+// aborted", like a data connection dropped by a flaky link.
+func (s *Server) Fail(cmd string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[strings.ToUpper(cmd)] = n
+}
+
+// Interrupt makes the server close the data connection of the next cmd
+// transfer (RETR, STOR or APPE) after n bytes and answer 426, keeping the
+// bytes stored so far. Shorter transfers complete.
+func (s *Server) Interrupt(cmd string, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cuts[strings.ToUpper(cmd)] = n
+}
+
+// Corrupt makes the server alter one byte of the data of the next n cmd
+// transfers (RETR, STOR or APPE), like a corruption which keeps the size.
+func (s *Server) Corrupt(cmd string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.corrupts[strings.ToUpper(cmd)] = n
+}
+
+// corrupt returns data with one byte altered when the cmd transfer is to be
+// corrupted.
+func (s *Server) corrupt(cmd string, data []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.corrupts[cmd] == 0 || len(data) == 0 {
+		return data
+	}
+	s.corrupts[cmd]--
+
+	res := append([]byte(nil), data...)
+	res[len(res)/2] ^= 0xff
+
+	return res
+}
+
+// supports reports whether the FEAT reply of the server lists feature.
+func (s *Server) supports(feature string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.features {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cut returns the byte count after which the next cmd transfer is
+// interrupted, or -1.
+func (s *Server) cut(cmd string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.cuts[cmd]
+	if !ok {
+		return -1
+	}
+	delete(s.cuts, cmd)
+
+	return n
+}
+
+// DropConnections closes the open client connections, like a server
+// restart, while the server keeps accepting new ones.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Accepted returns the number of connections accepted so far, including the
+// rejected ones.
+func (s *Server) Accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+// SetQuota sets the upload limit reported by SITE QUOTA. A negative value
+// disables the command.
+func (s *Server) SetQuota(quota int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quota = quota
+}
+
+// MkdirAll creates the directory p with all missing parents.
+func (s *Server) MkdirAll(p string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mkdirAll(path.Clean("/" + p))
+}
+
+// WriteFile creates or replaces the file p, creating missing parents.
+func (s *Server) WriteFile(p string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p = path.Clean("/" + p)
+	s.mkdirAll(path.Dir(p))
+	s.entries[p] = &entry{data: append([]byte(nil), data...), mtime: time.Now()}
+}
+
+// SetModTime sets the modification time of the file or dir p.
+func (s *Server) SetModTime(p string, mtime time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[path.Clean("/"+p)]; ok {
+		e.mtime = mtime
+	}
+}
+
+// ReadFile returns the content of the file p.
+func (s *Server) ReadFile(p string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[path.Clean("/"+p)]
+	if !ok || e.dir {
+		return nil, false
+	}
+	return append([]byte(nil), e.data...), true
+}
+
+// Exists reports whether a file or directory exists at p.
+func (s *Server) Exists(p string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.entries[path.Clean("/"+p)]
+	return ok
+}
+
+func (s *Server) mkdirAll(p string) {
+	for dir := p; ; dir = path.Dir(dir) {
+		if _, ok := s.entries[dir]; !ok {
+			s.entries[dir] = &entry{dir: true, mtime: time.Now()}
+		}
+		if dir == "/" {
+			return
+		}
+	}
+}
+
+func (s *Server) children(dir string) []string {
+	names := make([]string, 0)
+	for p := range s.entries {
+		if p != "/" && path.Dir(p) == dir {
+			names = append(names, path.Base(p))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.accepted++
+		reject := s.rejects > 0
+		if reject {
+			s.rejects--
+		}
+		s.mu.Unlock()
+
+		if reject {
+			_ = textproto.NewConn(conn).PrintfLine("421 too many connections")
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			newSession(s, conn).run()
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+type session struct {
+	server     *Server
+	conn       *textproto.Conn
+	cwd        string
+	user       string
+	loggedIn   bool
+	restOffset int64
+	renameFrom string
+	// hash is the algorithm of HASH chosen with OPTS HASH.
+	hash    string
+	passive net.Listener
+}
+
+func newSession(s *Server, conn net.Conn) *session {
+	return &session{server: s, conn: textproto.NewConn(conn), cwd: "/", hash: "SHA-256"}
+}
+
+func (ss *session) reply(code int, format string, args ...interface{}) {
+	_ = ss.conn.PrintfLine("%d %s", code, fmt.Sprintf(format, args...))
+}
+
+func (ss *session) abs(p string) string {
+	if p == "" {
+		return ss.cwd
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = ss.cwd + "/" + p
+	}
+	return path.Clean(p)
+}
+
+func (ss *session) run() {
+	defer func() {
+		if ss.passive != nil {
+			ss.passive.Close()
+		}
+	}()
+
+	ss.reply(220, "ftptest ready")
+	for {
+		line, err := ss.conn.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd, arg, _ := strings.Cut(line, " ")
+		cmd = strings.ToUpper(cmd)
+
+		if !ss.loggedIn && cmd != "USER" && cmd != "PASS" && cmd != "QUIT" && cmd != "FEAT" {
+			ss.reply(530, "not logged in")
+			continue
+		}
+
+		if quit := ss.handle(cmd, arg); quit {
+			return
+		}
+	}
+}
+
+func (ss *session) handle(cmd, arg string) bool {
+	s := ss.server
+
+	s.mu.Lock()
+	fail := s.failures[cmd] > 0
+	if fail {
+		s.failures[cmd]--
+	}
+	s.mu.Unlock()
+
+	if fail {
+		ss.reply(426, "transfer aborted")
+		return false
+	}
+
+	switch cmd {
+	case "USER":
+		ss.user = arg
+		ss.reply(331, "password required")
+	case "PASS":
+		if ss.user != s.User || arg != s.Password {
+			ss.reply(530, "login incorrect")
+			return false
+		}
+		ss.loggedIn = true
+		ss.reply(230, "logged in")
+	case "QUIT":
+		ss.reply(221, "bye")
+		return true
+	case "FEAT":
+		s.mu.Lock()
+		features := s.features
+		s.mu.Unlock()
+		lines := []string{"211-Features:"}
+		for _, f := range features {
+			lines = append(lines, " "+f)
+		}
+		lines = append(lines, "211 End")
+		_ = ss.conn.PrintfLine("%s", strings.Join(lines, "\r\n"))
+	case "OPTS":
+		option, value, _ := strings.Cut(arg, " ")
+		if !strings.EqualFold(option, "HASH") {
+			ss.reply(200, "ok")
+			return false
+		}
+		algorithm := strings.ToUpper(value)
+		if _, ok := hashes[algorithm]; !ok {
+			ss.reply(501, "unknown algorithm")
+			return false
+		}
+		ss.hash = algorithm
+		ss.reply(200, "%s", algorithm)
+	case "TYPE", "NOOP":
+		ss.reply(200, "ok")
+	case "PWD":
+		ss.reply(257, "%q is the current directory", ss.cwd)
+	case "CWD":
+		p := ss.abs(arg)
+		s.mu.Lock()
+		e, ok := s.entries[p]
+		s.mu.Unlock()
+		if !ok || !e.dir {
+			ss.reply(550, "no such directory")
+			return false
+		}
+		ss.cwd = p
+		ss.reply(250, "directory changed")
+	case "CDUP":
+		ss.cwd = path.Dir(ss.cwd)
+		ss.reply(250, "directory changed")
+	case "EPSV":
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			ss.reply(425, "can't open data connection")
+			return false
+		}
+		ss.setPassive(listener)
+		ss.reply(229, "Entering Extended Passive Mode (|||%d|)", listener.Addr().(*net.TCPAddr).Port)
+	case "PASV":
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			ss.reply(425, "can't open data connection")
+			return false
+		}
+		ss.setPassive(listener)
+		port := listener.Addr().(*net.TCPAddr).Port
+		ss.reply(227, "Entering Passive Mode (127,0,0,1,%d,%d)", port/256, port%256)
+	case "REST":
+		if !s.supports("REST STREAM") {
+			ss.reply(502, "command not implemented")
+			return false
+		}
+		offset, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || offset < 0 {
+			ss.reply(501, "invalid offset")
+			return false
+		}
+		ss.restOffset = offset
+		ss.reply(350, "restarting at %d", offset)
+	case "LIST", "MLSD", "NLST":
+		ss.list(cmd, arg)
+	case "RETR":
+		ss.retr(arg)
+	case "STOR", "APPE":
+		ss.stor(cmd, arg)
+	case "HASH", "XSHA256", "XMD5", "XCRC":
+		ss.checksum(cmd, arg)
+	case "SIZE":
+		p := ss.abs(arg)
+		s.mu.Lock()
+		e, ok := s.entries[p]
+		s.mu.Unlock()
+		if !ok || e.dir {
+			ss.reply(550, "no such file")
+			return false
+		}
+		ss.reply(213, "%d", len(e.data))
+	case "MDTM":
+		p := ss.abs(arg)
+		s.mu.Lock()
+		e, ok := s.entries[p]
+		s.mu.Unlock()
+		if !ok {
+			ss.reply(550, "no such file")
+			return false
+		}
+		ss.reply(213, "%s", e.mtime.UTC().Format("20060102150405"))
+	case "MKD":
+		p := ss.abs(arg)
+		s.mu.Lock()
+		_, exists := s.entries[p]
+		parent, parentOk := s.entries[path.Dir(p)]
+		if !exists && parentOk && parent.dir {
+			s.entries[p] = &entry{dir: true, mtime: time.Now()}
+		}
+		s.mu.Unlock()
+		if exists || !parentOk || !parent.dir {
+			ss.reply(550, "can't create directory")
+			return false
+		}
+		ss.reply(257, "%q created", p)
+	case "RMD":
+		p := ss.abs(arg)
+		s.mu.Lock()
+		e, ok := s.entries[p]
+		empty := ok && len(s.children(p)) == 0
+		if ok && e.dir && empty && p != "/" {
+			delete(s.entries, p)
+		}
+		s.mu.Unlock()
+		if !ok || !e.dir || !empty || p == "/" {
+			ss.reply(550, "can't remove directory")
+			return false
+		}
+		ss.reply(250, "directory removed")
+	case "DELE":
+		p := ss.abs(arg)
+		s.mu.Lock()
+		e, ok := s.entries[p]
+		if ok && !e.dir {
+			delete(s.entries, p)
+		}
+		s.mu.Unlock()
+		if !ok || e.dir {
+			ss.reply(550, "no such file")
+			return false
+		}
+		ss.reply(250, "file deleted")
+	case "RNFR":
+		p := ss.abs(arg)
+		if !s.Exists(p) {
+			ss.reply(550, "no such file")
+			return false
+		}
+		ss.renameFrom = p
+		ss.reply(350, "ready for RNTO")
+	case "RNTO":
+		ss.rename(ss.abs(arg))
+	case "AVBL":
+		s.mu.Lock()
+		available := s.available
+		s.mu.Unlock()
+		if available < 0 {
+			ss.reply(502, "command not implemented")
+			return false
+		}
+		ss.reply(213, "%d", available)
+	case "SITE":
+		ss.site(arg)
+	default:
+		ss.reply(502, "command not implemented")
+	}
+
+	return false
+}
+
+func (ss *session) site(arg string) {
+	s := ss.server
+
+	if !strings.EqualFold(arg, "QUOTA") {
+		ss.reply(500, "unknown SITE command")
+		return
+	}
+
+	s.mu.Lock()
+	quota := s.quota
+	var used int
+	for _, e := range s.entries {
+		used += len(e.data)
+	}
+	s.mu.Unlock()
+
+	if quota < 0 {
+		ss.reply(500, "unknown SITE command")
+		return
+	}
+
+	lines := []string{
+		"200-The current quota for this session are [current/limit]:",
+		"200-Name: " + ss.user,
+		"200-Quota Type: User",
+		fmt.Sprintf("200-  Uploaded bytes:\t%d.00/%d.00", used, quota),
+		"200-  Downloaded bytes:\tunlimited",
+		"200 Please contact the administrator if these entries are inaccurate",
+	}
+	_ = ss.conn.PrintfLine("%s", strings.Join(lines, "\r\n"))
+}
+
+func (ss *session) setPassive(listener net.Listener) {
+	if ss.passive != nil {
+		ss.passive.Close()
+	}
+	ss.passive = listener
+}
+
+func (ss *session) openData() (net.Conn, error) {
+	if ss.passive == nil {
+		return nil, fmt.Errorf("no passive listener")
+	}
+	defer func() {
+		ss.passive.Close()
+		ss.passive = nil
+	}()
+
+	return ss.passive.Accept()
+}
+
+func (ss *session) list(cmd, arg string) {
+	s := ss.server
+
+	if strings.HasPrefix(arg, "-") {
+		_, arg, _ = strings.Cut(arg, " ")
+	}
+	p := ss.abs(arg)
+
+	s.mu.Lock()
+	e, ok := s.entries[p]
+	lines := make([]string, 0)
+	if ok && e.dir {
+		for _, name := range s.children(p) {
+			lines = append(lines, formatEntry(cmd, name, s.entries[path.Join(p, name)], s.location))
+		}
+	} else if ok {
+		lines = append(lines, formatEntry(cmd, path.Base(p), e, s.location))
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		ss.reply(550, "no such file or directory")
+		return
+	}
+
+	ss.reply(150, "opening data connection")
+	data, err := ss.openData()
+	if err != nil {
+		ss.reply(425, "can't open data connection")
+		return
+	}
+
+	w := bufio.NewWriter(data)
+	for _, line := range lines {
+		_, _ = w.WriteString(line + "\r\n")
+	}
+	_ = w.Flush()
+	data.Close()
+
+	ss.reply(226, "transfer complete")
+}
+
+// formatEntry formats e like ls does in LIST replies, with the time of day
+// for the entries of the last six months.
+func formatEntry(cmd, name string, e *entry, loc *time.Location) string {
+	switch cmd {
+	case "NLST":
+		return name
+	case "MLSD":
+		kind := "file"
+		if e.dir {
+			kind = "dir"
+		}
+		return fmt.Sprintf("type=%s;size=%d;modify=%s; %s", kind, len(e.data), e.mtime.UTC().Format("20060102150405"), name)
+	default:
+		mode := "-rw-r--r--"
+		if e.dir {
+			mode = "drwxr-xr-x"
+		}
+		layout := "Jan _2 15:04"
+		if time.Since(e.mtime) > 180*24*time.Hour {
+			layout = "Jan _2  2006"
+		}
+		return fmt.Sprintf("%s 1 ftp ftp %d %s %s", mode, len(e.data), e.mtime.In(loc).Format(layout), name)
+	}
+}
+
+// hashes are the algorithms of HASH and their own commands.
+var hashes = map[string]func() hash.Hash{
+	"SHA-256": sha256.New,
+	"MD5":     md5.New,
+	"CRC32":   func() hash.Hash { return crc32.NewIEEE() },
+}
+
+var hashCommands = map[string]string{"XSHA256": "SHA-256", "XMD5": "MD5", "XCRC": "CRC32"}
+
+func (ss *session) checksum(cmd, arg string) {
+	s := ss.server
+	p := ss.abs(arg)
+
+	s.mu.Lock()
+	e, ok := s.entries[p]
+	var content []byte
+	if ok && !e.dir {
+		content = e.data
+	}
+	s.mu.Unlock()
+
+	if !ok || e.dir {
+		ss.reply(550, "no such file")
+		return
+	}
+
+	algorithm := ss.hash
+	if cmd != "HASH" {
+		algorithm = hashCommands[cmd]
+	}
+
+	h := hashes[algorithm]()
+	h.Write(content)
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	if cmd != "HASH" {
+		ss.reply(250, "%s", strings.ToUpper(sum))
+		return
+	}
+
+	ss.reply(213, "%s 0-%d %s %s", algorithm, len(content), sum, arg)
+}
+
+func (ss *session) retr(arg string) {
+	s := ss.server
+	p := ss.abs(arg)
+	offset := ss.restOffset
+	ss.restOffset = 0
+
+	s.mu.Lock()
+	e, ok := s.entries[p]
+	var content []byte
+	if ok && !e.dir {
+		content = e.data
+	}
+	s.mu.Unlock()
+
+	if !ok || e.dir {
+		ss.reply(550, "no such file")
+		return
+	}
+
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+
+	ss.reply(150, "opening data connection")
+	data, err := ss.openData()
+	if err != nil {
+		ss.reply(425, "can't open data connection")
+		return
+	}
+
+	content = s.corrupt("RETR", content[offset:])
+	cut := s.cut("RETR")
+	interrupted := cut >= 0 && cut < int64(len(content))
+	if interrupted {
+		content = content[:cut]
+	}
+
+	_, err = data.Write(content)
+	data.Close()
+	if err != nil || interrupted {
+		ss.reply(426, "transfer aborted")
+		return
+	}
+
+	ss.reply(226, "transfer complete")
+}
+
+func (ss *session) stor(cmd, arg string) {
+	s := ss.server
+	p := ss.abs(arg)
+	offset := ss.restOffset
+	ss.restOffset = 0
+
+	s.mu.Lock()
+	parent, parentOk := s.entries[path.Dir(p)]
+	existing, exists := s.entries[p]
+	s.mu.Unlock()
+
+	if !parentOk || !parent.dir || (exists && existing.dir) {
+		ss.reply(553, "can't store file")
+		return
+	}
+
+	ss.reply(150, "opening data connection")
+	data, err := ss.openData()
+	if err != nil {
+		ss.reply(425, "can't open data connection")
+		return
+	}
+
+	var reader io.Reader = data
+	cut := s.cut(cmd)
+	if cut >= 0 {
+		reader = io.LimitReader(data, cut)
+	}
+
+	content, err := io.ReadAll(reader)
+	data.Close()
+	content = s.corrupt(cmd, content)
+	if err != nil {
+		ss.reply(426, "transfer aborted")
+		return
+	}
+
+	s.mu.Lock()
+	var prefix []byte
+	if e, ok := s.entries[p]; ok && !e.dir {
+		switch {
+		case cmd == "APPE":
+			prefix = e.data
+		case offset > 0:
+			if offset > int64(len(e.data)) {
+				offset = int64(len(e.data))
+			}
+			prefix = e.data[:offset]
+		}
+	}
+	s.entries[p] = &entry{data: append(append([]byte(nil), prefix...), content...), mtime: time.Now()}
+	s.mu.Unlock()
+
+	if cut >= 0 && int64(len(content)) == cut {
+		ss.reply(426, "transfer aborted")
+		return
+	}
+
+	ss.reply(226, "transfer complete")
+}
+
+func (ss *session) rename(to string) {
+	s := ss.server
+	from := ss.renameFrom
+	ss.renameFrom = ""
+
+	if from == "" {
+		ss.reply(503, "RNFR required first")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[path.Dir(to)]; !ok {
+		ss.reply(553, "can't rename")
+		return
+	}
+
+	moved := make(map[string]*entry)
+	for p, e := range s.entries {
+		if p == from || strings.HasPrefix(p, from+"/") {
+			moved[to+strings.TrimPrefix(p, from)] = e
+			delete(s.entries, p)
+		}
+	}
+	for p, e := range moved {
+		s.entries[p] = e
+	}
+
+	ss.reply(250, "renamed")
+}
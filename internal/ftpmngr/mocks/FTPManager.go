@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	mock "github.com/stretchr/testify/mock"
 	models "github.com/t1d333/docker-volume-ftp-driver/internal/models"
 )
@@ -12,13 +14,53 @@ type FTPManager struct {
 	mock.Mock
 }
 
-// CheckConnection provides a mock function with given fields: opt
-func (_m *FTPManager) CheckConnection(opt *models.FTPConnectionOpt) error {
-	ret := _m.Called(opt)
+// Capabilities provides a mock function with given fields: ctx, opt
+func (_m *FTPManager) Capabilities(ctx context.Context, opt *models.FTPConnectionOpt) (*models.ServerCapabilities, error) {
+	ret := _m.Called(ctx, opt)
+
+	var r0 *models.ServerCapabilities
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.FTPConnectionOpt) (*models.ServerCapabilities, error)); ok {
+		return rf(ctx, opt)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *models.FTPConnectionOpt) *models.ServerCapabilities); ok {
+		r0 = rf(ctx, opt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ServerCapabilities)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *models.FTPConnectionOpt) error); ok {
+		r1 = rf(ctx, opt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CheckConnection provides a mock function with given fields: ctx, opt
+func (_m *FTPManager) CheckConnection(ctx context.Context, opt *models.FTPConnectionOpt) error {
+	ret := _m.Called(ctx, opt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.FTPConnectionOpt) error); ok {
+		r0 = rf(ctx, opt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CheckRemoteDir provides a mock function with given fields: ctx, remotepath, opt
+func (_m *FTPManager) CheckRemoteDir(ctx context.Context, remotepath string, opt *models.FTPConnectionOpt) error {
+	ret := _m.Called(ctx, remotepath, opt)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*models.FTPConnectionOpt) error); ok {
-		r0 = rf(opt)
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.FTPConnectionOpt) error); ok {
+		r0 = rf(ctx, remotepath, opt)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -26,13 +68,39 @@ func (_m *FTPManager) CheckConnection(opt *models.FTPConnectionOpt) error {
 	return r0
 }
 
-// CheckRemoteDir provides a mock function with given fields: remotepath, opt
-func (_m *FTPManager) CheckRemoteDir(remotepath string, opt *models.FTPConnectionOpt) error {
-	ret := _m.Called(remotepath, opt)
+// Download provides a mock function with given fields: ctx, remotepath, dir, opt
+func (_m *FTPManager) Download(ctx context.Context, remotepath string, dir string, opt *models.FTPConnectionOpt) (models.StageSnapshot, error) {
+	ret := _m.Called(ctx, remotepath, dir, opt)
+
+	var r0 models.StageSnapshot
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *models.FTPConnectionOpt) (models.StageSnapshot, error)); ok {
+		return rf(ctx, remotepath, dir, opt)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *models.FTPConnectionOpt) models.StageSnapshot); ok {
+		r0 = rf(ctx, remotepath, dir, opt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(models.StageSnapshot)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, *models.FTPConnectionOpt) error); ok {
+		r1 = rf(ctx, remotepath, dir, opt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RemoveRemoteDir provides a mock function with given fields: ctx, remotepath, opt
+func (_m *FTPManager) RemoveRemoteDir(ctx context.Context, remotepath string, opt *models.FTPConnectionOpt) error {
+	ret := _m.Called(ctx, remotepath, opt)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, *models.FTPConnectionOpt) error); ok {
-		r0 = rf(remotepath, opt)
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.FTPConnectionOpt) error); ok {
+		r0 = rf(ctx, remotepath, opt)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -40,6 +108,72 @@ func (_m *FTPManager) CheckRemoteDir(remotepath string, opt *models.FTPConnectio
 	return r0
 }
 
+// Sync provides a mock function with given fields: ctx, remotepath, dir, previous, opt
+func (_m *FTPManager) Sync(ctx context.Context, remotepath string, dir string, previous models.StageSnapshot, opt *models.FTPConnectionOpt) (models.StageSnapshot, error) {
+	ret := _m.Called(ctx, remotepath, dir, previous, opt)
+
+	var r0 models.StageSnapshot
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, models.StageSnapshot, *models.FTPConnectionOpt) (models.StageSnapshot, error)); ok {
+		return rf(ctx, remotepath, dir, previous, opt)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, models.StageSnapshot, *models.FTPConnectionOpt) models.StageSnapshot); ok {
+		r0 = rf(ctx, remotepath, dir, previous, opt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(models.StageSnapshot)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, models.StageSnapshot, *models.FTPConnectionOpt) error); ok {
+		r1 = rf(ctx, remotepath, dir, previous, opt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Upload provides a mock function with given fields: ctx, dir, remotepath, snapshot, partial, opt
+func (_m *FTPManager) Upload(ctx context.Context, dir string, remotepath string, snapshot models.StageSnapshot, partial string, opt *models.FTPConnectionOpt) error {
+	ret := _m.Called(ctx, dir, remotepath, snapshot, partial, opt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, models.StageSnapshot, string, *models.FTPConnectionOpt) error); ok {
+		r0 = rf(ctx, dir, remotepath, snapshot, partial, opt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Usage provides a mock function with given fields: ctx, remotepath, opt
+func (_m *FTPManager) Usage(ctx context.Context, remotepath string, opt *models.FTPConnectionOpt) (*models.VolumeUsage, error) {
+	ret := _m.Called(ctx, remotepath, opt)
+
+	var r0 *models.VolumeUsage
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.FTPConnectionOpt) (*models.VolumeUsage, error)); ok {
+		return rf(ctx, remotepath, opt)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.FTPConnectionOpt) *models.VolumeUsage); ok {
+		r0 = rf(ctx, remotepath, opt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.VolumeUsage)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, *models.FTPConnectionOpt) error); ok {
+		r1 = rf(ctx, remotepath, opt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewFTPManager creates a new instance of FTPManager. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewFTPManager(t interface {
@@ -0,0 +1,103 @@
+package ftpmngr
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/hostlimit"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/retry"
+)
+
+// Environment variables read by OptionsFromEnv.
+const (
+	EnvDialTimeout     = "FTP_DIAL_TIMEOUT"
+	EnvLoginTimeout    = "FTP_LOGIN_TIMEOUT"
+	EnvPoolSize        = "FTP_POOL_SIZE"
+	EnvPoolIdleTimeout = "FTP_POOL_IDLE_TIMEOUT"
+	EnvPoolKeepAlive   = "FTP_POOL_KEEPALIVE"
+	EnvPoolWaitTimeout = "FTP_POOL_WAIT_TIMEOUT"
+)
+
+const (
+	DefaultDialTimeout     = 10 * time.Second
+	DefaultLoginTimeout    = 10 * time.Second
+	DefaultPoolSize        = 4
+	DefaultPoolIdleTimeout = time.Minute
+	DefaultPoolKeepAlive   = 20 * time.Second
+	DefaultPoolWaitTimeout = 10 * time.Second
+)
+
+// Options configures the ftp manager. DialTimeout bounds connecting to the
+// server and reading its greeting, LoginTimeout bounds the login. Retry is
+// the driver-wide retry policy of establishing connections.
+//
+// Connections are pooled per endpoint: at most PoolSize are open at a time,
+// idle ones get a NOOP every PoolKeepAlive and are closed after
+// PoolIdleTimeout. A request waits up to PoolWaitTimeout for a connection
+// when all are busy.
+type Options struct {
+	DialTimeout     time.Duration
+	LoginTimeout    time.Duration
+	Retry           models.RetryPolicy
+	PoolSize        int
+	PoolIdleTimeout time.Duration
+	PoolKeepAlive   time.Duration
+	PoolWaitTimeout time.Duration
+	// Limiter caps the sessions per ftp server, shared with the mounts.
+	Limiter *hostlimit.Limiter
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		DialTimeout:     DefaultDialTimeout,
+		LoginTimeout:    DefaultLoginTimeout,
+		Retry:           retry.DefaultPolicy(),
+		PoolSize:        DefaultPoolSize,
+		PoolIdleTimeout: DefaultPoolIdleTimeout,
+		PoolKeepAlive:   DefaultPoolKeepAlive,
+		PoolWaitTimeout: DefaultPoolWaitTimeout,
+	}
+}
+
+// OptionsFromEnv reads the ftp manager options with getenv, unset variables
+// keep their defaults.
+func OptionsFromEnv(getenv func(string) string) (*Options, error) {
+	opts := DefaultOptions()
+
+	for key, dst := range map[string]*time.Duration{
+		EnvDialTimeout:     &opts.DialTimeout,
+		EnvLoginTimeout:    &opts.LoginTimeout,
+		EnvPoolIdleTimeout: &opts.PoolIdleTimeout,
+		EnvPoolKeepAlive:   &opts.PoolKeepAlive,
+		EnvPoolWaitTimeout: &opts.PoolWaitTimeout,
+	} {
+		value := getenv(key)
+		if value == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid %s value '%s' in ftpmngr.OptionsFromEnv", key, value)
+		}
+		*dst = d
+	}
+
+	if value := getenv(EnvPoolSize); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid %s value '%s' in ftpmngr.OptionsFromEnv", EnvPoolSize, value)
+		}
+		opts.PoolSize = size
+	}
+
+	policy, err := retry.PolicyFromEnv(getenv)
+	if err != nil {
+		return nil, fmt.Errorf("failed retry.PolicyFromEnv in ftpmngr.OptionsFromEnv: %w", err)
+	}
+	opts.Retry = policy
+
+	return opts, nil
+}
@@ -0,0 +1,103 @@
+package ftpmngr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/retry"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected *Options
+		err      bool
+	}{
+		{
+			name:     "defaults",
+			env:      map[string]string{},
+			expected: DefaultOptions(),
+		},
+		{
+			name: "timeouts",
+			env:  map[string]string{EnvDialTimeout: "3s", EnvLoginTimeout: "500ms"},
+			expected: &Options{
+				DialTimeout:     3 * time.Second,
+				LoginTimeout:    500 * time.Millisecond,
+				Retry:           retry.DefaultPolicy(),
+				PoolSize:        DefaultPoolSize,
+				PoolIdleTimeout: DefaultPoolIdleTimeout,
+				PoolKeepAlive:   DefaultPoolKeepAlive,
+				PoolWaitTimeout: DefaultPoolWaitTimeout,
+			},
+		},
+		{
+			name: "pool",
+			env:  map[string]string{EnvPoolSize: "8", EnvPoolIdleTimeout: "5m", EnvPoolKeepAlive: "1m", EnvPoolWaitTimeout: "30s"},
+			expected: &Options{
+				DialTimeout:     DefaultDialTimeout,
+				LoginTimeout:    DefaultLoginTimeout,
+				Retry:           retry.DefaultPolicy(),
+				PoolSize:        8,
+				PoolIdleTimeout: 5 * time.Minute,
+				PoolKeepAlive:   time.Minute,
+				PoolWaitTimeout: 30 * time.Second,
+			},
+		},
+		{
+			name: "invalid pool size",
+			env:  map[string]string{EnvPoolSize: "0"},
+			err:  true,
+		},
+		{
+			name: "retry policy",
+			env:  map[string]string{"RETRY_ATTEMPTS": "5", "RETRY_CODES": "421,450"},
+			expected: &Options{
+				DialTimeout:     DefaultDialTimeout,
+				LoginTimeout:    DefaultLoginTimeout,
+				PoolSize:        DefaultPoolSize,
+				PoolIdleTimeout: DefaultPoolIdleTimeout,
+				PoolKeepAlive:   DefaultPoolKeepAlive,
+				PoolWaitTimeout: DefaultPoolWaitTimeout,
+				Retry: models.RetryPolicy{
+					MaxAttempts: 5,
+					Backoff:     retry.DefaultPolicy().Backoff,
+					MaxBackoff:  retry.DefaultPolicy().MaxBackoff,
+					Jitter:      retry.DefaultPolicy().Jitter,
+					Codes:       []int{421, 450},
+				},
+			},
+		},
+		{
+			name: "invalid retry policy",
+			env:  map[string]string{"RETRY_ATTEMPTS": "none"},
+			err:  true,
+		},
+		{
+			name: "invalid duration",
+			env:  map[string]string{EnvDialTimeout: "soon"},
+			err:  true,
+		},
+		{
+			name: "negative duration",
+			env:  map[string]string{EnvLoginTimeout: "-1s"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := OptionsFromEnv(func(key string) string { return test.env[key] })
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, opts)
+		})
+	}
+}
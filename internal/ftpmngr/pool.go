@@ -0,0 +1,276 @@
+package ftpmngr
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpext"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+// validateAfter is the idle time after which a pooled connection is checked
+// with NOOP before it is handed out again.
+const validateAfter = time.Second
+
+// pool holds the logged in connections to one ftp endpoint. At most size
+// connections are open at a time, idle connections are kept alive with NOOP
+// and closed after the idle timeout. Every open connection holds a session
+// of the host limiter, the limiter closes idle ones when it runs out of
+// sessions.
+type pool struct {
+	opt   *models.FTPConnectionOpt
+	slots chan struct{}
+
+	mu      sync.Mutex
+	idle    []*idleConn
+	janitor bool
+}
+
+// pooledConn is a logged in connection together with its control
+// connection, which allows to bound the commands of the pool.
+type pooledConn struct {
+	*ftp.ServerConn
+	netConn net.Conn
+	// session gives the host session of the connection back.
+	session func()
+}
+
+// close quits the connection and gives its host session back.
+func (conn *pooledConn) close() {
+	_ = conn.Quit()
+	conn.session()
+}
+
+// ping checks the connection with NOOP within the login timeout.
+func (mngr *ftpmngr) ping(conn *pooledConn) error {
+	if err := conn.netConn.SetDeadline(time.Now().Add(mngr.opts.LoginTimeout)); err != nil {
+		return err
+	}
+
+	if err := conn.NoOp(); err != nil {
+		return err
+	}
+
+	return conn.netConn.SetDeadline(time.Time{})
+}
+
+// raw runs f with a function sending the commands the ftp client library does
+// not expose on conn. The commands are bounded by the login timeout and by
+// ctx, raw returns the first failure of a command, after which the connection
+// must be closed.
+func (mngr *ftpmngr) raw(ctx context.Context, conn *pooledConn, f func(cmd ftpext.Cmd)) (err error) {
+	if err := conn.netConn.SetDeadline(mngr.loginDeadline(ctx)); err != nil {
+		return err
+	}
+
+	stop := interrupt(ctx, conn.netConn)
+	defer func() {
+		if ctxErr := stop(); ctxErr != nil {
+			err = ctxErr
+		}
+	}()
+
+	send := ftpext.Raw(conn.netConn)
+	f(func(format string, args ...interface{}) (int, string, error) {
+		if err != nil {
+			return 0, "", err
+		}
+
+		var code int
+		var msg string
+		code, msg, err = send(format, args...)
+
+		return code, msg, err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return conn.netConn.SetDeadline(time.Time{})
+}
+
+type idleConn struct {
+	conn  *pooledConn
+	since time.Time
+	// checked is the time of the last successful command on the connection.
+	checked time.Time
+	// reuse takes the host session back from the limiter, the connection
+	// was closed by the limiter if it fails.
+	reuse func() bool
+}
+
+// poolKey identifies an endpoint, connections are only shared between
+// volumes using the same credentials. The password is hashed, the keys do
+// not keep it in plain text.
+func poolKey(opt *models.FTPConnectionOpt) string {
+	sum := sha256.Sum256([]byte(opt.Password))
+	return fmt.Sprintf("%s@%s/%x", opt.User, getURL(opt), sum)
+}
+
+func (mngr *ftpmngr) pool(opt *models.FTPConnectionOpt) *pool {
+	p, _ := mngr.pools.LoadOrStore(poolKey(opt), &pool{opt: opt, slots: make(chan struct{}, mngr.opts.PoolSize)})
+	return p.(*pool)
+}
+
+// acquire returns a logged in connection to the server, an idle one from the
+// pool if it is still healthy or a new one. When the pool is full it waits up
+// to the pool wait timeout for a connection to be released. The connection must be
+// handed back with release.
+func (mngr *ftpmngr) acquire(ctx context.Context, opt *models.FTPConnectionOpt) (*pooledConn, error) {
+	p := mngr.pool(opt)
+
+	wait := time.NewTimer(mngr.opts.PoolWaitTimeout)
+	defer wait.Stop()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-wait.C:
+		return nil, fmt.Errorf("no free pooled connection to %s within %s", getURL(opt), mngr.opts.PoolWaitTimeout)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("unable to get pooled connection in ftpmngr.acquire: %w", ctx.Err())
+	}
+
+	for {
+		idle := p.take()
+		if idle == nil {
+			break
+		}
+
+		if !idle.reuse() {
+			continue
+		}
+
+		if time.Since(idle.since) > mngr.opts.PoolIdleTimeout {
+			idle.conn.close()
+			continue
+		}
+
+		if time.Since(idle.checked) > validateAfter {
+			if err := mngr.ping(idle.conn); err != nil {
+				mngr.log(ctx).Debugw("dropping broken pooled connection", "addr", getURL(opt), "error", err.Error())
+				idle.conn.close()
+				continue
+			}
+		}
+
+		return idle.conn, nil
+	}
+
+	session, err := mngr.opts.Limiter.Acquire(ctx, opt)
+	if err != nil {
+		<-p.slots
+		return nil, fmt.Errorf("failed hostlimit.Acquire in ftpmngr.acquire: %w", err)
+	}
+
+	conn, err := mngr.getConnection(ctx, opt)
+	if err != nil {
+		session()
+		<-p.slots
+		return nil, err
+	}
+	conn.session = session
+
+	return conn, nil
+}
+
+// release hands a connection back to the pool. Connections which failed with
+// something else than an ftp reply are closed.
+func (mngr *ftpmngr) release(opt *models.FTPConnectionOpt, conn *pooledConn, err error) {
+	p := mngr.pool(opt)
+	defer func() { <-p.slots }()
+
+	var protoErr *textproto.Error
+	if err != nil && !errors.As(err, &protoErr) {
+		conn.close()
+		return
+	}
+
+	now := time.Now()
+	reuse := mngr.opts.Limiter.Idle(opt, conn.close)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.idle = append(p.idle, &idleConn{conn: conn, since: now, checked: now, reuse: reuse})
+	if !p.janitor {
+		p.janitor = true
+		go mngr.keepAlive(p)
+	}
+}
+
+// discard closes a connection which can not be handed back to the pool.
+func (mngr *ftpmngr) discard(opt *models.FTPConnectionOpt, conn *pooledConn) {
+	p := mngr.pool(opt)
+	defer func() { <-p.slots }()
+
+	conn.close()
+}
+
+// take removes the most recently used idle connection from the pool.
+func (p *pool) take() *idleConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.idle) == 0 {
+		return nil
+	}
+
+	idle := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+
+	return idle
+}
+
+// keepAlive sends NOOP on the idle connections of p and closes the ones which
+// are broken or idle for longer than the idle timeout. It stops when the pool
+// has no idle connections left.
+func (mngr *ftpmngr) keepAlive(p *pool) {
+	ticker := time.NewTicker(mngr.opts.PoolKeepAlive)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		p.mu.Lock()
+		idle := p.idle
+		p.idle = nil
+		p.mu.Unlock()
+
+		alive := make([]*idleConn, 0, len(idle))
+		for _, c := range idle {
+			if !c.reuse() {
+				continue
+			}
+
+			if time.Since(c.since) > mngr.opts.PoolIdleTimeout {
+				c.conn.close()
+				continue
+			}
+
+			if err := mngr.ping(c.conn); err != nil {
+				c.conn.close()
+				continue
+			}
+
+			c.checked = time.Now()
+			c.reuse = mngr.opts.Limiter.Idle(p.opt, c.conn.close)
+			alive = append(alive, c)
+		}
+
+		p.mu.Lock()
+		// connections released meanwhile are more recent than the checked ones
+		p.idle = append(alive, p.idle...)
+		if len(p.idle) == 0 {
+			p.janitor = false
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+	}
+}
@@ -0,0 +1,168 @@
+package ftpmngr
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr/ftptest"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/hostlimit"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"go.uber.org/zap"
+)
+
+func newPoolTestManager(t *testing.T, opts *Options) (*ftpmngr, *ftptest.Server) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	t.Cleanup(server.Close)
+
+	return NewFTPManager(opts, log.Sugar()).(*ftpmngr), server
+}
+
+func TestPoolReuse(t *testing.T) {
+	mngr, server := newPoolTestManager(t, DefaultOptions())
+	server.MkdirAll("/data")
+
+	require.Nil(t, mngr.CheckConnection(context.Background(), server.Opt()))
+	require.Nil(t, mngr.CheckRemoteDir(context.Background(), "/data", server.Opt()))
+	assert.Error(t, mngr.CheckRemoteDir(context.Background(), "/notExists", server.Opt()))
+	require.Nil(t, mngr.CheckRemoteDir(context.Background(), "/data", server.Opt()))
+
+	assert.Equal(t, 1, server.Accepted())
+
+	t.Run("other credentials", func(t *testing.T) {
+		opt := server.Opt()
+		opt.Password = "invalid"
+
+		assert.Error(t, mngr.CheckConnection(context.Background(), opt))
+	})
+}
+
+func TestPoolSize(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PoolSize = 1
+	opts.PoolWaitTimeout = 100 * time.Millisecond
+	mngr, server := newPoolTestManager(t, opts)
+
+	conn, err := mngr.acquire(context.Background(), server.Opt())
+	require.Nil(t, err)
+
+	_, err = mngr.acquire(context.Background(), server.Opt())
+	assert.Error(t, err)
+
+	mngr.release(server.Opt(), conn, nil)
+
+	reused, err := mngr.acquire(context.Background(), server.Opt())
+	require.Nil(t, err)
+	assert.Same(t, conn, reused)
+	mngr.release(server.Opt(), reused, nil)
+
+	assert.Equal(t, 1, server.Accepted())
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PoolIdleTimeout = 10 * time.Millisecond
+	mngr, server := newPoolTestManager(t, opts)
+
+	require.Nil(t, mngr.CheckConnection(context.Background(), server.Opt()))
+	time.Sleep(20 * time.Millisecond)
+	require.Nil(t, mngr.CheckConnection(context.Background(), server.Opt()))
+
+	assert.Equal(t, 2, server.Accepted())
+}
+
+func TestPoolValidation(t *testing.T) {
+	mngr, server := newPoolTestManager(t, DefaultOptions())
+
+	require.Nil(t, mngr.CheckConnection(context.Background(), server.Opt()))
+	server.DropConnections()
+
+	// pretend the connection was idle long enough to be validated
+	p := mngr.pool(server.Opt())
+	p.mu.Lock()
+	p.idle[0].checked = time.Time{}
+	p.mu.Unlock()
+
+	require.Nil(t, mngr.CheckConnection(context.Background(), server.Opt()))
+	assert.Equal(t, 2, server.Accepted())
+}
+
+func TestPoolKeepAlive(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PoolKeepAlive = 10 * time.Millisecond
+	mngr, server := newPoolTestManager(t, opts)
+
+	require.Nil(t, mngr.CheckConnection(context.Background(), server.Opt()))
+
+	time.Sleep(50 * time.Millisecond)
+	p := mngr.pool(server.Opt())
+	assert.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return len(p.idle) == 1 && p.janitor
+	}, time.Second, time.Millisecond)
+
+	// broken connections are dropped and the keepalive stops
+	server.DropConnections()
+	assert.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return len(p.idle) == 0 && !p.janitor
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPoolHostLimit(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Limiter = hostlimit.New(&hostlimit.Options{MaxSessions: 1, WaitTimeout: 50 * time.Millisecond})
+	mngr, server := newPoolTestManager(t, opts)
+
+	conn, err := mngr.acquire(context.Background(), server.Opt())
+	require.Nil(t, err)
+	assert.Equal(t, hostlimit.Stats{Active: 1}, opts.Limiter.Stats(server.Opt()))
+
+	// the session is taken by the busy connection
+	_, err = mngr.acquire(context.Background(), server.Opt())
+	assert.Error(t, err)
+	_, err = mngr.Usage(context.Background(), "/", server.Opt())
+	assert.Error(t, err)
+
+	// idle connections keep their session and are reused
+	mngr.release(server.Opt(), conn, nil)
+	assert.Equal(t, hostlimit.Stats{Active: 1}, opts.Limiter.Stats(server.Opt()))
+	require.Nil(t, mngr.CheckConnection(context.Background(), server.Opt()))
+
+	// closed connections give their session back
+	conn, err = mngr.acquire(context.Background(), server.Opt())
+	require.Nil(t, err)
+	mngr.release(server.Opt(), conn, errors.New("connection reset"))
+	assert.Equal(t, hostlimit.Stats{}, opts.Limiter.Stats(server.Opt()))
+	assert.Equal(t, 1, server.Accepted())
+
+	// idle connections are closed when another session is needed
+	require.Nil(t, mngr.CheckConnection(context.Background(), server.Opt()))
+	session, err := opts.Limiter.Acquire(context.Background(), server.Opt())
+	require.Nil(t, err)
+	assert.Equal(t, hostlimit.Stats{Active: 1}, opts.Limiter.Stats(server.Opt()))
+	assert.Error(t, mngr.CheckConnection(context.Background(), server.Opt()))
+
+	session()
+	require.Nil(t, mngr.CheckConnection(context.Background(), server.Opt()))
+	assert.Equal(t, 3, server.Accepted())
+}
+
+func TestPoolKey(t *testing.T) {
+	opt := &models.FTPConnectionOpt{Host: "localhost", Port: 21, User: "user", Password: "secret"}
+	other := &models.FTPConnectionOpt{Host: "localhost", Port: 21, User: "user", Password: "other"}
+
+	assert.NotContains(t, poolKey(opt), "secret")
+	assert.NotEqual(t, poolKey(opt), poolKey(other))
+	assert.Equal(t, poolKey(opt), poolKey(&models.FTPConnectionOpt{Host: "localhost", Port: 21, User: "user", Password: "secret"}))
+}
@@ -0,0 +1,497 @@
+package ftpmngr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/resume"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ConflictError is returned by Upload when paths were changed both in the
+// local copy and on the ftp server since the snapshot was taken.
+type ConflictError struct {
+	Paths []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("changed both locally and remotely: %s", strings.Join(e.Paths, ", "))
+}
+
+func (mngr *ftpmngr) Download(ctx context.Context, remotepath, dir string, opt *models.FTPConnectionOpt) (_ models.StageSnapshot, err error) {
+	ctx, span := tracing.Start(ctx, "ftpmngr.Download", append(serverAttrs(opt), attribute.String("ftp.path", remotepath))...)
+	defer func() { tracing.End(span, err) }()
+
+	snapshot, err := mngr.sync(ctx, remotepath, dir, nil, opt)
+	if err != nil {
+		return nil, fmt.Errorf("failed ftpmngr.sync in ftpmngr.Download: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+func (mngr *ftpmngr) Sync(ctx context.Context, remotepath, dir string, previous models.StageSnapshot, opt *models.FTPConnectionOpt) (_ models.StageSnapshot, err error) {
+	ctx, span := tracing.Start(ctx, "ftpmngr.Sync", append(serverAttrs(opt), attribute.String("ftp.path", remotepath))...)
+	defer func() { tracing.End(span, err) }()
+
+	snapshot, err := mngr.sync(ctx, remotepath, dir, previous, opt)
+	if err != nil {
+		return snapshot, fmt.Errorf("failed ftpmngr.sync in ftpmngr.Sync: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// sync makes dir a copy of the tree below remotepath. Entries of previous
+// which are unchanged on the server and still intact in dir are kept, the
+// others are downloaded to hidden temporary files next to their target and
+// renamed into place, so readers never see partial files. The returned snapshot
+// describes dir, also when the sync failed halfway.
+func (mngr *ftpmngr) sync(ctx context.Context, remotepath, dir string, previous models.StageSnapshot, opt *models.FTPConnectionOpt) (_ models.StageSnapshot, err error) {
+	snapshot := make(models.StageSnapshot, len(previous))
+	for rel, entry := range previous {
+		snapshot[rel] = entry
+	}
+
+	sess := &transferSession{mngr: mngr, ctx: ctx, opt: opt}
+	conn, err := sess.get()
+	if err != nil {
+		return snapshot, fmt.Errorf("unable to connect to ftp server in ftpmngr.sync: %w", err)
+	}
+
+	defer func() { sess.close(err) }()
+
+	remote, err := remoteSnapshot(conn, remotepath)
+	if err != nil {
+		return snapshot, fmt.Errorf("failed ftpmngr.remoteSnapshot in ftpmngr.sync: %w", err)
+	}
+
+	var removed, downloaded int
+
+	// children are removed before their parents
+	for _, rel := range sortedPaths(previous, true) {
+		if entry, ok := remote[rel]; ok && entry.Dir == previous[rel].Dir {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+			return snapshot, fmt.Errorf("unable to remove '%s' in ftpmngr.sync: %w", rel, err)
+		}
+		delete(snapshot, rel)
+		removed++
+	}
+
+	// parents sort before their children
+	for _, rel := range sortedPaths(remote, false) {
+		entry := remote[rel]
+		local := filepath.Join(dir, filepath.FromSlash(rel))
+
+		if entry.Dir {
+			if err := os.MkdirAll(local, 0755); err != nil {
+				return snapshot, fmt.Errorf("unable to create local dir in ftpmngr.sync: %w", err)
+			}
+			snapshot[rel] = entry
+			continue
+		}
+
+		if old, ok := snapshot[rel]; ok && old.Equal(entry) && intact(local, entry) {
+			continue
+		}
+
+		if err := sess.retrFile(path.Join(remotepath, rel), local, entry); err != nil {
+			return snapshot, fmt.Errorf("unable to download '%s' in ftpmngr.sync: %w", rel, err)
+		}
+		snapshot[rel] = entry
+		downloaded++
+	}
+
+	mngr.log(ctx).Debugw("synced remote dir", "addr", getURL(opt), "path", remotepath,
+		"entries", len(snapshot), "downloaded", downloaded, "removed", removed)
+
+	return snapshot, nil
+}
+
+// intact reports whether the local file still matches the entry it was
+// downloaded from.
+func intact(local string, entry models.StageEntry) bool {
+	info, err := os.Stat(local)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	return info.Size() == entry.Size && info.ModTime().Unix() == entry.ModTime.Unix()
+}
+
+func (mngr *ftpmngr) Upload(ctx context.Context, dir, remotepath string, snapshot models.StageSnapshot, partial string, opt *models.FTPConnectionOpt) (err error) {
+	ctx, span := tracing.Start(ctx, "ftpmngr.Upload", append(serverAttrs(opt), attribute.String("ftp.path", remotepath))...)
+	defer func() { tracing.End(span, err) }()
+
+	local, err := localSnapshot(dir)
+	if err != nil {
+		return fmt.Errorf("failed ftpmngr.localSnapshot in ftpmngr.Upload: %w", err)
+	}
+
+	sess := &transferSession{mngr: mngr, ctx: ctx, opt: opt}
+	conn, err := sess.get()
+	if err != nil {
+		return fmt.Errorf("unable to connect to ftp server in ftpmngr.Upload: %w", err)
+	}
+
+	defer func() { sess.close(err) }()
+
+	remote, err := remoteSnapshot(conn, remotepath)
+	if err != nil {
+		return fmt.Errorf("failed ftpmngr.remoteSnapshot in ftpmngr.Upload: %w", err)
+	}
+
+	changed := make(map[string]struct{})
+	conflicts := make([]string, 0)
+	for _, paths := range []models.StageSnapshot{snapshot, local, remote} {
+		for rel := range paths {
+			if _, ok := changed[rel]; ok || !changedSince(snapshot, local, rel) {
+				continue
+			}
+
+			changed[rel] = struct{}{}
+			if changedSince(snapshot, remote, rel) && changedSince(local, remote, rel) || replacesChangedDir(snapshot, local, remote, rel) {
+				conflicts = append(conflicts, rel)
+			}
+		}
+	}
+
+	if len(conflicts) != 0 {
+		sort.Strings(conflicts)
+		return &ConflictError{Paths: conflicts}
+	}
+
+	// create and replace top down, then delete bottom up
+	for _, rel := range sortedPaths(local, false) {
+		if _, ok := changed[rel]; !ok {
+			continue
+		}
+
+		// a transfer may have replaced a broken connection
+		conn, err := sess.get()
+		if err != nil {
+			return fmt.Errorf("unable to connect to ftp server in ftpmngr.Upload: %w", err)
+		}
+
+		entry, target := local[rel], path.Join(remotepath, rel)
+		if old, ok := remote[rel]; ok && old.Dir != entry.Dir {
+			if err := removeRemote(conn, target, old); err != nil {
+				return fmt.Errorf("unable to replace '%s' in ftpmngr.Upload: %w", rel, err)
+			}
+			delete(remote, rel)
+		}
+
+		if entry.Dir {
+			if _, ok := remote[rel]; !ok {
+				if err := conn.MakeDir(target); err != nil {
+					return fmt.Errorf("unable to create remote dir '%s' in ftpmngr.Upload: %w", rel, err)
+				}
+			}
+			continue
+		}
+
+		if err := sess.storFile(filepath.Join(dir, filepath.FromSlash(rel)), target, partial); err != nil {
+			return fmt.Errorf("unable to upload '%s' in ftpmngr.Upload: %w", rel, err)
+		}
+	}
+
+	for _, rel := range sortedPaths(snapshot, true) {
+		_, ok := changed[rel]
+		old, exists := remote[rel]
+		if _, kept := local[rel]; kept || !ok || !exists {
+			continue
+		}
+
+		conn, err := sess.get()
+		if err != nil {
+			return fmt.Errorf("unable to connect to ftp server in ftpmngr.Upload: %w", err)
+		}
+
+		if err := removeRemote(conn, path.Join(remotepath, rel), old); err != nil {
+			return fmt.Errorf("unable to delete '%s' in ftpmngr.Upload: %w", rel, err)
+		}
+	}
+
+	mngr.log(ctx).Debugw("uploaded local changes", "addr", getURL(opt), "path", remotepath, "changed", len(changed))
+
+	return nil
+}
+
+// changedSince reports whether rel differs between the snapshots a and b,
+// including being present in only one of them.
+func changedSince(a, b models.StageSnapshot, rel string) bool {
+	ea, inA := a[rel]
+	eb, inB := b[rel]
+	if inA != inB {
+		return true
+	}
+
+	return inA && !ea.Equal(eb)
+}
+
+// replacesChangedDir reports whether the directory rel of snapshot was
+// deleted or replaced locally while entries below it changed remotely.
+func replacesChangedDir(snapshot, local, remote models.StageSnapshot, rel string) bool {
+	if !snapshot[rel].Dir || local[rel].Dir {
+		return false
+	}
+
+	for other := range remote {
+		if strings.HasPrefix(other, rel+"/") && changedSince(snapshot, remote, other) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteSnapshot lists the tree below remotepath. When the listing does not
+// carry exact times the time of files is read with MDTM.
+func remoteSnapshot(conn *pooledConn, remotepath string) (models.StageSnapshot, error) {
+	snapshot := make(models.StageSnapshot)
+	mdtm := !conn.IsTimePreciseInList() && conn.IsGetTimeSupported()
+
+	walker := conn.Walk(remotepath)
+	for walker.Next() {
+		entry := walker.Stat()
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), remotepath), "/")
+
+		switch entry.Type {
+		case ftp.EntryTypeFolder:
+			snapshot[rel] = models.StageEntry{Dir: true}
+		case ftp.EntryTypeFile:
+			modTime := entry.Time
+			if mdtm {
+				t, err := conn.GetTime(walker.Path())
+				if err != nil {
+					return nil, fmt.Errorf("unable to get time of '%s' in ftpmngr.remoteSnapshot: %w", rel, err)
+				}
+				modTime = t
+			}
+
+			snapshot[rel] = models.StageEntry{Size: int64(entry.Size), ModTime: modTime}
+		}
+	}
+
+	if err := walker.Err(); err != nil {
+		return nil, fmt.Errorf("unable to walk remote dir in ftpmngr.remoteSnapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// localSnapshot lists the tree below dir, other files than regular files
+// and directories are skipped.
+func localSnapshot(dir string) (models.StageSnapshot, error) {
+	snapshot := make(models.StageSnapshot)
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p == dir {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			snapshot[filepath.ToSlash(rel)] = models.StageEntry{Dir: true}
+		case info.Mode().IsRegular():
+			snapshot[filepath.ToSlash(rel)] = models.StageEntry{Size: info.Size(), ModTime: info.ModTime()}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to walk local dir in ftpmngr.localSnapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// sortedPaths returns the paths of snapshot with parents before their
+// children, or after them if reverse is set.
+func sortedPaths(snapshot models.StageSnapshot, reverse bool) []string {
+	paths := make([]string, 0, len(snapshot))
+	for rel := range snapshot {
+		paths = append(paths, rel)
+	}
+
+	sort.Strings(paths)
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	}
+
+	return paths
+}
+
+// transferSession holds a pooled connection for the operations of a
+// transfer. A connection broken while moving a file is dropped and the next
+// operation acquires a new one, so the file transfer can be resumed.
+type transferSession struct {
+	mngr *ftpmngr
+	ctx  context.Context
+	opt  *models.FTPConnectionOpt
+	conn *pooledConn
+}
+
+// get returns the connection of the session, acquiring one if needed.
+func (sess *transferSession) get() (*pooledConn, error) {
+	if sess.conn == nil {
+		conn, err := sess.mngr.acquire(sess.ctx, sess.opt)
+		if err != nil {
+			return nil, err
+		}
+		sess.conn = conn
+	}
+
+	return sess.conn, nil
+}
+
+// with runs fn with the connection of the session and drops the connection
+// when fn broke it.
+func (sess *transferSession) with(fn func(conn resume.Conn) error) error {
+	conn, err := sess.get()
+	if err != nil {
+		return err
+	}
+
+	err = fn(conn)
+
+	var protoErr *textproto.Error
+	if err != nil && !errors.As(err, &protoErr) {
+		sess.mngr.release(sess.opt, conn, err)
+		sess.conn = nil
+	}
+
+	return err
+}
+
+// close gives the connection of the session back to the pool.
+func (sess *transferSession) close(err error) {
+	if sess.conn != nil {
+		sess.mngr.release(sess.opt, sess.conn, err)
+		sess.conn = nil
+	}
+}
+
+// logTransfer logs the resumes of the transfer of the remote file.
+func (sess *transferSession) logTransfer(transfer, remote string, stats resume.Stats) {
+	if stats.Resumes == 0 {
+		return
+	}
+
+	sess.mngr.log(sess.ctx).Infow("resumed interrupted "+transfer, "addr", getURL(sess.opt), "path", remote,
+		"bytes", stats.Bytes, "resumes", stats.Resumes)
+}
+
+// retrFile downloads remote to a temporary file next to local, sets its time
+// to the one of entry and renames it to local. Interrupted downloads are
+// resumed.
+func (sess *transferSession) retrFile(remote, local string, entry models.StageEntry) (err error) {
+	file, err := os.CreateTemp(filepath.Dir(local), "."+filepath.Base(local)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			os.Remove(file.Name())
+		}
+	}()
+
+	stats, err := resume.Retr(sess.ctx, sess.mngr.retryPolicy(sess.opt), sess.with, remote, file)
+	sess.logTransfer("download", remote, stats)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+
+	if err := os.Chtimes(file.Name(), entry.ModTime, entry.ModTime); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), local)
+}
+
+// storFile uploads the local file to remote. With a partial pattern the file
+// is stored under its temporary name first, so the server never shows a
+// truncated file. Interrupted uploads are resumed.
+func (sess *transferSession) storFile(local, remote, partial string) error {
+	file, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	target := remote
+	if partial != "" {
+		target = models.PartialName(partial, remote)
+	}
+
+	stats, err := resume.Stor(sess.ctx, sess.mngr.retryPolicy(sess.opt), sess.with, target, file, info.Size())
+	sess.logTransfer("upload", remote, stats)
+	if err != nil {
+		if conn, getErr := sess.get(); partial != "" && getErr == nil {
+			_ = conn.Delete(target)
+		}
+		return err
+	}
+
+	if partial == "" {
+		return nil
+	}
+
+	conn, err := sess.get()
+	if err != nil {
+		return err
+	}
+
+	return conn.Rename(target, remote)
+}
+
+func removeRemote(conn *pooledConn, remote string, entry models.StageEntry) error {
+	if entry.Dir {
+		return conn.RemoveDirRecur(remote)
+	}
+
+	return conn.Delete(remote)
+}
@@ -0,0 +1,221 @@
+package ftpmngr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr/ftptest"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestDownloadUpload(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	opts := DefaultOptions()
+	opts.Retry.Backoff = time.Millisecond
+	mngr := NewFTPManager(opts, logger)
+
+	setup := func(t *testing.T) string {
+		server.MkdirAll("/data")
+		server.WriteFile("/data/keep.txt", []byte("keep"))
+		server.WriteFile("/data/edit.txt", []byte("edit"))
+		server.WriteFile("/data/old/gone.txt", []byte("gone"))
+		t.Cleanup(func() { _ = mngr.RemoveRemoteDir(context.Background(), "/data", server.Opt()) })
+
+		return t.TempDir()
+	}
+
+	t.Run("download", func(t *testing.T) {
+		dir := setup(t)
+
+		snapshot, err := mngr.Download(context.Background(), "/data", dir, server.Opt())
+		require.NoError(t, err)
+
+		assert.Len(t, snapshot, 4)
+		assert.True(t, snapshot["old"].Dir)
+		assert.Equal(t, int64(4), snapshot["old/gone.txt"].Size)
+
+		data, err := os.ReadFile(filepath.Join(dir, "old", "gone.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "gone", string(data))
+	})
+
+	t.Run("upload changes", func(t *testing.T) {
+		dir := setup(t)
+
+		snapshot, err := mngr.Download(context.Background(), "/data", dir, server.Opt())
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "edit.txt"), []byte("edited"), 0644))
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "new"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "new", "file.txt"), []byte("new"), 0644))
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, "old")))
+		server.WriteFile("/data/remote.txt", []byte("remote"))
+
+		require.NoError(t, mngr.Upload(context.Background(), dir, "/data", snapshot, "", server.Opt()))
+
+		data, _ := server.ReadFile("/data/edit.txt")
+		assert.Equal(t, "edited", string(data))
+		data, _ = server.ReadFile("/data/new/file.txt")
+		assert.Equal(t, "new", string(data))
+		assert.False(t, server.Exists("/data/old"))
+		assert.True(t, server.Exists("/data/keep.txt"))
+		assert.True(t, server.Exists("/data/remote.txt"))
+	})
+
+	t.Run("atomic upload", func(t *testing.T) {
+		dir := setup(t)
+
+		snapshot, err := mngr.Download(context.Background(), "/data", dir, server.Opt())
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "edit.txt"), []byte("edited"), 0644))
+
+		// a failed transfer leaves the remote file untouched
+		server.Fail("STOR", opts.Retry.MaxAttempts)
+		require.Error(t, mngr.Upload(context.Background(), dir, "/data", snapshot, models.DefaultPartialPattern, server.Opt()))
+
+		data, _ := server.ReadFile("/data/edit.txt")
+		assert.Equal(t, "edit", string(data))
+		assert.False(t, server.Exists("/data/.edit.txt.partial"))
+
+		require.NoError(t, mngr.Upload(context.Background(), dir, "/data", snapshot, models.DefaultPartialPattern, server.Opt()))
+
+		data, _ = server.ReadFile("/data/edit.txt")
+		assert.Equal(t, "edited", string(data))
+		assert.False(t, server.Exists("/data/.edit.txt.partial"))
+	})
+
+	t.Run("interrupted transfers are resumed", func(t *testing.T) {
+		dir := setup(t)
+		content := bytes.Repeat([]byte("0123456789"), 1000)
+		server.WriteFile("/data/large.bin", content)
+
+		server.Interrupt("RETR", 4096)
+		snapshot, err := mngr.Download(context.Background(), "/data", dir, server.Opt())
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(filepath.Join(dir, "large.bin"))
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+
+		edited := bytes.Repeat([]byte("abcdefghij"), 1100)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "large.bin"), edited, 0644))
+
+		server.Interrupt("STOR", 4096)
+		require.NoError(t, mngr.Upload(context.Background(), dir, "/data", snapshot, models.DefaultPartialPattern, server.Opt()))
+
+		data, _ = server.ReadFile("/data/large.bin")
+		assert.Equal(t, edited, data)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		dir := setup(t)
+
+		snapshot, err := mngr.Download(context.Background(), "/data", dir, server.Opt())
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "edit.txt"), []byte("local"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "keep.txt"), []byte("local"), 0644))
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, "old")))
+		server.WriteFile("/data/edit.txt", []byte("remote"))
+		server.WriteFile("/data/old/added.txt", []byte("remote"))
+
+		err = mngr.Upload(context.Background(), dir, "/data", snapshot, "", server.Opt())
+
+		var conflict *ConflictError
+		require.True(t, errors.As(err, &conflict))
+		assert.Equal(t, []string{"edit.txt", "old"}, conflict.Paths)
+
+		data, _ := server.ReadFile("/data/keep.txt")
+		assert.Equal(t, "keep", string(data))
+		assert.True(t, server.Exists("/data/old/added.txt"))
+	})
+}
+
+func TestSync(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	mngr := NewFTPManager(DefaultOptions(), logger)
+	dir := t.TempDir()
+
+	server.WriteFile("/data/same.txt", []byte("same"))
+	server.WriteFile("/data/edit.txt", []byte("edit"))
+	server.WriteFile("/data/old/gone.txt", []byte("gone"))
+
+	snapshot, err := mngr.Sync(context.Background(), "/data", dir, nil, server.Opt())
+	require.NoError(t, err)
+	assert.Len(t, snapshot, 4)
+
+	same, err := os.Stat(filepath.Join(dir, "same.txt"))
+	require.NoError(t, err)
+
+	t.Run("incremental", func(t *testing.T) {
+		server.WriteFile("/data/edit.txt", []byte("edited"))
+		server.WriteFile("/data/new.txt", []byte("new"))
+		require.NoError(t, mngr.RemoveRemoteDir(context.Background(), "/data/old", server.Opt()))
+
+		snapshot, err = mngr.Sync(context.Background(), "/data", dir, snapshot, server.Opt())
+		require.NoError(t, err)
+		assert.Len(t, snapshot, 3)
+
+		data, err := os.ReadFile(filepath.Join(dir, "edit.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "edited", string(data))
+		assert.FileExists(t, filepath.Join(dir, "new.txt"))
+		assert.NoDirExists(t, filepath.Join(dir, "old"))
+
+		info, err := os.Stat(filepath.Join(dir, "same.txt"))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(same, info), "unchanged file was downloaded again")
+	})
+
+	t.Run("damaged local copy", func(t *testing.T) {
+		require.NoError(t, os.Remove(filepath.Join(dir, "same.txt")))
+
+		_, err := mngr.Sync(context.Background(), "/data", dir, snapshot, server.Opt())
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dir, "same.txt"))
+	})
+}
+
+func TestSyncMDTM(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	// without MLST the listing only carries the day of the last change
+	server.SetFeatures("EPSV", "MDTM", "SIZE", "UTF8")
+	server.WriteFile("/data/file.txt", []byte("file"))
+
+	snapshot, err := NewFTPManager(DefaultOptions(), logger).Sync(context.Background(), "/data", t.TempDir(), nil, server.Opt())
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), snapshot["file.txt"].ModTime, time.Minute)
+}
@@ -0,0 +1,177 @@
+package ftpmngr
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpext"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	usageCacheTTL = time.Minute
+	// usageWalkLimit bounds the number of entries visited by the size walk.
+	usageWalkLimit = 10000
+)
+
+type usageCacheEntry struct {
+	usage   *models.VolumeUsage
+	expires time.Time
+}
+
+func (mngr *ftpmngr) Usage(ctx context.Context, remotepath string, opt *models.FTPConnectionOpt) (_ *models.VolumeUsage, err error) {
+	ctx, span := tracing.Start(ctx, "ftpmngr.Usage", append(serverAttrs(opt), attribute.String("ftp.path", remotepath))...)
+	defer func() { tracing.End(span, err) }()
+
+	key := fmt.Sprintf("%s@%s%s", opt.User, getURL(opt), path.Clean("/"+remotepath))
+
+	if cached, ok := mngr.usageCache.Load(key); ok {
+		entry := cached.(*usageCacheEntry)
+		if time.Now().Before(entry.expires) {
+			return entry.usage, nil
+		}
+	}
+
+	// failures are not cached, the next call asks the server again
+	usage, err := mngr.probeUsage(ctx, remotepath, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	mngr.usageCache.Store(key, &usageCacheEntry{usage: usage, expires: time.Now().Add(mngr.usageTTL)})
+
+	return usage, nil
+}
+
+// probeUsage asks the server for the available space and the account quota
+// and sums the file sizes below remotepath.
+func (mngr *ftpmngr) probeUsage(ctx context.Context, remotepath string, opt *models.FTPConnectionOpt) (*models.VolumeUsage, error) {
+	usage := &models.VolumeUsage{Used: -1, Available: -1, AccountUsed: -1, Quota: -1, Sources: []string{}, CheckedAt: time.Now()}
+
+	conn, err := mngr.acquire(ctx, opt)
+	if err != nil {
+		mngr.log(ctx).Errorf("unable to probe remote usage: %s", err.Error())
+		return nil, fmt.Errorf("unable to connect to ftp server in ftpmngr.probeUsage: %w", err)
+	}
+
+	err = mngr.raw(ctx, conn, func(cmd ftpext.Cmd) {
+		features, err := ftpext.Features(cmd)
+		if err != nil {
+			mngr.log(ctx).Warnf("unable to get ftp server features: %s", err.Error())
+			return
+		}
+
+		if _, ok := features["AVBL"]; ok {
+			if available, err := avbl(cmd, remotepath); err == nil {
+				usage.Available = available
+				usage.Sources = append(usage.Sources, models.UsageSourceAVBL)
+			} else {
+				mngr.log(ctx).Warnf("unable to get available space: %s", err.Error())
+			}
+		}
+
+		if used, quota, ok := siteQuota(cmd); ok {
+			usage.AccountUsed = used
+			usage.Quota = quota
+			usage.Sources = append(usage.Sources, models.UsageSourceSiteQuota)
+		}
+	})
+	mngr.release(opt, conn, err)
+
+	// the quota of the account covers more than the volume
+	used, truncated, err := mngr.walkSize(ctx, remotepath, opt)
+	if err != nil {
+		return nil, fmt.Errorf("failed ftpmngr.walkSize in ftpmngr.probeUsage: %w", err)
+	}
+
+	usage.Used = used
+	usage.Truncated = truncated
+	usage.Sources = append(usage.Sources, models.UsageSourceWalk)
+
+	return usage, nil
+}
+
+// walkSize sums the size of the files below remotepath. The walk stops after
+// usageWalkLimit entries and reports the partial sum as truncated.
+func (mngr *ftpmngr) walkSize(ctx context.Context, remotepath string, opt *models.FTPConnectionOpt) (_ int64, _ bool, err error) {
+	conn, err := mngr.acquire(ctx, opt)
+	if err != nil {
+		return 0, false, fmt.Errorf("unable to connect to ftp server in ftpmngr.walkSize: %w", err)
+	}
+
+	defer func() { mngr.release(opt, conn, err) }()
+
+	var size int64
+	walker := conn.Walk(remotepath)
+	for entries := 0; walker.Next(); entries++ {
+		if entries == usageWalkLimit {
+			return size, true, nil
+		}
+
+		if entry := walker.Stat(); entry.Type == ftp.EntryTypeFile {
+			size += int64(entry.Size)
+		}
+	}
+
+	if err := walker.Err(); err != nil {
+		return 0, false, fmt.Errorf("unable to walk remote dir in ftpmngr.walkSize: %w", err)
+	}
+
+	return size, false, nil
+}
+
+// avbl issues the AVBL command which returns the free space in bytes.
+func avbl(cmd ftpext.Cmd, remotepath string) (int64, error) {
+	code, msg, err := cmd("AVBL %s", remotepath)
+	if err != nil {
+		return 0, err
+	}
+
+	if code != ftp.StatusFile {
+		return 0, fmt.Errorf("unexpected AVBL reply: %d %s", code, msg)
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+}
+
+// siteQuota issues the SITE QUOTA command of proftpd mod_quotatab and parses
+// the uploaded bytes line, e.g. "Uploaded bytes: 1024.00/1048576.00".
+func siteQuota(cmd ftpext.Cmd) (int64, int64, bool) {
+	code, msg, err := cmd("SITE QUOTA")
+	if err != nil || code/100 != 2 {
+		return 0, 0, false
+	}
+
+	for _, line := range strings.Split(msg, "\n") {
+		_, value, ok := strings.Cut(line, "Uploaded bytes:")
+		if !ok {
+			continue
+		}
+
+		usedStr, limitStr, ok := strings.Cut(strings.TrimSpace(value), "/")
+		if !ok {
+			return 0, 0, false
+		}
+
+		used, err := strconv.ParseFloat(usedStr, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+
+		limit, err := strconv.ParseFloat(limitStr, 64)
+		if err != nil {
+			return int64(used), -1, true
+		}
+
+		return int64(used), int64(limit), true
+	}
+
+	return 0, 0, false
+}
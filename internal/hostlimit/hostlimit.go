@@ -0,0 +1,267 @@
+// Package hostlimit caps the concurrent ftp sessions the driver opens to one
+// server.
+package hostlimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+// Environment variables read by OptionsFromEnv.
+const (
+	EnvMaxSessions = "HOST_MAX_SESSIONS"
+	EnvWaitTimeout = "HOST_WAIT_TIMEOUT"
+)
+
+const DefaultWaitTimeout = time.Minute
+
+// Options configures a Limiter. MaxSessions of 0 disables the limit.
+type Options struct {
+	MaxSessions int
+	WaitTimeout time.Duration
+}
+
+// OptionsFromEnv reads the limiter options with getenv.
+func OptionsFromEnv(getenv func(string) string) (*Options, error) {
+	opts := &Options{WaitTimeout: DefaultWaitTimeout}
+
+	if value := getenv(EnvMaxSessions); value != "" {
+		max, err := strconv.Atoi(value)
+		if err != nil || max < 0 {
+			return nil, fmt.Errorf("invalid %s value '%s' in hostlimit.OptionsFromEnv", EnvMaxSessions, value)
+		}
+		opts.MaxSessions = max
+	}
+
+	if value := getenv(EnvWaitTimeout); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid %s value '%s' in hostlimit.OptionsFromEnv", EnvWaitTimeout, value)
+		}
+		opts.WaitTimeout = d
+	}
+
+	return opts, nil
+}
+
+// Stats describes the sessions of one server.
+type Stats struct {
+	Active int
+	Queued int
+}
+
+// Limiter is a semaphore per server. Sessions beyond the limit wait in a
+// first in, first out queue for up to the wait timeout. Sessions held by idle
+// pooled connections are reclaimed before anyone waits. A nil Limiter does not
+// limit anything.
+type Limiter struct {
+	opts *Options
+
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+type host struct {
+	active int
+	queue  []chan struct{}
+	// idle are the sessions held by idle pooled connections, the oldest
+	// first.
+	idle []*idleSession
+}
+
+// idleSession is the session of an idle pooled connection, close closes the
+// connection and gives the session back.
+type idleSession struct {
+	close func()
+}
+
+func New(opts *Options) *Limiter {
+	return &Limiter{opts: opts, hosts: make(map[string]*host)}
+}
+
+// Key returns the key of the server of opt.
+func Key(opt *models.FTPConnectionOpt) string {
+	return fmt.Sprintf("%s:%d", strings.ToLower(opt.Host), opt.Port)
+}
+
+// Enabled reports whether l limits sessions.
+func (l *Limiter) Enabled() bool {
+	return l != nil && l.opts.MaxSessions > 0
+}
+
+// Acquire takes a session of the server of opt, waiting in the queue while
+// the server is at its limit. The returned function gives the session back,
+// it may be called more than once.
+func (l *Limiter) Acquire(ctx context.Context, opt *models.FTPConnectionOpt) (func(), error) {
+	if !l.Enabled() {
+		return func() {}, nil
+	}
+
+	key := Key(opt)
+
+	l.mu.Lock()
+	h := l.host(key)
+	for h.active >= l.opts.MaxSessions && len(h.queue) == 0 && len(h.idle) != 0 {
+		idle := h.idle[0]
+		h.idle = h.idle[1:]
+		l.mu.Unlock()
+
+		// closing the connection gives its session back
+		idle.close()
+
+		l.mu.Lock()
+		h = l.host(key)
+	}
+
+	if h.active < l.opts.MaxSessions && len(h.queue) == 0 {
+		h.active++
+		l.mu.Unlock()
+		return l.releaser(key), nil
+	}
+
+	ready := make(chan struct{})
+	h.queue = append(h.queue, ready)
+	l.mu.Unlock()
+
+	wait := time.NewTimer(l.opts.WaitTimeout)
+	defer wait.Stop()
+
+	var err error
+	select {
+	case <-ready:
+		return l.releaser(key), nil
+	case <-wait.C:
+		err = fmt.Errorf("no free session to %s within %s", key, l.opts.WaitTimeout)
+	case <-ctx.Done():
+		err = fmt.Errorf("unable to get session in hostlimit.Acquire: %w", ctx.Err())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-ready:
+		// handed over while giving up, pass it on
+		l.release(key)
+	default:
+		h.queue = removeWaiter(h.queue, ready)
+	}
+
+	return nil, err
+}
+
+// Idle marks a session as held by an idle pooled connection of the server of
+// opt. While the server is at its limit the session is reclaimed with close,
+// which must close the connection and give the session back. It is reclaimed
+// at once if sessions are waiting already. The returned function takes the
+// session back into use, it reports false if it was reclaimed meanwhile and
+// the connection must not be used anymore.
+func (l *Limiter) Idle(opt *models.FTPConnectionOpt, close func()) func() bool {
+	if !l.Enabled() {
+		return func() bool { return true }
+	}
+
+	key := Key(opt)
+	idle := &idleSession{close: close}
+
+	l.mu.Lock()
+	h := l.host(key)
+	if len(h.queue) != 0 {
+		l.mu.Unlock()
+		close()
+		return func() bool { return false }
+	}
+	h.idle = append(h.idle, idle)
+	l.mu.Unlock()
+
+	return func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		h, ok := l.hosts[key]
+		if !ok {
+			return false
+		}
+
+		for i, s := range h.idle {
+			if s == idle {
+				h.idle = append(h.idle[:i], h.idle[i+1:]...)
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Stats returns the sessions of the server of opt.
+func (l *Limiter) Stats(opt *models.FTPConnectionOpt) Stats {
+	if !l.Enabled() {
+		return Stats{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h, ok := l.hosts[Key(opt)]
+	if !ok {
+		return Stats{}
+	}
+
+	return Stats{Active: h.active, Queued: len(h.queue)}
+}
+
+func (l *Limiter) host(key string) *host {
+	h, ok := l.hosts[key]
+	if !ok {
+		h = &host{}
+		l.hosts[key] = h
+	}
+
+	return h
+}
+
+func (l *Limiter) releaser(key string) func() {
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.release(key)
+		})
+	}
+}
+
+// release hands the session to the first waiter or frees it, l.mu must be
+// held.
+func (l *Limiter) release(key string) {
+	h := l.hosts[key]
+
+	if len(h.queue) != 0 {
+		close(h.queue[0])
+		h.queue = h.queue[1:]
+		return
+	}
+
+	h.active--
+	if h.active == 0 {
+		delete(l.hosts, key)
+	}
+}
+
+func removeWaiter(queue []chan struct{}, ready chan struct{}) []chan struct{} {
+	for i, c := range queue {
+		if c == ready {
+			return append(queue[:i], queue[i+1:]...)
+		}
+	}
+
+	return queue
+}
@@ -0,0 +1,168 @@
+package hostlimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+func TestAcquire(t *testing.T) {
+	limiter := New(&Options{MaxSessions: 2, WaitTimeout: time.Second})
+	opt := &models.FTPConnectionOpt{Host: "ftp.example.com", Port: 21}
+	other := &models.FTPConnectionOpt{Host: "ftp.example.com", Port: 2121}
+
+	first, err := limiter.Acquire(context.Background(), opt)
+	require.Nil(t, err)
+	second, err := limiter.Acquire(context.Background(), opt)
+	require.Nil(t, err)
+
+	// other servers have their own limit
+	release, err := limiter.Acquire(context.Background(), other)
+	require.Nil(t, err)
+	release()
+
+	acquired := make(chan func())
+	go func() {
+		release, err := limiter.Acquire(context.Background(), opt)
+		assert.Nil(t, err)
+		acquired <- release
+	}()
+
+	assert.Eventually(t, func() bool { return limiter.Stats(opt) == Stats{Active: 2, Queued: 1} }, time.Second, time.Millisecond)
+
+	first()
+	first()
+	third := <-acquired
+	assert.Equal(t, Stats{Active: 2}, limiter.Stats(opt))
+
+	second()
+	third()
+	assert.Equal(t, Stats{}, limiter.Stats(opt))
+}
+
+func TestAcquireTimeout(t *testing.T) {
+	limiter := New(&Options{MaxSessions: 1, WaitTimeout: 50 * time.Millisecond})
+	opt := &models.FTPConnectionOpt{Host: "ftp.example.com", Port: 21}
+
+	release, err := limiter.Acquire(context.Background(), opt)
+	require.Nil(t, err)
+
+	_, err = limiter.Acquire(context.Background(), opt)
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = limiter.Acquire(ctx, opt)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.Equal(t, Stats{Active: 1}, limiter.Stats(opt))
+
+	release()
+	assert.Equal(t, Stats{}, limiter.Stats(opt))
+}
+
+func TestIdle(t *testing.T) {
+	limiter := New(&Options{MaxSessions: 1, WaitTimeout: time.Second})
+	opt := &models.FTPConnectionOpt{Host: "ftp.example.com", Port: 21}
+
+	t.Run("reused", func(t *testing.T) {
+		release, err := limiter.Acquire(context.Background(), opt)
+		require.Nil(t, err)
+
+		reuse := limiter.Idle(opt, func() { t.Error("reused session was closed") })
+		assert.True(t, reuse())
+		assert.Equal(t, Stats{Active: 1}, limiter.Stats(opt))
+
+		release()
+		assert.Equal(t, Stats{}, limiter.Stats(opt))
+	})
+
+	t.Run("reclaimed", func(t *testing.T) {
+		release, err := limiter.Acquire(context.Background(), opt)
+		require.Nil(t, err)
+
+		closed := 0
+		reuse := limiter.Idle(opt, func() {
+			closed++
+			release()
+		})
+
+		// the idle session is closed instead of waiting for it
+		other, err := limiter.Acquire(context.Background(), opt)
+		require.Nil(t, err)
+		assert.Equal(t, 1, closed)
+		assert.False(t, reuse())
+		assert.Equal(t, Stats{Active: 1}, limiter.Stats(opt))
+
+		other()
+		assert.Equal(t, Stats{}, limiter.Stats(opt))
+	})
+
+	t.Run("waiters", func(t *testing.T) {
+		release, err := limiter.Acquire(context.Background(), opt)
+		require.Nil(t, err)
+
+		acquired := make(chan func())
+		go func() {
+			release, err := limiter.Acquire(context.Background(), opt)
+			assert.Nil(t, err)
+			acquired <- release
+		}()
+		assert.Eventually(t, func() bool { return limiter.Stats(opt) == Stats{Active: 1, Queued: 1} }, time.Second, time.Millisecond)
+
+		// a session going idle is handed to the waiter at once
+		reuse := limiter.Idle(opt, release)
+		assert.False(t, reuse())
+
+		(<-acquired)()
+		assert.Equal(t, Stats{}, limiter.Stats(opt))
+	})
+}
+
+func TestDisabled(t *testing.T) {
+	opt := &models.FTPConnectionOpt{Host: "ftp.example.com", Port: 21}
+
+	for _, limiter := range []*Limiter{nil, New(&Options{MaxSessions: 0})} {
+		for i := 0; i < 10; i++ {
+			_, err := limiter.Acquire(context.Background(), opt)
+			require.Nil(t, err)
+		}
+		assert.False(t, limiter.Enabled())
+		assert.Equal(t, Stats{}, limiter.Stats(opt))
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected *Options
+		err      bool
+	}{
+		{name: "defaults", env: map[string]string{}, expected: &Options{WaitTimeout: DefaultWaitTimeout}},
+		{
+			name:     "limit",
+			env:      map[string]string{EnvMaxSessions: "10", EnvWaitTimeout: "2m"},
+			expected: &Options{MaxSessions: 10, WaitTimeout: 2 * time.Minute},
+		},
+		{name: "invalid limit", env: map[string]string{EnvMaxSessions: "-1"}, err: true},
+		{name: "invalid timeout", env: map[string]string{EnvWaitTimeout: "later"}, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := OptionsFromEnv(func(key string) string { return test.env[key] })
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, opts)
+		})
+	}
+}
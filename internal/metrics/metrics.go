@@ -0,0 +1,105 @@
+// Package metrics holds the Prometheus collectors of the driver. The
+// collectors are registered on Registry which is served by Handler.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ftp_driver"
+
+// Results of an operation used as label values.
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	DriverRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Volume plugin requests by method and result.",
+	}, []string{"method", "result"})
+
+	DriverRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the volume plugin requests by method.",
+		Buckets:   []float64{0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"method"})
+
+	MountFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mount_failures_total",
+		Help:      "Failed mounts by reason.",
+	}, []string{"reason"})
+
+	UnmountFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "unmount_failures_total",
+		Help:      "Failed unmounts by reason.",
+	}, []string{"reason"})
+
+	ActiveMounts = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_mounts",
+		Help:      "Volumes currently mounted by the driver.",
+	})
+
+	ConnectionCheckFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connection_check_failures_total",
+		Help:      "Failed ftp connection checks by server address.",
+	}, []string{"host"})
+
+	HealthChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "health_checks_total",
+		Help:      "Volume health checks by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		DriverRequests,
+		DriverRequestDuration,
+		MountFailures,
+		UnmountFailures,
+		ActiveMounts,
+		ConnectionCheckFailures,
+		HealthChecks,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the collectors of Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveRequest records a volume plugin request started at start.
+func ObserveRequest(method string, start time.Time, err error) {
+	DriverRequests.WithLabelValues(method, result(err)).Inc()
+	DriverRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// ObserveHealthCheck records the result of a volume health check.
+func ObserveHealthCheck(err error) {
+	HealthChecks.WithLabelValues(result(err)).Inc()
+}
+
+func result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+
+	return ResultSuccess
+}
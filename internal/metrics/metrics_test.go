@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveRequest(t *testing.T) {
+	ObserveRequest("mount", time.Now(), nil)
+	ObserveRequest("mount", time.Now(), errors.New("Unexpected"))
+	ObserveRequest("mount", time.Now(), errors.New("Unexpected"))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(DriverRequests.WithLabelValues("mount", ResultSuccess)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(DriverRequests.WithLabelValues("mount", ResultError)))
+	assert.Equal(t, 1, testutil.CollectAndCount(DriverRequestDuration))
+}
+
+func TestHandler(t *testing.T) {
+	ObserveHealthCheck(nil)
+	ActiveMounts.Set(2)
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	require.Equal(t, 200, recorder.Code)
+
+	body, _ := io.ReadAll(recorder.Body)
+	assert.Contains(t, string(body), `ftp_driver_health_checks_total{result="success"} 1`)
+	assert.Contains(t, string(body), "ftp_driver_active_mounts 2")
+	assert.Contains(t, string(body), "go_goroutines")
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Features of an ftp server the driver adapts to, as listed in FEAT. MLSD
+// is announced as MLST.
+const (
+	FeatureEPSV    = "EPSV"
+	FeatureHash    = "HASH"
+	FeatureMDTM    = "MDTM"
+	FeatureMLST    = "MLST"
+	FeatureREST    = "REST"
+	FeatureSIZE    = "SIZE"
+	FeatureUTF8    = "UTF8"
+	FeatureXCRC    = "XCRC"
+	FeatureXMD5    = "XMD5"
+	FeatureXSHA256 = "XSHA256"
+)
+
+// knownFeatures are the features reported in the status of a volume.
+var knownFeatures = []string{
+	FeatureEPSV, FeatureHash, FeatureMDTM, FeatureMLST, FeatureREST,
+	FeatureSIZE, FeatureUTF8, FeatureXCRC, FeatureXMD5, FeatureXSHA256,
+}
+
+// ServerCapabilities is the FEAT reply of an ftp server. A nil
+// *ServerCapabilities means the features are unknown and the backends keep
+// their defaults.
+type ServerCapabilities struct {
+	// Features is keyed by upper case command with the parameters listed by
+	// the server, e.g. "REST": "STREAM".
+	Features  map[string]string
+	CheckedAt time.Time
+}
+
+// Known reports whether the features of the server were discovered.
+func (c *ServerCapabilities) Known() bool {
+	return c != nil
+}
+
+// Has reports whether the server lists feature, unknown features are not
+// listed.
+func (c *ServerCapabilities) Has(feature string) bool {
+	if c == nil {
+		return false
+	}
+
+	_, ok := c.Features[feature]
+	return ok
+}
+
+// Lacks reports whether the server is known not to list feature.
+func (c *ServerCapabilities) Lacks(feature string) bool {
+	return c.Known() && !c.Has(feature)
+}
+
+// Supported returns the known features the server lists, sorted.
+func (c *ServerCapabilities) Supported() []string {
+	res := make([]string, 0)
+	for _, feature := range knownFeatures {
+		if c.Has(feature) {
+			res = append(res, feature)
+		}
+	}
+	sort.Strings(res)
+
+	return res
+}
@@ -0,0 +1,49 @@
+package models
+
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+)
+
+// HealthCheck is the result of a single health check.
+type HealthCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthReport describes the health of the plugin. Checks cover the plugin
+// itself, Volumes the mounted volumes.
+type HealthReport struct {
+	Status  string        `json:"status"`
+	Checks  []HealthCheck `json:"checks"`
+	Volumes []HealthCheck `json:"volumes"`
+}
+
+func NewHealthCheck(name string, err error) HealthCheck {
+	if err != nil {
+		return HealthCheck{Name: name, Status: HealthDegraded, Error: err.Error()}
+	}
+
+	return HealthCheck{Name: name, Status: HealthOK}
+}
+
+// Ready reports whether all checks of the plugin itself passed.
+func (r *HealthReport) Ready() bool {
+	return healthy(r.Checks)
+}
+
+// Healthy reports whether all checks passed.
+func (r *HealthReport) Healthy() bool {
+	return healthy(r.Checks) && healthy(r.Volumes)
+}
+
+func healthy(checks []HealthCheck) bool {
+	for _, check := range checks {
+		if check.Status != HealthOK {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,39 @@
+package models
+
+import "sync/atomic"
+
+// QuotaUsage counts the bytes stored by a volume on the ftp server. It is
+// shared between the mount enforcing the quota and the state manager.
+type QuotaUsage struct {
+	used int64
+}
+
+func (u *QuotaUsage) Used() int64 {
+	return atomic.LoadInt64(&u.used)
+}
+
+func (u *QuotaUsage) Set(used int64) {
+	atomic.StoreInt64(&u.used, used)
+}
+
+// Reserve adds delta to the usage. A positive delta is refused if the usage
+// would exceed limit, a limit of 0 means no limit. The usage never drops
+// below 0.
+func (u *QuotaUsage) Reserve(delta, limit int64) bool {
+	for {
+		used := atomic.LoadInt64(&u.used)
+
+		next := used + delta
+		if next < 0 {
+			next = 0
+		}
+
+		if delta > 0 && limit > 0 && next > limit {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&u.used, used, next) {
+			return true
+		}
+	}
+}
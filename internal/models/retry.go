@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// RetryPolicy describes how transient ftp failures are retried. The delay
+// before the n-th retry is Backoff doubled n-1 times, capped at MaxBackoff
+// and varied by up to Jitter (a fraction) in both directions.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Jitter      float64
+	// Codes are the ftp reply codes worth retrying.
+	Codes []int
+}
+
+// Override returns a copy of p with the non zero fields of o applied.
+func (p RetryPolicy) Override(o *RetryPolicy) RetryPolicy {
+	if o == nil {
+		return p
+	}
+
+	if o.MaxAttempts != 0 {
+		p.MaxAttempts = o.MaxAttempts
+	}
+
+	if o.Backoff != 0 {
+		p.Backoff = o.Backoff
+	}
+
+	if o.MaxBackoff != 0 {
+		p.MaxBackoff = o.MaxBackoff
+	}
+
+	if o.Jitter != 0 {
+		p.Jitter = o.Jitter
+	}
+
+	if len(o.Codes) != 0 {
+		p.Codes = o.Codes
+	}
+
+	return p
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Volume modes. Mounted volumes are served over ftp by a backend, staged
+// volumes are copied to local disk on the first mount and back on the last
+// unmount, mirrored volumes are read-only local copies synced from the
+// server.
+const (
+	ModeMount  = "mount"
+	ModeStage  = "stage"
+	ModeMirror = "mirror"
+)
+
+// Stage states of a staged volume.
+const (
+	StageStaged   = "staged"
+	StageFailed   = "failed"
+	StageConflict = "conflict"
+)
+
+// StageEntry describes a file or directory of a local copy as it was on the
+// ftp server when it was downloaded.
+type StageEntry struct {
+	Dir     bool      `json:"dir,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// Equal reports whether e and o describe the same content. The time of
+// directories is ignored and times are compared to the second, the
+// precision of ftp listings.
+func (e StageEntry) Equal(o StageEntry) bool {
+	if e.Dir || o.Dir {
+		return e.Dir == o.Dir
+	}
+
+	return e.Size == o.Size && e.ModTime.Unix() == o.ModTime.Unix()
+}
+
+// StageSnapshot maps the paths of a local copy, relative to the remote path
+// and separated by slashes, to their entries.
+type StageSnapshot map[string]StageEntry
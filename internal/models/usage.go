@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Sources of a VolumeUsage.
+const (
+	UsageSourceAVBL      = "avbl"
+	UsageSourceSiteQuota = "site quota"
+	UsageSourceWalk      = "walk"
+)
+
+// VolumeUsage describes the space used by a volume on the ftp server.
+// Unknown values are -1.
+type VolumeUsage struct {
+	// Used is the size of the files below the remote path of the volume.
+	Used      int64
+	Available int64
+	// AccountUsed and Quota are reported by the server for the whole
+	// account, which other volumes and clients share.
+	AccountUsed int64
+	Quota       int64
+	Sources     []string
+	Truncated   bool
+	CheckedAt   time.Time
+}
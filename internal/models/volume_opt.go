@@ -1,13 +1,100 @@
 package models
 
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// Share modes define how a volume reacts to other volumes using an
+// overlapping remote path on the same ftp server.
+const (
+	ShareReject = "reject"
+	ShareWarn   = "warn"
+	ShareAllow  = "allow"
+)
+
+// Mount backends.
+const (
+	BackendCurlFtpFS = "curlftpfs"
+	BackendNative    = "native"
+)
+
+// DefaultPartialPattern names the temporary file of an atomic upload, the
+// placeholder PartialPlaceholder is replaced with the name of the file.
+const (
+	DefaultPartialPattern = ".{name}.partial"
+	PartialPlaceholder    = "{name}"
+)
+
+// PartialName returns the name the file p is uploaded as before it is renamed
+// into place.
+func PartialName(pattern, p string) string {
+	return path.Join(path.Dir(p), strings.ReplaceAll(pattern, PartialPlaceholder, path.Base(p)))
+}
+
+// LoadServerLocation returns the time zone called name, an IANA name such
+// as Europe/Moscow or a fixed offset such as +03:00. Empty names are UTC.
+func LoadServerLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	for _, layout := range []string{"-07:00", "-0700", "-07"} {
+		if t, err := time.Parse(layout, name); err == nil {
+			_, offset := t.Zone()
+			return time.FixedZone(name, offset), nil
+		}
+	}
+
+	// the zone of the plugin says nothing about the server
+	if name == "Local" {
+		return nil, fmt.Errorf("unknown time zone %s", name)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load time zone in models.LoadServerLocation: %w", err)
+	}
+
+	return loc, nil
+}
+
 type FTPConnectionOpt struct {
 	User     string
 	Host     string
 	Port     int
 	Password string
+	// Retry overrides the driver-wide retry policy for the volume.
+	Retry *RetryPolicy
 }
 
 type VolumeOptions struct {
-	RemotePath string
+	RemotePath   string
+	RemoveRemote bool
+	Share        string
+	Backend      string
+	Mode         string
+	// Refresh is the interval in which mirrored volumes are synced while
+	// mounted, 0 syncs them only when mounted.
+	Refresh time.Duration
+	Quota   int64
+	// AtomicUpload uploads the files of staged volumes under a temporary
+	// name made from PartialPattern first. The native backend always does.
+	AtomicUpload   bool
+	PartialPattern string
+	// Checksum verifies the transfers of the native backend with a checksum
+	// of the server when it offers one.
+	Checksum bool
+	// Capabilities are the features of the server, discovered when the
+	// volume is created and refreshed when it is mounted.
+	Capabilities *ServerCapabilities
+	// Encoding is the canonical name of the encoding of the file names on
+	// the server, empty for UTF-8.
+	Encoding string
+	// ServerTZ is the time zone of the times the server lists without one,
+	// empty for UTC.
+	ServerTZ string
 	FTPConnectionOpt
 }
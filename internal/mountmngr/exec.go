@@ -0,0 +1,31 @@
+package mountmngr
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// run runs a mount helper in its own process group. When ctx is done before
+// the helper exits the whole group is killed, curlftpfs forks the process
+// serving the mount.
+func run(ctx context.Context, cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("unable to start %s in mountmngr.run: %w", cmd.Path, err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return fmt.Errorf("%s killed in mountmngr.run: %w", cmd.Path, ctx.Err())
+	}
+}
@@ -0,0 +1,32 @@
+package mountmngr
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("finished helper", func(t *testing.T) {
+		err := run(context.Background(), exec.Command("true"))
+		assert.Nil(t, err)
+	})
+
+	t.Run("failed helper", func(t *testing.T) {
+		err := run(context.Background(), exec.Command("false"))
+		assert.Error(t, err)
+	})
+
+	t.Run("hung helper", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		begin := time.Now()
+		err := run(ctx, exec.Command("sh", "-c", "sleep 10 & wait"))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(begin), 5*time.Second)
+	})
+}
@@ -0,0 +1,83 @@
+package ftpfs
+
+import (
+	"io"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpext"
+)
+
+// negotiateChecksum returns the checksum offered by the server, or nil when
+// transfers are checked by size only.
+func (f *FS) negotiateChecksum() *ftpext.Checksum {
+	f.checksumOnce.Do(func() {
+		features, err := f.features()
+		if err != nil {
+			f.logger.Warnf("unable to get ftp server features, checking transfers by size: %s", err.Error())
+			return
+		}
+
+		checksum, ok := ftpext.NegotiateChecksum(features)
+		if !ok {
+			f.logger.Infow("ftp server offers no checksum, checking transfers by size", "host", f.opts.FTP.Host)
+			return
+		}
+
+		f.logger.Debugw("verifying transfers by checksum", "host", f.opts.FTP.Host, "command", checksum.Command, "algorithm", checksum.Algorithm)
+		f.checksum = &checksum
+	})
+
+	return f.checksum
+}
+
+// features returns the features discovered by the driver, or asks the
+// server when they are unknown.
+func (f *FS) features() (features map[string]string, err error) {
+	if f.opts.Capabilities.Known() {
+		return f.opts.Capabilities.Features, nil
+	}
+
+	err = f.withConn(func(conn *ftp.ServerConn) (err error) {
+		features, err = ftpext.Features(f.conns.cmd(conn))
+		return err
+	})
+
+	return features, err
+}
+
+// verifyChecksum compares the checksum of the local copy in r with the one of
+// the remote file p. Only a mismatch is an error, a checksum the server
+// fails to compute leaves the size check of the transfer.
+func (f *FS) verifyChecksum(p string, r io.Reader) error {
+	if !f.opts.Checksum {
+		return nil
+	}
+
+	checksum := f.negotiateChecksum()
+	if checksum == nil {
+		return nil
+	}
+
+	local, err := checksum.Local(r)
+	if err != nil {
+		f.logger.Warnf("unable to compute checksum of local copy of '%s': %s", p, err.Error())
+		return nil
+	}
+
+	var remote string
+	err = f.withConn(func(conn *ftp.ServerConn) (err error) {
+		remote, err = checksum.Remote(f.conns.cmd(conn), p)
+		return err
+	})
+	if err != nil {
+		f.logger.Warnf("unable to get checksum of remote file '%s': %s", p, err.Error())
+		return nil
+	}
+
+	if local != remote {
+		f.logger.Errorw("checksum mismatch", "path", p, "algorithm", checksum.Algorithm, "local", local, "remote", remote)
+		return &ftpext.MismatchError{Path: p, Algorithm: checksum.Algorithm, Local: local, Remote: remote}
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package ftpfs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpext"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr/ftptest"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+func TestChecksum(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	server.SetFeatures(append(ftptest.DefaultFeatures, "HASH SHA-256*;MD5;CRC32")...)
+	server.WriteFile("/data/file.txt", []byte("content"))
+	server.WriteFile("/data/upload.txt", nil)
+
+	ctx := context.Background()
+
+	open := func(root *node, name string, flags uint32) (*handle, syscall.Errno) {
+		child, errno := root.Lookup(ctx, name, &fuse.EntryOut{})
+		require.Equal(t, syscall.Errno(0), errno)
+		root.AddChild(name, child, true)
+
+		fh, _, errno := child.Operations().(*node).Open(ctx, flags)
+		if errno != 0 {
+			return nil, errno
+		}
+
+		return fh.(*handle), 0
+	}
+
+	t.Run("verified download", func(t *testing.T) {
+		root := newTestFS(t, server, &Options{Checksum: true})
+		assert.Equal(t, "content", readFile(t, root, "file.txt"))
+		assert.NotNil(t, root.fsys.negotiateChecksum())
+	})
+
+	t.Run("corrupted download", func(t *testing.T) {
+		root := newTestFS(t, server, &Options{Checksum: true})
+		server.Corrupt("RETR", 1)
+
+		h, errno := open(root, "file.txt", syscall.O_RDONLY)
+		require.Equal(t, syscall.Errno(0), errno)
+		defer h.Release(ctx)
+
+		_, errno = h.Read(ctx, make([]byte, 64), 0)
+		assert.Equal(t, syscall.EIO, errno)
+
+		// the next read downloads the file again
+		res, errno := h.Read(ctx, make([]byte, 64), 0)
+		require.Equal(t, syscall.Errno(0), errno)
+		data, _ := res.Bytes(nil)
+		assert.Equal(t, "content", string(data))
+	})
+
+	t.Run("corrupted upload", func(t *testing.T) {
+		root := newTestFS(t, server, &Options{Checksum: true})
+		server.Corrupt("STOR", 1)
+
+		h, errno := open(root, "upload.txt", syscall.O_WRONLY|syscall.O_TRUNC)
+		require.Equal(t, syscall.Errno(0), errno)
+		_, errno = h.Write(ctx, []byte("uploaded"), 0)
+		require.Equal(t, syscall.Errno(0), errno)
+		require.Equal(t, syscall.Errno(0), h.Release(ctx))
+
+		err := root.fsys.Sync(ctx)
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "checksum")
+
+		data, _ := server.ReadFile("/data/upload.txt")
+		assert.Empty(t, data)
+		assert.False(t, server.Exists("/data/.upload.txt.partial"))
+	})
+
+	t.Run("discovered features", func(t *testing.T) {
+		caps := &models.ServerCapabilities{Features: map[string]string{"XMD5": ""}}
+		root := newTestFS(t, server, &Options{Checksum: true, Capabilities: caps})
+
+		assert.Equal(t, "content", readFile(t, root, "file.txt"))
+		assert.Equal(t, &ftpext.Checksum{Command: ftpext.CommandXMD5, Algorithm: "MD5"}, root.fsys.negotiateChecksum())
+	})
+
+	t.Run("size check only without checksum feature", func(t *testing.T) {
+		server.SetFeatures(ftptest.DefaultFeatures...)
+		root := newTestFS(t, server, &Options{Checksum: true})
+		server.Corrupt("RETR", 1)
+
+		// a corruption keeping the size goes unnoticed
+		data := readFile(t, root, "file.txt")
+		assert.Len(t, data, len("content"))
+		assert.NotEqual(t, "content", data)
+		assert.Nil(t, root.fsys.negotiateChecksum())
+	})
+}
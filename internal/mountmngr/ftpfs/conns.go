@@ -0,0 +1,189 @@
+package ftpfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpext"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/hostlimit"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+// connPool hands out logged in ftp connections, an ftp connection can only
+// run one command at a time while the kernel issues requests concurrently.
+// Every open connection holds a session of the host limiter, the limiter
+// closes idle ones when it runs out of sessions.
+type connPool struct {
+	opt         *models.FTPConnectionOpt
+	caps        *models.ServerCapabilities
+	dialTimeout time.Duration
+	limiter     *hostlimit.Limiter
+	idle        chan idleConn
+	slot        chan struct{}
+
+	mu       sync.Mutex
+	sessions []func()
+	// netConns are the control connections of the open connections, for the
+	// commands the ftp client library does not expose.
+	netConns map[*ftp.ServerConn]net.Conn
+}
+
+// idleConn is a pooled connection together with the function taking its
+// host session back from the limiter.
+type idleConn struct {
+	conn  *ftp.ServerConn
+	reuse func() bool
+}
+
+func newConnPool(opt *models.FTPConnectionOpt, caps *models.ServerCapabilities, size int, dialTimeout time.Duration, limiter *hostlimit.Limiter) *connPool {
+	return &connPool{
+		opt:         opt,
+		caps:        caps,
+		dialTimeout: dialTimeout,
+		limiter:     limiter,
+		idle:        make(chan idleConn, size),
+		slot:        make(chan struct{}, size),
+		netConns:    make(map[*ftp.ServerConn]net.Conn),
+	}
+}
+
+func (p *connPool) get() (*ftp.ServerConn, error) {
+	p.slot <- struct{}{}
+
+	if conn := p.takeIdle(); conn != nil {
+		return conn, nil
+	}
+
+	session, err := p.limiter.Acquire(context.Background(), p.opt)
+	if err != nil {
+		<-p.slot
+		return nil, fmt.Errorf("failed hostlimit.Acquire in ftpfs.connPool.get: %w", err)
+	}
+
+	timeout := ftp.DefaultDialTimeout
+	if p.dialTimeout > 0 {
+		timeout = p.dialTimeout
+	}
+
+	// the control connection is kept for the raw commands
+	var netConn net.Conn
+	dial := func(network, address string) (net.Conn, error) {
+		var err error
+		netConn, err = net.DialTimeout(network, address, timeout)
+		return netConn, err
+	}
+
+	options := []ftp.DialOption{ftp.DialWithDialFunc(dial)}
+	if p.dialTimeout > 0 {
+		options = append(options, ftp.DialWithTimeout(p.dialTimeout))
+	}
+
+	// skip the commands the server is known to refuse instead of failing
+	// over on every connection
+	if p.caps.Lacks(models.FeatureEPSV) {
+		options = append(options, ftp.DialWithDisabledEPSV(true))
+	}
+	if p.caps.Lacks(models.FeatureMLST) {
+		options = append(options, ftp.DialWithDisabledMLSD(true))
+	}
+
+	conn, err := ftp.Dial(fmt.Sprintf("%s:%d", p.opt.Host, p.opt.Port), options...)
+	if err != nil {
+		session()
+		<-p.slot
+		return nil, fmt.Errorf("unable to connect to ftp server in ftpfs.connPool.get: %w", err)
+	}
+
+	if err := conn.Login(p.opt.User, p.opt.Password); err != nil {
+		_ = conn.Quit()
+		session()
+		<-p.slot
+		return nil, fmt.Errorf("unable to login to ftp server in ftpfs.connPool.get: %w", err)
+	}
+
+	p.mu.Lock()
+	p.sessions = append(p.sessions, session)
+	p.netConns[conn] = netConn
+	p.mu.Unlock()
+
+	return conn, nil
+}
+
+// cmd returns a function sending raw commands on the control connection of
+// conn, which must be held and idle.
+func (p *connPool) cmd(conn *ftp.ServerConn) ftpext.Cmd {
+	p.mu.Lock()
+	netConn := p.netConns[conn]
+	p.mu.Unlock()
+
+	return ftpext.Raw(netConn)
+}
+
+// put returns the connection to the pool. Connections which failed with
+// something else than an ftp reply are closed.
+func (p *connPool) put(conn *ftp.ServerConn, err error) {
+	defer func() { <-p.slot }()
+
+	var protoErr *textproto.Error
+	if err != nil && !errors.As(err, &protoErr) {
+		p.quit(conn)
+		return
+	}
+
+	idle := idleConn{conn: conn, reuse: p.limiter.Idle(p.opt, func() { p.quit(conn) })}
+
+	select {
+	case p.idle <- idle:
+	default:
+		if idle.reuse() {
+			p.quit(conn)
+		}
+	}
+}
+
+// takeIdle returns an idle connection, skipping the ones closed by the host
+// limiter, or nil if there is none.
+func (p *connPool) takeIdle() *ftp.ServerConn {
+	for {
+		select {
+		case idle := <-p.idle:
+			if idle.reuse() {
+				return idle.conn
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// quit closes the connection and gives a host session back, the sessions of
+// the pool are interchangeable.
+func (p *connPool) quit(conn *ftp.ServerConn) {
+	_ = conn.Quit()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.netConns, conn)
+
+	if n := len(p.sessions); n != 0 {
+		p.sessions[n-1]()
+		p.sessions = p.sessions[:n-1]
+	}
+}
+
+func (p *connPool) close() {
+	for {
+		conn := p.takeIdle()
+		if conn == nil {
+			return
+		}
+		p.quit(conn)
+	}
+}
@@ -0,0 +1,430 @@
+// Package ftpfs implements a FUSE file system backed by an ftp server.
+//
+// Directory listings are cached for a short time. Files are spooled to a
+// local file while they are open and written back to the server in the
+// background once they are closed.
+package ftpfs
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/jlaffaye/ftp"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/charset"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/filecache"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpext"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/hostlimit"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/resume"
+	pkgLogger "github.com/t1d333/docker-volume-ftp-driver/pkg/logger"
+)
+
+const (
+	cacheTimeout = time.Second
+	poolSize     = 4
+	blockSize    = 4096
+)
+
+type Options struct {
+	RemotePath string
+	FTP        models.FTPConnectionOpt
+	// SpoolDir holds the local copies of the open files and of the files
+	// waiting to be written back.
+	SpoolDir string
+	// Quota limits the bytes stored by the volume, 0 means no limit.
+	Quota int64
+	Usage *models.QuotaUsage
+	// DialTimeout bounds connecting to the ftp server, 0 keeps the default of
+	// the ftp client.
+	DialTimeout time.Duration
+	// Limiter caps the sessions per ftp server, it may be nil.
+	Limiter *hostlimit.Limiter
+	// Cache keeps downloaded files across opens and mounts, it may be nil.
+	Cache *filecache.Cache
+	// Retry is the policy of the downloads and of the uploads written back to
+	// the server. Interrupted transfers are resumed under it.
+	Retry models.RetryPolicy
+	// PartialPattern names the temporary files of the uploads, empty uses
+	// models.DefaultPartialPattern.
+	PartialPattern string
+	// Checksum verifies the transfers with a checksum of the server when it
+	// offers one, transfers are always checked by size.
+	Checksum bool
+	// Capabilities are the features of the server discovered by the driver,
+	// nil when they are unknown and probed on demand.
+	Capabilities *models.ServerCapabilities
+	// Encoding transcodes the names of the files to the encoding of the
+	// server, nil keeps them unchanged.
+	Encoding *charset.Codec
+	// Location is the time zone of the times listed by servers without
+	// MLSD, nil is UTC.
+	Location *time.Location
+}
+
+type FS struct {
+	opts   *Options
+	logger pkgLogger.Logger
+	conns  *connPool
+
+	mu   sync.Mutex
+	dirs map[string]*dirListing
+	// precise reports whether the listings carry exact modification times,
+	// only then a changed file can be told from the cached one.
+	precise bool
+	// mdtm reports whether the server tells exact modification times of
+	// files, times holds them when the listings do not.
+	mdtm  bool
+	times map[string]modTime
+	// uploads holds the latest pending upload of each file, failed the errors
+	// of the uploads which gave up since the last Sync.
+	uploads map[string]*pendingUpload
+	failed  map[string]error
+	pending sync.WaitGroup
+
+	// checksum is the checksum the server offers, asked for once.
+	checksumOnce sync.Once
+	checksum     *ftpext.Checksum
+}
+
+// modTime is the modification time of a file told by MDTM, valid while the
+// file is listed with the same size and time.
+type modTime struct {
+	size   uint64
+	listed time.Time
+	mtime  time.Time
+}
+
+type dirListing struct {
+	entries map[string]*ftp.Entry
+	expires time.Time
+}
+
+func New(opts *Options, logger pkgLogger.Logger) *FS {
+	if opts.Usage == nil {
+		opts.Usage = new(models.QuotaUsage)
+	}
+
+	if opts.PartialPattern == "" {
+		opts.PartialPattern = models.DefaultPartialPattern
+	}
+
+	return &FS{
+		opts:    opts,
+		logger:  logger,
+		conns:   newConnPool(&opts.FTP, opts.Capabilities, poolSize, opts.DialTimeout, opts.Limiter),
+		dirs:    make(map[string]*dirListing),
+		times:   make(map[string]modTime),
+		uploads: make(map[string]*pendingUpload),
+		failed:  make(map[string]error),
+	}
+}
+
+// Root returns the root node of the file system.
+func (f *FS) Root() fs.InodeEmbedder {
+	return &node{fsys: f}
+}
+
+// Close releases the ftp connections of the file system. Pending uploads
+// are waited for with Sync before.
+func (f *FS) Close() {
+	f.conns.close()
+}
+
+// Mount mounts the file system at mountpoint. The returned server serves
+// requests until it is unmounted. Files an earlier mount failed to write back
+// are uploaded again.
+func Mount(mountpoint string, f *FS) (*fuse.Server, error) {
+	if err := os.MkdirAll(f.opts.SpoolDir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create spool directory in ftpfs.Mount: %w", err)
+	}
+
+	timeout := cacheTimeout
+	server, err := fs.Mount(mountpoint, f.Root(), &fs.Options{
+		MountOptions: fuse.MountOptions{
+			AllowOther:  true,
+			FsName:      fmt.Sprintf("%s:%d%s", f.opts.FTP.Host, f.opts.FTP.Port, f.opts.RemotePath),
+			Name:        "ftpfs",
+			DirectMount: true,
+		},
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to mount file system in ftpfs.Mount: %w", err)
+	}
+
+	if err := f.requeueSpools(); err != nil {
+		f.logger.Errorf("unable to write back files left by an earlier mount: %s", err.Error())
+	}
+
+	return server, nil
+}
+
+// remotePath returns the path on the server of the file rel of the mount.
+func (f *FS) remotePath(rel string) string {
+	// the names of the inodes were encoded when they were looked up or
+	// created, this does not fail
+	if encoded, err := f.opts.Encoding.Encode(rel); err == nil {
+		rel = encoded
+	}
+
+	return path.Join("/", f.opts.RemotePath, rel)
+}
+
+// childPath returns the path on the server of the file name in the remote
+// dir. Names with characters the encoding of the server lacks have none.
+func (f *FS) childPath(dir, name string) (string, error) {
+	encoded, err := f.opts.Encoding.Encode(name)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(dir, encoded), nil
+}
+
+// withConn runs fn with a pooled ftp connection.
+func (f *FS) withConn(fn func(conn *ftp.ServerConn) error) error {
+	conn, err := f.conns.get()
+	if err != nil {
+		f.logger.Errorf("unable to get ftp connection: %s", err.Error())
+		return err
+	}
+
+	err = fn(conn)
+	f.conns.put(conn, err)
+
+	return err
+}
+
+// with runs fn with a pooled ftp connection for the resumable transfers.
+func (f *FS) with(fn func(conn resume.Conn) error) error {
+	return f.withConn(func(conn *ftp.ServerConn) error { return fn(conn) })
+}
+
+// logTransfer logs a completed or failed transfer of the remote file p.
+func (f *FS) logTransfer(transfer, p string, stats resume.Stats) {
+	if stats.Resumes > 0 {
+		f.logger.Infow("resumed interrupted "+transfer, "path", p, "bytes", stats.Bytes, "resumes", stats.Resumes)
+		return
+	}
+
+	f.logger.Debugw(transfer+" finished", "path", p, "bytes", stats.Bytes)
+}
+
+// list returns the entries of the remote directory dir by the names of the
+// mount.
+func (f *FS) list(dir string) (map[string]*ftp.Entry, error) {
+	f.mu.Lock()
+	listing, ok := f.dirs[dir]
+	f.mu.Unlock()
+
+	if ok && time.Now().Before(listing.expires) {
+		return listing.entries, nil
+	}
+
+	var (
+		entries []*ftp.Entry
+		precise bool
+		mdtm    bool
+	)
+	err := f.withConn(func(conn *ftp.ServerConn) error {
+		var err error
+		entries, err = conn.List(dir)
+		precise = conn.IsTimePreciseInList()
+		mdtm = conn.IsGetTimeSupported()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*ftp.Entry, len(entries))
+	for _, entry := range entries {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+
+		// a name which does not decode could not be found again
+		name, err := f.opts.Encoding.Decode(entry.Name)
+		if err != nil {
+			f.logger.Warnw("skipping remote file with name not in server encoding", "dir", dir, "encoding", f.opts.Encoding.Name(), "error", err)
+			continue
+		}
+
+		// LIST tells the wall clock of the server, MLSD is in UTC
+		if !precise && f.opts.Location != nil {
+			entry.Time = inLocation(entry.Time, f.opts.Location)
+		}
+		res[name] = entry
+	}
+
+	f.mu.Lock()
+	f.dirs[dir] = &dirListing{entries: res, expires: time.Now().Add(cacheTimeout)}
+	f.precise = precise
+	f.mdtm = mdtm
+	f.mu.Unlock()
+
+	return res, nil
+}
+
+// stat returns the entry of the remote file p.
+func (f *FS) stat(p string) (*ftp.Entry, error) {
+	entries, err := f.list(path.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := f.opts.Encoding.Decode(path.Base(p))
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	entry, ok := entries[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return f.overlay(p, f.exactTime(p, entry)), nil
+}
+
+// exactTime returns entry with the modification time told by MDTM when the
+// listings only tell the minute or the day. MDTM is asked again only when the
+// listed size or time of the file changes.
+func (f *FS) exactTime(p string, entry *ftp.Entry) *ftp.Entry {
+	if entry.Type != ftp.EntryTypeFile {
+		return entry
+	}
+
+	f.mu.Lock()
+	precise, mdtm := f.precise, f.mdtm
+	known, ok := f.times[p]
+	f.mu.Unlock()
+
+	if precise || !mdtm {
+		return entry
+	}
+
+	if !ok || known.size != entry.Size || !known.listed.Equal(entry.Time) {
+		var mtime time.Time
+		err := f.withConn(func(conn *ftp.ServerConn) (err error) {
+			mtime, err = conn.GetTime(p)
+			return err
+		})
+		if err != nil {
+			// the listed time is kept until the file changes
+			f.logger.Debugf("unable to get modification time of remote file '%s': %s", p, err.Error())
+			mtime = entry.Time
+		}
+
+		known = modTime{size: entry.Size, listed: entry.Time, mtime: mtime}
+
+		f.mu.Lock()
+		f.times[p] = known
+		f.mu.Unlock()
+	}
+
+	res := *entry
+	res.Time = known.mtime
+
+	return &res
+}
+
+// cacheKey returns the cache key of the remote file p, or false when the file
+// can not be cached.
+func (f *FS) cacheKey(p string) (filecache.Key, bool) {
+	if !f.opts.Cache.Enabled() {
+		return filecache.Key{}, false
+	}
+
+	entry, err := f.stat(p)
+	if err != nil || entry.Type != ftp.EntryTypeFile {
+		return filecache.Key{}, false
+	}
+
+	f.mu.Lock()
+	precise := f.precise
+	f.mu.Unlock()
+
+	if !precise {
+		return filecache.Key{}, false
+	}
+
+	return filecache.Key{FTP: &f.opts.FTP, Path: p, Size: int64(entry.Size), ModTime: entry.Time}, true
+}
+
+// invalidate drops the listings and the modification times of the remote
+// paths.
+func (f *FS) invalidate(paths ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, p := range paths {
+		delete(f.dirs, p)
+		delete(f.times, p)
+	}
+}
+
+// reserve accounts delta bytes in the volume usage and refuses growth past
+// the quota.
+func (f *FS) reserve(delta int64) bool {
+	return f.opts.Usage.Reserve(delta, f.opts.Quota)
+}
+
+// inLocation returns the wall clock of t, parsed as UTC, in loc.
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+func fillAttr(entry *ftp.Entry, out *fuse.Attr) {
+	if entry.Type == ftp.EntryTypeFolder {
+		out.Mode = syscall.S_IFDIR | 0755
+		out.Nlink = 2
+	} else {
+		out.Mode = syscall.S_IFREG | 0644
+		out.Nlink = 1
+		out.Size = entry.Size
+	}
+
+	out.Blocks = (out.Size + 511) / 512
+	out.Blksize = blockSize
+	out.SetTimes(&entry.Time, &entry.Time, &entry.Time)
+}
+
+func entryMode(entry *ftp.Entry) uint32 {
+	if entry.Type == ftp.EntryTypeFolder {
+		return syscall.S_IFDIR
+	}
+
+	return syscall.S_IFREG
+}
+
+// toErrno maps an ftp error to the closest errno.
+func toErrno(err error) syscall.Errno {
+	if err == nil {
+		return 0
+	}
+
+	if errors.Is(err, os.ErrNotExist) {
+		return syscall.ENOENT
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		switch protoErr.Code {
+		case ftp.StatusExceededStorage:
+			return syscall.ENOSPC
+		case ftp.StatusFileUnavailable, ftp.StatusBadFileName:
+			return syscall.EACCES
+		}
+	}
+
+	return syscall.EIO
+}
@@ -0,0 +1,570 @@
+package ftpfs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/charset"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/filecache"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr/ftptest"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/hostlimit"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"go.uber.org/zap"
+)
+
+// newTestFS returns the root node of a file system which is not mounted, its
+// operations are called directly. opts is completed with the server and a
+// spool directory.
+func newTestFS(t *testing.T, server *ftptest.Server, opts *Options) *node {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+
+	opts.RemotePath = "/data"
+	opts.FTP = *server.Opt()
+	opts.SpoolDir = t.TempDir()
+
+	fsys := New(opts, log.Sugar())
+	t.Cleanup(fsys.Close)
+
+	root := fsys.Root()
+	fs.NewNodeFS(root, &fs.Options{})
+
+	return root.(*node)
+}
+
+func writeFile(t *testing.T, root *node, name string, data []byte) syscall.Errno {
+	ctx := context.Background()
+
+	child, fh, _, errno := root.Create(ctx, name, syscall.O_WRONLY|syscall.O_CREAT, 0644, &fuse.EntryOut{})
+	require.Equal(t, syscall.Errno(0), errno)
+
+	// the kernel bridge links returned inodes to their parent
+	root.AddChild(name, child, true)
+
+	h := fh.(*handle)
+	defer h.Release(ctx)
+
+	if _, errno := h.Write(ctx, data, 0); errno != 0 {
+		return errno
+	}
+
+	if errno := h.Flush(ctx); errno != 0 {
+		return errno
+	}
+
+	// the file is written back in the background
+	require.Nil(t, root.fsys.Sync(ctx))
+
+	return 0
+}
+
+func TestReadWrite(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	server.WriteFile("/data/existing.txt", []byte("hello"))
+
+	ctx := context.Background()
+	root := newTestFS(t, server, &Options{})
+
+	t.Run("read existing file", func(t *testing.T) {
+		child, errno := root.Lookup(ctx, "existing.txt", &fuse.EntryOut{})
+		require.Equal(t, syscall.Errno(0), errno)
+		root.AddChild("existing.txt", child, true)
+
+		fh, _, errno := child.Operations().(*node).Open(ctx, syscall.O_RDONLY)
+		require.Equal(t, syscall.Errno(0), errno)
+		defer fh.(*handle).Release(ctx)
+
+		res, errno := fh.(*handle).Read(ctx, make([]byte, 16), 0)
+		require.Equal(t, syscall.Errno(0), errno)
+
+		data, _ := res.Bytes(nil)
+		assert.Equal(t, "hello", string(data))
+	})
+
+	t.Run("write new file", func(t *testing.T) {
+		errno := writeFile(t, root, "new.txt", []byte("world"))
+		require.Equal(t, syscall.Errno(0), errno)
+
+		data, ok := server.ReadFile("/data/new.txt")
+		require.True(t, ok)
+		assert.Equal(t, "world", string(data))
+	})
+
+	t.Run("lookup not existing file", func(t *testing.T) {
+		_, errno := root.Lookup(ctx, "notExists", &fuse.EntryOut{})
+		assert.Equal(t, syscall.ENOENT, errno)
+	})
+}
+
+func TestQuota(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	server.MkdirAll("/data")
+
+	ctx := context.Background()
+	usage := new(models.QuotaUsage)
+	root := newTestFS(t, server, &Options{Quota: 100, Usage: usage})
+
+	t.Run("write within quota", func(t *testing.T) {
+		errno := writeFile(t, root, "a.bin", make([]byte, 60))
+		require.Equal(t, syscall.Errno(0), errno)
+		assert.Equal(t, int64(60), usage.Used())
+	})
+
+	t.Run("write beyond quota", func(t *testing.T) {
+		errno := writeFile(t, root, "b.bin", make([]byte, 60))
+		assert.Equal(t, syscall.ENOSPC, errno)
+		assert.Equal(t, int64(60), usage.Used())
+	})
+
+	t.Run("statfs reports quota", func(t *testing.T) {
+		out := &fuse.StatfsOut{}
+		require.Equal(t, syscall.Errno(0), root.Statfs(ctx, out))
+		assert.Equal(t, uint64(100/blockSize), out.Blocks)
+	})
+
+	t.Run("unlink frees quota", func(t *testing.T) {
+		require.Equal(t, syscall.Errno(0), root.Unlink(ctx, "a.bin"))
+		assert.Equal(t, int64(0), usage.Used())
+		assert.False(t, server.Exists("/data/a.bin"))
+
+		errno := writeFile(t, root, "c.bin", make([]byte, 90))
+		require.Equal(t, syscall.Errno(0), errno)
+		assert.Equal(t, int64(90), usage.Used())
+	})
+
+	t.Run("handles of a file share its size", func(t *testing.T) {
+		child, errno := root.Lookup(ctx, "c.bin", &fuse.EntryOut{})
+		require.Equal(t, syscall.Errno(0), errno)
+		root.AddChild("c.bin", child, true)
+		n := child.Operations().(*node)
+
+		for i := 0; i < 2; i++ {
+			fh, _, errno := n.Open(ctx, syscall.O_RDWR)
+			require.Equal(t, syscall.Errno(0), errno)
+			defer fh.(*handle).Release(ctx)
+
+			_, errno = fh.(*handle).Write(ctx, make([]byte, 5), 90)
+			require.Equal(t, syscall.Errno(0), errno)
+		}
+
+		assert.Equal(t, int64(95), usage.Used())
+	})
+}
+
+func readFile(t *testing.T, root *node, name string) string {
+	ctx := context.Background()
+
+	child, errno := root.Lookup(ctx, name, &fuse.EntryOut{})
+	require.Equal(t, syscall.Errno(0), errno)
+	root.AddChild(name, child, true)
+
+	fh, _, errno := child.Operations().(*node).Open(ctx, syscall.O_RDONLY)
+	require.Equal(t, syscall.Errno(0), errno)
+	defer fh.(*handle).Release(ctx)
+
+	res, errno := fh.(*handle).Read(ctx, make([]byte, 64), 0)
+	require.Equal(t, syscall.Errno(0), errno)
+
+	data, _ := res.Bytes(nil)
+
+	return string(data)
+}
+
+func TestCache(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	server.WriteFile("/data/cached.txt", []byte("hello"))
+
+	cache, err := filecache.New(&filecache.Options{Dir: t.TempDir(), MaxSize: 1 << 20})
+	require.Nil(t, err)
+
+	t.Run("miss downloads and caches", func(t *testing.T) {
+		root := newTestFS(t, server, &Options{Cache: cache})
+
+		assert.Equal(t, "hello", readFile(t, root, "cached.txt"))
+		assert.Equal(t, filecache.Stats{Entries: 1, Size: 5, MaxSize: 1 << 20, Misses: 1}, cache.Stats())
+	})
+
+	t.Run("hit survives remount", func(t *testing.T) {
+		root := newTestFS(t, server, &Options{Cache: cache})
+
+		assert.Equal(t, "hello", readFile(t, root, "cached.txt"))
+		assert.Equal(t, int64(1), cache.Stats().Hits)
+	})
+
+	t.Run("changed file is downloaded again", func(t *testing.T) {
+		server.WriteFile("/data/cached.txt", []byte("hello world"))
+		root := newTestFS(t, server, &Options{Cache: cache})
+
+		assert.Equal(t, "hello world", readFile(t, root, "cached.txt"))
+		assert.Equal(t, int64(2), cache.Stats().Misses)
+	})
+
+	t.Run("imprecise listings are not cached", func(t *testing.T) {
+		server.SetFeatures()
+		defer server.SetFeatures(ftptest.DefaultFeatures...)
+
+		root := newTestFS(t, server, &Options{Cache: cache})
+		before := cache.Stats()
+
+		assert.Equal(t, "hello world", readFile(t, root, "cached.txt"))
+		assert.Equal(t, before, cache.Stats())
+	})
+}
+
+func TestCapabilities(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	server.WriteFile("/data/file.txt", []byte("hello"))
+
+	t.Run("unknown features", func(t *testing.T) {
+		root := newTestFS(t, server, &Options{})
+
+		assert.Equal(t, "hello", readFile(t, root, "file.txt"))
+		assert.True(t, root.fsys.precise)
+	})
+
+	t.Run("server without epsv and mlsd", func(t *testing.T) {
+		caps := &models.ServerCapabilities{Features: map[string]string{"SIZE": ""}}
+		root := newTestFS(t, server, &Options{Capabilities: caps})
+
+		// MLSD is not sent, the listing falls back to LIST
+		server.Fail("MLSD", 1)
+		defer server.Fail("MLSD", 0)
+
+		assert.Equal(t, "hello", readFile(t, root, "file.txt"))
+		assert.False(t, root.fsys.precise)
+	})
+}
+
+func TestHostLimit(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	server.WriteFile("/data/file.txt", []byte("hello"))
+
+	limiter := hostlimit.New(&hostlimit.Options{MaxSessions: 1, WaitTimeout: 50 * time.Millisecond})
+	root := newTestFS(t, server, &Options{Limiter: limiter})
+
+	assert.Equal(t, "hello", readFile(t, root, "file.txt"))
+	assert.Equal(t, hostlimit.Stats{Active: 1}, limiter.Stats(server.Opt()))
+
+	// the idle connection of the mount is closed for another session
+	session, err := limiter.Acquire(context.Background(), server.Opt())
+	require.Nil(t, err)
+	assert.Equal(t, hostlimit.Stats{Active: 1}, limiter.Stats(server.Opt()))
+	session()
+
+	assert.Equal(t, "hello", readFile(t, root, "file.txt"))
+	assert.Equal(t, 2, server.Accepted())
+}
+
+func TestEncoding(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	// "Отчёт.txt" and "Папка" in windows-1251, 0x98 is undefined in it
+	server.WriteFile("/data/\xce\xf2\xf7\xb8\xf2.txt", []byte("hello"))
+	server.MkdirAll("/data/\xcf\xe0\xef\xea\xe0")
+	server.WriteFile("/data/a\x98b", []byte("unreachable"))
+
+	codec, err := charset.New("cp1251")
+	require.Nil(t, err)
+
+	ctx := context.Background()
+	root := newTestFS(t, server, &Options{Encoding: codec})
+
+	t.Run("list decoded names", func(t *testing.T) {
+		stream, errno := root.Readdir(ctx)
+		require.Equal(t, syscall.Errno(0), errno)
+
+		var names []string
+		for stream.HasNext() {
+			entry, _ := stream.Next()
+			names = append(names, entry.Name)
+		}
+		assert.ElementsMatch(t, []string{"Отчёт.txt", "Папка"}, names)
+	})
+
+	t.Run("read file", func(t *testing.T) {
+		assert.Equal(t, "hello", readFile(t, root, "Отчёт.txt"))
+	})
+
+	t.Run("write file", func(t *testing.T) {
+		errno := writeFile(t, root, "Новый.txt", []byte("world"))
+		require.Equal(t, syscall.Errno(0), errno)
+
+		data, ok := server.ReadFile("/data/\xcd\xee\xe2\xfb\xe9.txt")
+		require.True(t, ok)
+		assert.Equal(t, "world", string(data))
+	})
+
+	t.Run("rename file", func(t *testing.T) {
+		errno := root.Rename(ctx, "Новый.txt", root, "Старый.txt", 0)
+		require.Equal(t, syscall.Errno(0), errno)
+
+		assert.False(t, server.Exists("/data/\xcd\xee\xe2\xfb\xe9.txt"))
+		assert.True(t, server.Exists("/data/\xd1\xf2\xe0\xf0\xfb\xe9.txt"))
+	})
+
+	t.Run("name not in server encoding", func(t *testing.T) {
+		_, _, _, errno := root.Create(ctx, "日本.txt", syscall.O_WRONLY|syscall.O_CREAT, 0644, &fuse.EntryOut{})
+		assert.Equal(t, syscall.EILSEQ, errno)
+
+		_, errno = root.Mkdir(ctx, "日本", 0755, &fuse.EntryOut{})
+		assert.Equal(t, syscall.EILSEQ, errno)
+
+		_, errno = root.Lookup(ctx, "日本.txt", &fuse.EntryOut{})
+		assert.Equal(t, syscall.ENOENT, errno)
+	})
+}
+
+func TestModTime(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	zone := time.FixedZone("+03:00", 3*60*60)
+	server.SetLocation(zone)
+
+	recent := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	old := time.Now().AddDate(-1, 0, 0).Truncate(time.Second)
+	server.WriteFile("/data/recent.txt", []byte("recent"))
+	server.SetModTime("/data/recent.txt", recent)
+	server.WriteFile("/data/old.txt", []byte("old"))
+	server.SetModTime("/data/old.txt", old)
+
+	lookup := func(root *node, name string) time.Time {
+		out := &fuse.EntryOut{}
+		_, errno := root.Lookup(context.Background(), name, out)
+		require.Equal(t, syscall.Errno(0), errno)
+
+		return time.Unix(int64(out.Mtime), 0)
+	}
+
+	t.Run("mlsd times are exact", func(t *testing.T) {
+		root := newTestFS(t, server, &Options{Location: zone})
+
+		assert.Equal(t, recent, lookup(root, "recent.txt"))
+		assert.Equal(t, old, lookup(root, "old.txt"))
+	})
+
+	t.Run("list times in server zone", func(t *testing.T) {
+		server.SetFeatures("EPSV", "SIZE", "UTF8")
+		defer server.SetFeatures(ftptest.DefaultFeatures...)
+
+		root := newTestFS(t, server, &Options{Location: zone})
+		assert.Equal(t, recent, lookup(root, "recent.txt"))
+
+		// without the zone the wall clock of the server is taken as UTC
+		root = newTestFS(t, server, &Options{})
+		assert.Equal(t, recent.Add(3*time.Hour), lookup(root, "recent.txt"))
+	})
+
+	t.Run("mdtm refines list times", func(t *testing.T) {
+		server.SetFeatures("EPSV", "MDTM", "SIZE", "UTF8")
+		defer server.SetFeatures(ftptest.DefaultFeatures...)
+
+		root := newTestFS(t, server, &Options{})
+		assert.Equal(t, recent, lookup(root, "recent.txt"))
+		assert.Equal(t, old, lookup(root, "old.txt"))
+
+		// a changed file is asked for again
+		server.SetModTime("/data/old.txt", old.Add(-24*time.Hour))
+		root.fsys.invalidate("/data")
+		assert.Equal(t, old.Add(-24*time.Hour), lookup(root, "old.txt"))
+	})
+}
+
+func TestWriteBack(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	server.WriteFile("/data/kept.txt", []byte("old"))
+
+	ctx := context.Background()
+	policy := models.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Codes: []int{426}}
+	root := newTestFS(t, server, &Options{Retry: policy})
+
+	write := func(name string, data []byte) *handle {
+		child, errno := root.Lookup(ctx, name, &fuse.EntryOut{})
+		require.Equal(t, syscall.Errno(0), errno)
+		root.AddChild(name, child, true)
+
+		fh, _, errno := child.Operations().(*node).Open(ctx, syscall.O_WRONLY|syscall.O_TRUNC)
+		require.Equal(t, syscall.Errno(0), errno)
+
+		h := fh.(*handle)
+		_, errno = h.Write(ctx, data, 0)
+		require.Equal(t, syscall.Errno(0), errno)
+		require.Equal(t, syscall.Errno(0), h.Flush(ctx))
+
+		return h
+	}
+
+	t.Run("failed transfer is retried", func(t *testing.T) {
+		server.Fail("STOR", 1)
+		server.WriteFile("/data/retried.txt", nil)
+
+		h := write("retried.txt", []byte("content"))
+		require.Equal(t, syscall.Errno(0), h.Release(ctx))
+
+		// the pending upload is visible before it is written back
+		assert.Equal(t, "content", readFile(t, root, "retried.txt"))
+
+		require.Nil(t, root.fsys.Sync(ctx))
+
+		data, ok := server.ReadFile("/data/retried.txt")
+		require.True(t, ok)
+		assert.Equal(t, "content", string(data))
+		assert.False(t, server.Exists("/data/.retried.txt.partial"))
+	})
+
+	t.Run("failed upload keeps the remote file", func(t *testing.T) {
+		server.Fail("STOR", 3)
+
+		h := write("kept.txt", []byte("new content"))
+		defer h.Release(ctx)
+
+		assert.Equal(t, syscall.EIO, h.Fsync(ctx, 0))
+
+		err := root.fsys.Sync(ctx)
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "/data/kept.txt")
+
+		data, ok := server.ReadFile("/data/kept.txt")
+		require.True(t, ok)
+		assert.Equal(t, "old", string(data))
+		assert.False(t, server.Exists("/data/.kept.txt.partial"))
+
+		// the failure is reported once
+		assert.Nil(t, root.fsys.Sync(ctx))
+	})
+
+	t.Run("failed upload is written back on the next mount", func(t *testing.T) {
+		server.Fail("STOR", 3)
+
+		h := write("kept.txt", []byte("newer content"))
+		require.Equal(t, syscall.Errno(0), h.Release(ctx))
+		require.NotNil(t, root.fsys.Sync(ctx))
+
+		// the spool of a file which was never closed is dropped
+		spoolDir := root.fsys.opts.SpoolDir
+		require.Nil(t, os.WriteFile(filepath.Join(spoolDir, "spool-open"), []byte("open"), 0600))
+
+		next := New(&Options{RemotePath: "/data", FTP: *server.Opt(), SpoolDir: spoolDir, Retry: policy}, root.fsys.logger)
+		defer next.Close()
+
+		require.Nil(t, next.requeueSpools())
+		require.Nil(t, next.Sync(ctx))
+
+		// the spools are written back in the order they were closed
+		data, ok := server.ReadFile("/data/kept.txt")
+		require.True(t, ok)
+		assert.Equal(t, "newer content", string(data))
+
+		entries, err := os.ReadDir(spoolDir)
+		require.Nil(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("partial pattern", func(t *testing.T) {
+		root := newTestFS(t, server, &Options{PartialPattern: "{name}.upload"})
+		server.WriteFile("/data/pattern.txt", nil)
+		// keep the temporary file of a failed rename
+		server.Fail("RNTO", 1)
+		server.Fail("DELE", 1)
+
+		child, errno := root.Lookup(ctx, "pattern.txt", &fuse.EntryOut{})
+		require.Equal(t, syscall.Errno(0), errno)
+		root.AddChild("pattern.txt", child, true)
+
+		fh, _, errno := child.Operations().(*node).Open(ctx, syscall.O_WRONLY|syscall.O_TRUNC)
+		require.Equal(t, syscall.Errno(0), errno)
+		_, errno = fh.(*handle).Write(ctx, []byte("content"), 0)
+		require.Equal(t, syscall.Errno(0), errno)
+		require.Equal(t, syscall.Errno(0), fh.(*handle).Release(ctx))
+
+		require.NotNil(t, root.fsys.Sync(ctx))
+
+		data, _ := server.ReadFile("/data/pattern.txt.upload")
+		assert.Equal(t, "content", string(data))
+		data, _ = server.ReadFile("/data/pattern.txt")
+		assert.Empty(t, data)
+	})
+}
+
+func TestResume(t *testing.T) {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	defer server.Close()
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	server.WriteFile("/data/large.bin", content)
+	server.WriteFile("/data/upload.bin", nil)
+
+	ctx := context.Background()
+	policy := models.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Codes: []int{426}}
+	root := newTestFS(t, server, &Options{Retry: policy})
+
+	t.Run("interrupted download", func(t *testing.T) {
+		server.Interrupt("RETR", 4096)
+
+		child, errno := root.Lookup(ctx, "large.bin", &fuse.EntryOut{})
+		require.Equal(t, syscall.Errno(0), errno)
+		root.AddChild("large.bin", child, true)
+
+		fh, _, errno := child.Operations().(*node).Open(ctx, syscall.O_RDONLY)
+		require.Equal(t, syscall.Errno(0), errno)
+		defer fh.(*handle).Release(ctx)
+
+		res, errno := fh.(*handle).Read(ctx, make([]byte, len(content)), 0)
+		require.Equal(t, syscall.Errno(0), errno)
+
+		data, _ := res.Bytes(nil)
+		assert.Equal(t, content, data)
+	})
+
+	t.Run("interrupted upload", func(t *testing.T) {
+		server.Interrupt("STOR", 4096)
+
+		child, errno := root.Lookup(ctx, "upload.bin", &fuse.EntryOut{})
+		require.Equal(t, syscall.Errno(0), errno)
+		root.AddChild("upload.bin", child, true)
+
+		fh, _, errno := child.Operations().(*node).Open(ctx, syscall.O_WRONLY|syscall.O_TRUNC)
+		require.Equal(t, syscall.Errno(0), errno)
+		_, errno = fh.(*handle).Write(ctx, content, 0)
+		require.Equal(t, syscall.Errno(0), errno)
+		require.Equal(t, syscall.Errno(0), fh.(*handle).Release(ctx))
+		require.Nil(t, root.fsys.Sync(ctx))
+
+		data, ok := server.ReadFile("/data/upload.bin")
+		require.True(t, ok)
+		assert.Equal(t, content, data)
+		assert.False(t, server.Exists("/data/.upload.bin.partial"))
+	})
+}
@@ -0,0 +1,364 @@
+package ftpfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/jlaffaye/ftp"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/filecache"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/resume"
+)
+
+// handle is an open file. The content is spooled to a local file which is
+// downloaded on first use and written back when it was modified.
+type handle struct {
+	node  *node
+	flags uint32
+
+	mu     sync.Mutex
+	spool  *os.File
+	loaded bool
+	dirty  bool
+	size   int64
+	mtime  time.Time
+}
+
+var (
+	_ fs.FileReader    = (*handle)(nil)
+	_ fs.FileWriter    = (*handle)(nil)
+	_ fs.FileFlusher   = (*handle)(nil)
+	_ fs.FileFsyncer   = (*handle)(nil)
+	_ fs.FileReleaser  = (*handle)(nil)
+	_ fs.FileGetattrer = (*handle)(nil)
+)
+
+func newHandle(n *node, flags uint32) *handle {
+	return &handle{node: n, flags: flags, mtime: time.Now()}
+}
+
+// openHandle opens the file of n. Files opened for writing are downloaded
+// right away unless they are truncated.
+func openHandle(n *node, flags uint32) (*handle, syscall.Errno) {
+	h := newHandle(n, flags)
+
+	if flags&syscall.O_TRUNC != 0 && flags&syscall.O_ACCMODE != syscall.O_RDONLY {
+		entry, err := n.fsys.stat(n.remotePath())
+		if err != nil {
+			return nil, toErrno(err)
+		}
+
+		n.initSize(int64(entry.Size))
+		n.resize(0)
+		h.loaded = true
+		h.dirty = true
+
+		return h, 0
+	}
+
+	if flags&syscall.O_ACCMODE != syscall.O_RDONLY {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if errno := h.load(); errno != 0 {
+			return nil, errno
+		}
+	}
+
+	return h, 0
+}
+
+func (h *handle) fsys() *FS {
+	return h.node.fsys
+}
+
+func (h *handle) openSpool() error {
+	if h.spool != nil {
+		return nil
+	}
+
+	spool, err := os.CreateTemp(h.fsys().opts.SpoolDir, "spool-")
+	if err != nil {
+		return fmt.Errorf("unable to create spool file in ftpfs.handle.openSpool: %w", err)
+	}
+
+	h.spool = spool
+
+	return nil
+}
+
+// load downloads the remote file into the spool. h.mu must be held.
+func (h *handle) load() syscall.Errno {
+	if err := h.openSpool(); err != nil {
+		h.fsys().logger.Errorf("unable to open spool: %s", err.Error())
+		return syscall.EIO
+	}
+
+	if h.loaded {
+		return 0
+	}
+
+	p := h.node.remotePath()
+	if up, ok := h.fsys().pendingUpload(p); ok && h.loadPending(up) {
+		h.node.initSize(h.size)
+		h.loaded = true
+		return 0
+	}
+
+	key, cacheable := h.fsys().cacheKey(p)
+	if cacheable && h.loadCached(key) {
+		h.node.initSize(h.size)
+		h.loaded = true
+		return 0
+	}
+
+	stats, err := resume.Retr(context.Background(), h.fsys().opts.Retry, h.fsys().with, p, h.spool)
+	h.fsys().logTransfer("download", p, stats)
+	if err != nil {
+		h.fsys().logger.Errorf("unable to download remote file '%s': %s", p, err.Error())
+		_ = h.spool.Truncate(0)
+		return toErrno(err)
+	}
+
+	h.size = stats.Bytes
+
+	if err := h.fsys().verifyChecksum(p, io.NewSectionReader(h.spool, 0, h.size)); err != nil {
+		h.fsys().logger.Errorf("unable to download remote file '%s': %s", p, err.Error())
+		_ = h.spool.Truncate(0)
+		return syscall.EIO
+	}
+
+	if cacheable && h.size == key.Size {
+		if err := h.fsys().opts.Cache.Put(key, io.NewSectionReader(h.spool, 0, h.size), h.size); err != nil {
+			h.fsys().logger.Warnf("unable to cache remote file '%s': %s", p, err.Error())
+		}
+	}
+
+	h.node.initSize(h.size)
+	h.loaded = true
+
+	return 0
+}
+
+// loadPending copies the spool of a pending upload of the file into the
+// spool. h.mu must be held.
+func (h *handle) loadPending(up *pendingUpload) bool {
+	up.mu.RLock()
+	defer up.mu.RUnlock()
+
+	// the upload finished, the server has the content
+	if up.spool == nil {
+		return false
+	}
+
+	n, err := io.Copy(h.spool, io.NewSectionReader(up.spool, 0, up.size))
+	if err != nil {
+		h.fsys().logger.Warnf("unable to read pending upload of '%s': %s", h.node.remotePath(), err.Error())
+
+		if err := h.spool.Truncate(0); err != nil {
+			return false
+		}
+		_, _ = h.spool.Seek(0, io.SeekStart)
+
+		return false
+	}
+
+	h.size = n
+
+	return true
+}
+
+// loadCached copies the cached version of the remote file into the spool.
+// h.mu must be held.
+func (h *handle) loadCached(key filecache.Key) bool {
+	file, ok := h.fsys().opts.Cache.Open(key)
+	if !ok {
+		return false
+	}
+	defer file.Close()
+
+	n, err := io.Copy(h.spool, file)
+	if err != nil {
+		h.fsys().logger.Warnf("unable to read cached file '%s': %s", key.Path, err.Error())
+
+		// the spool is filled from the server instead
+		if err := h.spool.Truncate(0); err != nil {
+			return false
+		}
+		_, _ = h.spool.Seek(0, io.SeekStart)
+
+		return false
+	}
+
+	h.size = n
+
+	return true
+}
+
+// upload hands the modified spool to the write-back of the file system, the
+// next use of the handle loads the file again. h.mu must be held.
+func (h *handle) upload() syscall.Errno {
+	if !h.dirty {
+		return 0
+	}
+
+	// a truncated file which was not written has no spool yet
+	if err := h.openSpool(); err != nil {
+		h.fsys().logger.Errorf("unable to open spool: %s", err.Error())
+		return syscall.EIO
+	}
+
+	h.fsys().writeBack(h.node.remotePath(), h.spool, h.size, h.mtime)
+
+	h.spool = nil
+	h.loaded = false
+	h.dirty = false
+
+	return 0
+}
+
+// resize changes the size of the spool and accounts the difference to the
+// size of the file in the volume usage, which the handles of the file share.
+func (h *handle) resize(size int64) syscall.Errno {
+	if !h.node.resize(size) {
+		return syscall.ENOSPC
+	}
+
+	h.size = size
+
+	return 0
+}
+
+func (h *handle) truncate(size int64) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if errno := h.load(); errno != 0 {
+		return errno
+	}
+
+	if errno := h.resize(size); errno != 0 {
+		return errno
+	}
+
+	if err := h.spool.Truncate(size); err != nil {
+		return syscall.EIO
+	}
+
+	h.dirty = true
+	h.mtime = time.Now()
+
+	return 0
+}
+
+func (h *handle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if errno := h.load(); errno != 0 {
+		return nil, errno
+	}
+
+	n, err := h.spool.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, syscall.EIO
+	}
+
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (h *handle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if errno := h.load(); errno != 0 {
+		return 0, errno
+	}
+
+	if h.flags&syscall.O_APPEND != 0 {
+		off = h.size
+	}
+
+	if end := off + int64(len(data)); end > h.size {
+		if errno := h.resize(end); errno != 0 {
+			return 0, errno
+		}
+	}
+
+	n, err := h.spool.WriteAt(data, off)
+	if err != nil {
+		return uint32(n), syscall.EIO
+	}
+
+	h.dirty = true
+	h.mtime = time.Now()
+
+	return uint32(n), 0
+}
+
+func (h *handle) Flush(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.upload()
+}
+
+// Fsync waits until the file is written back to the server.
+func (h *handle) Fsync(ctx context.Context, flags uint32) syscall.Errno {
+	h.mu.Lock()
+	errno := h.upload()
+	h.mu.Unlock()
+
+	if errno != 0 {
+		return errno
+	}
+
+	p := h.node.remotePath()
+	if err := h.fsys().settle(p); err != nil {
+		h.fsys().logger.Errorf("unable to upload remote file '%s': %s", p, err.Error())
+		return toErrno(err)
+	}
+
+	return 0
+}
+
+func (h *handle) Release(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	errno := h.upload()
+
+	if h.spool != nil {
+		h.spool.Close()
+		os.Remove(h.spool.Name())
+		h.spool = nil
+	}
+
+	return errno
+}
+
+func (h *handle) Getattr(ctx context.Context, out *fuse.AttrOut) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.dirty {
+		entry, err := h.fsys().stat(h.node.remotePath())
+		if err != nil {
+			return toErrno(err)
+		}
+
+		fillAttr(entry, &out.Attr)
+
+		return 0
+	}
+
+	fillAttr(&ftp.Entry{Type: ftp.EntryTypeFile, Size: uint64(h.size), Time: h.mtime}, &out.Attr)
+
+	return 0
+}
@@ -0,0 +1,342 @@
+package ftpfs
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/jlaffaye/ftp"
+)
+
+// renameNoReplace is the RENAME_NOREPLACE flag of renameat2(2).
+const renameNoReplace = 0x1
+
+// node is a file or a directory of the file system.
+type node struct {
+	fs.Inode
+	fsys *FS
+
+	// mu guards size, the size of the file accounted in the volume usage.
+	// The open handles of the file share it, the first one to load the
+	// file sets it.
+	mu    sync.Mutex
+	size  int64
+	sized bool
+}
+
+var (
+	_ fs.NodeLookuper  = (*node)(nil)
+	_ fs.NodeGetattrer = (*node)(nil)
+	_ fs.NodeSetattrer = (*node)(nil)
+	_ fs.NodeReaddirer = (*node)(nil)
+	_ fs.NodeOpener    = (*node)(nil)
+	_ fs.NodeCreater   = (*node)(nil)
+	_ fs.NodeMkdirer   = (*node)(nil)
+	_ fs.NodeUnlinker  = (*node)(nil)
+	_ fs.NodeRmdirer   = (*node)(nil)
+	_ fs.NodeRenamer   = (*node)(nil)
+	_ fs.NodeStatfser  = (*node)(nil)
+)
+
+func (n *node) remotePath() string {
+	return n.fsys.remotePath(n.Path(nil))
+}
+
+// initSize sets the accounted size of the file to the size a handle loaded,
+// unless another handle of the file set it already.
+func (n *node) initSize(size int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if !n.sized {
+		n.size = size
+		n.sized = true
+	}
+}
+
+// resize accounts the change of the size of the file in the volume usage and
+// refuses growth past the quota.
+func (n *node) resize(size int64) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if delta := size - n.size; delta != 0 && !n.fsys.reserve(delta) {
+		return false
+	}
+
+	n.size = size
+
+	return true
+}
+
+func (n *node) newChild(ctx context.Context, entry *ftp.Entry) *fs.Inode {
+	return n.NewInode(ctx, &node{fsys: n.fsys}, fs.StableAttr{Mode: entryMode(entry)})
+}
+
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	entries, err := n.fsys.list(n.remotePath())
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	entry, ok := entries[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	p, err := n.fsys.childPath(n.remotePath(), name)
+	if err != nil {
+		return nil, syscall.ENOENT
+	}
+
+	entry = n.fsys.overlay(p, n.fsys.exactTime(p, entry))
+	fillAttr(entry, &out.Attr)
+
+	return n.newChild(ctx, entry), 0
+}
+
+func (n *node) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if h, ok := fh.(*handle); ok {
+		return h.Getattr(ctx, out)
+	}
+
+	if n.IsRoot() {
+		now := time.Now()
+		fillAttr(&ftp.Entry{Type: ftp.EntryTypeFolder, Time: now}, &out.Attr)
+		return 0
+	}
+
+	entry, err := n.fsys.stat(n.remotePath())
+	if err != nil {
+		return toErrno(err)
+	}
+
+	fillAttr(entry, &out.Attr)
+
+	return 0
+}
+
+// Setattr only supports changing the size, the ftp protocol has no portable
+// way to change owners or permissions.
+func (n *node) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	if size, ok := in.GetSize(); ok {
+		h, isHandle := fh.(*handle)
+		if !isHandle {
+			var errno syscall.Errno
+			if h, errno = openHandle(n, syscall.O_RDWR); errno != 0 {
+				return errno
+			}
+			defer h.Release(ctx)
+		}
+
+		if errno := h.truncate(int64(size)); errno != 0 {
+			return errno
+		}
+
+		if !isHandle {
+			if errno := h.Flush(ctx); errno != 0 {
+				return errno
+			}
+		}
+	}
+
+	return n.Getattr(ctx, fh, out)
+}
+
+func (n *node) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	entries, err := n.fsys.list(n.remotePath())
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	res := make([]fuse.DirEntry, 0, len(entries))
+	for name, entry := range entries {
+		res = append(res, fuse.DirEntry{Name: name, Mode: entryMode(entry)})
+	}
+
+	return fs.NewListDirStream(res), 0
+}
+
+func (n *node) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	h, errno := openHandle(n, flags)
+	if errno != 0 {
+		return nil, 0, errno
+	}
+
+	return h, 0, 0
+}
+
+func (n *node) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	dir := n.remotePath()
+	p, err := n.fsys.childPath(dir, name)
+	if err != nil {
+		return nil, nil, 0, syscall.EILSEQ
+	}
+
+	err = n.fsys.withConn(func(conn *ftp.ServerConn) error {
+		return conn.Stor(p, bytes.NewReader(nil))
+	})
+	n.fsys.invalidate(dir)
+	if err != nil {
+		n.fsys.logger.Errorf("unable to create remote file '%s': %s", p, err.Error())
+		return nil, nil, 0, toErrno(err)
+	}
+
+	entry := &ftp.Entry{Name: name, Type: ftp.EntryTypeFile, Time: time.Now()}
+	fillAttr(entry, &out.Attr)
+
+	child := n.newChild(ctx, entry)
+	h := newHandle(child.Operations().(*node), flags)
+	h.node.initSize(0)
+	h.loaded = true
+
+	return child, h, 0, 0
+}
+
+func (n *node) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	dir := n.remotePath()
+	p, err := n.fsys.childPath(dir, name)
+	if err != nil {
+		return nil, syscall.EILSEQ
+	}
+
+	err = n.fsys.withConn(func(conn *ftp.ServerConn) error {
+		return conn.MakeDir(p)
+	})
+	n.fsys.invalidate(dir)
+	if err != nil {
+		n.fsys.logger.Errorf("unable to create remote dir '%s': %s", p, err.Error())
+		return nil, toErrno(err)
+	}
+
+	entry := &ftp.Entry{Name: name, Type: ftp.EntryTypeFolder, Time: time.Now()}
+	fillAttr(entry, &out.Attr)
+
+	return n.newChild(ctx, entry), 0
+}
+
+func (n *node) Unlink(ctx context.Context, name string) syscall.Errno {
+	dir := n.remotePath()
+	p, err := n.fsys.childPath(dir, name)
+	if err != nil {
+		return syscall.ENOENT
+	}
+
+	// a pending upload would bring the file back
+	_ = n.fsys.settle(p)
+
+	entry, err := n.fsys.stat(p)
+	if err != nil {
+		return toErrno(err)
+	}
+
+	err = n.fsys.withConn(func(conn *ftp.ServerConn) error {
+		return conn.Delete(p)
+	})
+	n.fsys.invalidate(dir, p)
+	if err != nil {
+		n.fsys.logger.Errorf("unable to remove remote file '%s': %s", p, err.Error())
+		return toErrno(err)
+	}
+
+	n.fsys.reserve(-int64(entry.Size))
+
+	return 0
+}
+
+func (n *node) Rmdir(ctx context.Context, name string) syscall.Errno {
+	dir := n.remotePath()
+	p, err := n.fsys.childPath(dir, name)
+	if err != nil {
+		return syscall.ENOENT
+	}
+
+	entries, err := n.fsys.list(p)
+	if err != nil {
+		return toErrno(err)
+	}
+
+	if len(entries) != 0 {
+		return syscall.ENOTEMPTY
+	}
+
+	err = n.fsys.withConn(func(conn *ftp.ServerConn) error {
+		return conn.RemoveDir(p)
+	})
+	n.fsys.invalidate(dir, p)
+	if err != nil {
+		n.fsys.logger.Errorf("unable to remove remote dir '%s': %s", p, err.Error())
+		return toErrno(err)
+	}
+
+	return 0
+}
+
+func (n *node) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	if flags&^renameNoReplace != 0 {
+		return syscall.EINVAL
+	}
+
+	dir := n.remotePath()
+	newDir := n.fsys.remotePath(newParent.EmbeddedInode().Path(nil))
+	from, err := n.fsys.childPath(dir, name)
+	if err != nil {
+		return syscall.ENOENT
+	}
+
+	to, err := n.fsys.childPath(newDir, newName)
+	if err != nil {
+		return syscall.EILSEQ
+	}
+
+	// the uploads of both files land before the rename
+	_ = n.fsys.settle(from)
+	_ = n.fsys.settle(to)
+
+	replaced, err := n.fsys.stat(to)
+	if err == nil && flags&renameNoReplace != 0 {
+		return syscall.EEXIST
+	}
+
+	err = n.fsys.withConn(func(conn *ftp.ServerConn) error {
+		return conn.Rename(from, to)
+	})
+	n.fsys.invalidate(dir, newDir, from, to)
+	if err != nil {
+		n.fsys.logger.Errorf("unable to rename remote file '%s' to '%s': %s", from, to, err.Error())
+		return toErrno(err)
+	}
+
+	if replaced != nil && replaced.Type == ftp.EntryTypeFile {
+		n.fsys.reserve(-int64(replaced.Size))
+	}
+
+	return 0
+}
+
+// Statfs reports the quota of the volume as the size of the file system.
+func (n *node) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	out.Bsize = blockSize
+	out.Frsize = blockSize
+	out.NameLen = 255
+
+	total := uint64(1) << 50
+	if quota := n.fsys.opts.Quota; quota > 0 {
+		total = uint64(quota)
+	}
+
+	used := uint64(n.fsys.opts.Usage.Used())
+	if used > total {
+		used = total
+	}
+
+	out.Blocks = total / blockSize
+	out.Bfree = (total - used) / blockSize
+	out.Bavail = out.Bfree
+
+	return 0
+}
@@ -0,0 +1,276 @@
+package ftpfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/resume"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/retry"
+)
+
+// spoolPathSuffix names the file next to a spool waiting to be written back
+// which holds the remote path of the spool. Spools left behind by a failed
+// upload or a crash are written back on the next mount.
+const spoolPathSuffix = ".path"
+
+// pendingUpload is the spool of a closed file waiting to be written back to
+// the server. Reads of the file are served from the spool until it is
+// uploaded.
+type pendingUpload struct {
+	size  int64
+	mtime time.Time
+	done  chan struct{}
+	// prev is the earlier upload of the same file, it finishes first.
+	prev *pendingUpload
+
+	mu sync.RWMutex
+	// spool is nil once the upload finished.
+	spool *os.File
+}
+
+// writeBack uploads the spool of the remote file p in the background and
+// takes over the spool.
+func (f *FS) writeBack(p string, spool *os.File, size int64, mtime time.Time) {
+	up := &pendingUpload{spool: spool, size: size, mtime: mtime, done: make(chan struct{})}
+
+	if err := os.WriteFile(spool.Name()+spoolPathSuffix, []byte(p), 0600); err != nil {
+		f.logger.Warnf("unable to record remote path of spool '%s': %s", spool.Name(), err.Error())
+	}
+
+	f.mu.Lock()
+	up.prev = f.uploads[p]
+	f.uploads[p] = up
+	delete(f.failed, p)
+	f.mu.Unlock()
+
+	f.pending.Add(1)
+	go f.upload(p, up)
+}
+
+func (f *FS) upload(p string, up *pendingUpload) {
+	defer f.pending.Done()
+	defer close(up.done)
+
+	if up.prev != nil {
+		<-up.prev.done
+		up.prev = nil
+	}
+
+	f.mu.Lock()
+	// a later upload of the file carries the newer content
+	superseded := f.uploads[p] != up
+	f.mu.Unlock()
+
+	var err error
+	if !superseded {
+		err = f.storAtomic(p, up)
+	}
+
+	f.invalidate(path.Dir(p), p)
+
+	f.mu.Lock()
+	if f.uploads[p] == up {
+		delete(f.uploads, p)
+	}
+	if err != nil {
+		f.failed[p] = err
+	}
+	f.mu.Unlock()
+
+	up.mu.Lock()
+	spool := up.spool
+	up.spool = nil
+	up.mu.Unlock()
+
+	spool.Close()
+
+	if err != nil {
+		f.logger.Errorf("unable to upload remote file '%s', local copy kept at '%s' until the next mount: %s", p, spool.Name(), err.Error())
+		return
+	}
+
+	os.Remove(spool.Name())
+	os.Remove(spool.Name() + spoolPathSuffix)
+}
+
+// requeueSpools writes back the spools left behind by uploads which failed or
+// were cut short by a crash, the oldest first. Spools without a remote path
+// belonged to files which were never closed and are removed.
+func (f *FS) requeueSpools() error {
+	entries, err := os.ReadDir(f.opts.SpoolDir)
+	if err != nil {
+		return fmt.Errorf("unable to read spool directory in ftpfs.FS.requeueSpools: %w", err)
+	}
+
+	type leftover struct {
+		path  string
+		spool *os.File
+		info  os.FileInfo
+	}
+
+	var leftovers []leftover
+	for _, entry := range entries {
+		name := filepath.Join(f.opts.SpoolDir, entry.Name())
+		if strings.HasSuffix(name, spoolPathSuffix) {
+			if _, err := os.Stat(strings.TrimSuffix(name, spoolPathSuffix)); os.IsNotExist(err) {
+				os.Remove(name)
+			}
+			continue
+		}
+
+		p, err := os.ReadFile(name + spoolPathSuffix)
+		if os.IsNotExist(err) {
+			os.Remove(name)
+			continue
+		}
+		if err != nil {
+			f.logger.Errorf("unable to read remote path of spool '%s': %s", name, err.Error())
+			continue
+		}
+
+		spool, err := os.Open(name)
+		if err != nil {
+			f.logger.Errorf("unable to open spool '%s': %s", name, err.Error())
+			continue
+		}
+
+		info, err := spool.Stat()
+		if err != nil {
+			spool.Close()
+			f.logger.Errorf("unable to stat spool '%s': %s", name, err.Error())
+			continue
+		}
+
+		leftovers = append(leftovers, leftover{path: string(p), spool: spool, info: info})
+	}
+
+	sort.Slice(leftovers, func(i, j int) bool { return leftovers[i].info.ModTime().Before(leftovers[j].info.ModTime()) })
+
+	for _, l := range leftovers {
+		f.logger.Warnf("writing back remote file '%s' from spool '%s' left by an earlier mount", l.path, l.spool.Name())
+		f.writeBack(l.path, l.spool, l.info.Size(), l.info.ModTime())
+	}
+
+	return nil
+}
+
+// storAtomic stores the spool under a temporary name and renames it into
+// place, so a failed transfer never leaves a truncated file behind.
+// Interrupted transfers are resumed under the retry policy, a copy failing
+// the checksum is not renamed into place.
+func (f *FS) storAtomic(p string, up *pendingUpload) error {
+	tmp := models.PartialName(f.opts.PartialPattern, p)
+
+	stats, err := resume.Stor(context.Background(), f.opts.Retry, f.with, tmp, up.spool, up.size)
+	f.logTransfer("upload", p, stats)
+	if err == nil {
+		err = f.verifyChecksum(tmp, io.NewSectionReader(up.spool, 0, up.size))
+	}
+	if err == nil {
+		err = retry.Do(context.Background(), f.opts.Retry, func(ctx context.Context) error {
+			return f.withConn(func(conn *ftp.ServerConn) error { return conn.Rename(tmp, p) })
+		}, func(attempt int, err error) {
+			f.logger.Warnw("retrying rename of upload", "path", p, "attempt", attempt, "error", err.Error())
+		})
+	}
+	if err != nil {
+		// the partial file is of no use without the spool
+		_ = f.withConn(func(conn *ftp.ServerConn) error { return conn.Delete(tmp) })
+		return err
+	}
+
+	return nil
+}
+
+// pendingUpload returns the upload of the remote file p which is not finished
+// yet.
+func (f *FS) pendingUpload(p string) (*pendingUpload, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	up, ok := f.uploads[p]
+	return up, ok
+}
+
+// overlay returns entry with the size and time of a pending upload of the
+// remote file p.
+func (f *FS) overlay(p string, entry *ftp.Entry) *ftp.Entry {
+	up, ok := f.pendingUpload(p)
+	if !ok {
+		return entry
+	}
+
+	res := *entry
+	res.Size = uint64(up.size)
+	res.Time = up.mtime
+
+	return &res
+}
+
+// settle waits for the uploads of the remote file p and of the files below
+// it, and returns the error of a failed one.
+func (f *FS) settle(p string) error {
+	for {
+		var up *pendingUpload
+
+		f.mu.Lock()
+		for name, pending := range f.uploads {
+			if name == p || strings.HasPrefix(name, p+"/") {
+				up = pending
+				break
+			}
+		}
+		err := f.failed[p]
+		f.mu.Unlock()
+
+		if up == nil {
+			return err
+		}
+
+		<-up.done
+	}
+}
+
+// Sync waits until the pending uploads are written back. It returns an error
+// naming the files which could not be uploaded.
+func (f *FS) Sync(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		f.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("pending uploads did not finish in ftpfs.FS.Sync: %w", ctx.Err())
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.failed) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(f.failed))
+	for p := range f.failed {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	err := f.failed[paths[0]]
+	f.failed = make(map[string]error)
+
+	return fmt.Errorf("unable to upload %s in ftpfs.FS.Sync: %w", strings.Join(paths, ", "), err)
+}
@@ -0,0 +1,103 @@
+package mountmngr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	fuseDevice = "/dev/fuse"
+	// mountCheckTimeout bounds the check of a mount, a hung ftp server blocks
+	// file system calls on the mountpoint.
+	mountCheckTimeout = 5 * time.Second
+)
+
+// backendTools are the executables the mount backends depend on, mount
+// binds the local directories of the stage and mirror modes.
+var backendTools = []string{"curlftpfs", "mount", "umount"}
+
+func (mngr *mountmngr) CheckSystem() []models.HealthCheck {
+	checks := []models.HealthCheck{models.NewHealthCheck("fuse_device", checkFuseDevice())}
+
+	for _, tool := range backendTools {
+		_, err := exec.LookPath(tool)
+		checks = append(checks, models.NewHealthCheck("binary:"+tool, err))
+	}
+
+	return checks
+}
+
+func checkFuseDevice() error {
+	dev, err := os.OpenFile(fuseDevice, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("unable to open fuse device in mountmngr.checkFuseDevice: %w", err)
+	}
+
+	return dev.Close()
+}
+
+func (mngr *mountmngr) CheckMount(ctx context.Context, vol *volume.Volume) (err error) {
+	_, span := tracing.Start(ctx, "mountmngr.CheckMount", attribute.String("volume.name", vol.Name))
+	defer func() { tracing.End(span, err) }()
+
+	// a check blocked on a hung mount is not started again, each would
+	// leave a goroutine behind
+	if _, running := mngr.checks.LoadOrStore(vol.Mountpoint, struct{}{}); running {
+		return fmt.Errorf("check of mountpoint '%s' in progress, it does not respond", vol.Mountpoint)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := checkMountpoint(vol.Mountpoint)
+		mngr.checks.Delete(vol.Mountpoint)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(mountCheckTimeout):
+		return fmt.Errorf("mountpoint '%s' does not respond within %s", vol.Mountpoint, mountCheckTimeout)
+	}
+}
+
+// checkMountpoint checks that a file system is mounted at mountpoint and
+// that its root directory can be listed.
+func checkMountpoint(mountpoint string) error {
+	var st, parent syscall.Stat_t
+	if err := syscall.Stat(mountpoint, &st); err != nil {
+		return fmt.Errorf("unable to stat mountpoint in mountmngr.checkMountpoint: %w", err)
+	}
+
+	if err := syscall.Stat(filepath.Dir(mountpoint), &parent); err != nil {
+		return fmt.Errorf("unable to stat mountpoint parent in mountmngr.checkMountpoint: %w", err)
+	}
+
+	if st.Dev == parent.Dev {
+		return errors.New("mountpoint is not mounted")
+	}
+
+	dir, err := os.Open(mountpoint)
+	if err != nil {
+		return fmt.Errorf("unable to open mountpoint in mountmngr.checkMountpoint: %w", err)
+	}
+	defer dir.Close()
+
+	if _, err := dir.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("unable to list mountpoint in mountmngr.checkMountpoint: %w", err)
+	}
+
+	return nil
+}
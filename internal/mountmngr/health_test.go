@@ -0,0 +1,69 @@
+package mountmngr
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestCheckMount(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	mngr := NewMountManager(DefaultOptions(), logger)
+
+	t.Run("not mounted directory", func(t *testing.T) {
+		err := mngr.CheckMount(context.Background(), &volume.Volume{Name: "test", Mountpoint: t.TempDir()})
+		assert.Error(t, err)
+	})
+
+	t.Run("missing mountpoint", func(t *testing.T) {
+		err := mngr.CheckMount(context.Background(), &volume.Volume{Name: "test", Mountpoint: filepath.Join(t.TempDir(), "notExists")})
+		assert.Error(t, err)
+	})
+
+	t.Run("check in progress", func(t *testing.T) {
+		mountpoint := t.TempDir()
+		mngr.(*mountmngr).checks.Store(mountpoint, struct{}{})
+
+		err := mngr.CheckMount(context.Background(), &volume.Volume{Name: "test", Mountpoint: mountpoint})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "in progress")
+
+		// the check runs again once the hung one returns
+		mngr.(*mountmngr).checks.Delete(mountpoint)
+		err = mngr.CheckMount(context.Background(), &volume.Volume{Name: "test", Mountpoint: mountpoint})
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), "in progress")
+	})
+}
+
+func TestCheckSystem(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	t.Setenv("PATH", t.TempDir())
+
+	checks := NewMountManager(DefaultOptions(), logger).CheckSystem()
+
+	names := make([]string, 0, len(checks))
+	for _, check := range checks {
+		names = append(names, check.Name)
+		if check.Name != "fuse_device" {
+			assert.Equal(t, models.HealthDegraded, check.Status)
+			assert.NotEmpty(t, check.Error)
+		}
+	}
+
+	assert.Equal(t, []string{"fuse_device", "binary:curlftpfs", "binary:mount", "binary:umount"}, names)
+}
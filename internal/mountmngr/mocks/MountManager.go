@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	mock "github.com/stretchr/testify/mock"
 	models "github.com/t1d333/docker-volume-ftp-driver/internal/models"
 
@@ -14,23 +16,77 @@ type MountManager struct {
 	mock.Mock
 }
 
-// Mount provides a mock function with given fields: vol, opt
-func (_m *MountManager) Mount(vol *volume.Volume, opt *models.VolumeOptions) (string, error) {
-	ret := _m.Called(vol, opt)
+// Bind provides a mock function with given fields: ctx, vol, dir, readOnly
+func (_m *MountManager) Bind(ctx context.Context, vol *volume.Volume, dir string, readOnly bool) (string, error) {
+	ret := _m.Called(ctx, vol, dir, readOnly)
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *volume.Volume, string, bool) (string, error)); ok {
+		return rf(ctx, vol, dir, readOnly)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *volume.Volume, string, bool) string); ok {
+		r0 = rf(ctx, vol, dir, readOnly)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *volume.Volume, string, bool) error); ok {
+		r1 = rf(ctx, vol, dir, readOnly)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CheckMount provides a mock function with given fields: ctx, vol
+func (_m *MountManager) CheckMount(ctx context.Context, vol *volume.Volume) error {
+	ret := _m.Called(ctx, vol)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *volume.Volume) error); ok {
+		r0 = rf(ctx, vol)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CheckSystem provides a mock function with given fields:
+func (_m *MountManager) CheckSystem() []models.HealthCheck {
+	ret := _m.Called()
+
+	var r0 []models.HealthCheck
+	if rf, ok := ret.Get(0).(func() []models.HealthCheck); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.HealthCheck)
+		}
+	}
+
+	return r0
+}
+
+// Mount provides a mock function with given fields: ctx, vol, opt, usage
+func (_m *MountManager) Mount(ctx context.Context, vol *volume.Volume, opt *models.VolumeOptions, usage *models.QuotaUsage) (string, error) {
+	ret := _m.Called(ctx, vol, opt, usage)
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(*volume.Volume, *models.VolumeOptions) (string, error)); ok {
-		return rf(vol, opt)
+	if rf, ok := ret.Get(0).(func(context.Context, *volume.Volume, *models.VolumeOptions, *models.QuotaUsage) (string, error)); ok {
+		return rf(ctx, vol, opt, usage)
 	}
-	if rf, ok := ret.Get(0).(func(*volume.Volume, *models.VolumeOptions) string); ok {
-		r0 = rf(vol, opt)
+	if rf, ok := ret.Get(0).(func(context.Context, *volume.Volume, *models.VolumeOptions, *models.QuotaUsage) string); ok {
+		r0 = rf(ctx, vol, opt, usage)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
-	if rf, ok := ret.Get(1).(func(*volume.Volume, *models.VolumeOptions) error); ok {
-		r1 = rf(vol, opt)
+	if rf, ok := ret.Get(1).(func(context.Context, *volume.Volume, *models.VolumeOptions, *models.QuotaUsage) error); ok {
+		r1 = rf(ctx, vol, opt, usage)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -38,13 +94,13 @@ func (_m *MountManager) Mount(vol *volume.Volume, opt *models.VolumeOptions) (st
 	return r0, r1
 }
 
-// Remove provides a mock function with given fields: vol
-func (_m *MountManager) Remove(vol *volume.Volume) error {
-	ret := _m.Called(vol)
+// Remove provides a mock function with given fields: ctx, vol
+func (_m *MountManager) Remove(ctx context.Context, vol *volume.Volume) error {
+	ret := _m.Called(ctx, vol)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*volume.Volume) error); ok {
-		r0 = rf(vol)
+	if rf, ok := ret.Get(0).(func(context.Context, *volume.Volume) error); ok {
+		r0 = rf(ctx, vol)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -52,13 +108,13 @@ func (_m *MountManager) Remove(vol *volume.Volume) error {
 	return r0
 }
 
-// Unmount provides a mock function with given fields: vol
-func (_m *MountManager) Unmount(vol *volume.Volume) error {
-	ret := _m.Called(vol)
+// Unmount provides a mock function with given fields: ctx, vol
+func (_m *MountManager) Unmount(ctx context.Context, vol *volume.Volume) error {
+	ret := _m.Called(ctx, vol)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*volume.Volume) error); ok {
-		r0 = rf(vol)
+	if rf, ok := ret.Get(0).(func(context.Context, *volume.Volume) error); ok {
+		r0 = rf(ctx, vol)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -1,12 +1,20 @@
 package mountmngr
 
 import (
+	"context"
+
 	"github.com/docker/go-plugins-helpers/volume"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
 )
 
 type MountManager interface {
-	Mount(vol *volume.Volume, opt *models.VolumeOptions) (string, error)
-	Unmount(vol *volume.Volume) error
-	Remove(vol *volume.Volume) error
+	Mount(ctx context.Context, vol *volume.Volume, opt *models.VolumeOptions, usage *models.QuotaUsage) (string, error)
+	// Bind mounts the local directory dir on the mountpoint of the volume.
+	Bind(ctx context.Context, vol *volume.Volume, dir string, readOnly bool) (string, error)
+	Unmount(ctx context.Context, vol *volume.Volume) error
+	Remove(ctx context.Context, vol *volume.Volume) error
+	// CheckSystem checks the fuse device and the tools used by the backends.
+	CheckSystem() []models.HealthCheck
+	// CheckMount checks that the volume is mounted and responds.
+	CheckMount(ctx context.Context, vol *volume.Volume) error
 }
@@ -1,56 +1,363 @@
 package mountmngr
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sync"
 
 	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/charset"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/metrics"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/mountmngr/ftpfs"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/retry"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/tracing"
 	pkgLogger "github.com/t1d333/docker-volume-ftp-driver/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Failure reasons reported in the mount metrics.
+const (
+	reasonMountpoint = "mountpoint"
+	reasonCurlFtpFS  = "curlftpfs"
+	reasonFuse       = "fuse"
+	reasonUmount     = "umount"
+	reasonTimeout    = "timeout"
+	reasonSessions   = "sessions"
+	reasonBind       = "bind"
+	reasonUpload     = "upload"
 )
 
 type mountmngr struct {
 	logger pkgLogger.Logger
+	opts   *Options
+	// mounts holds the file systems served by the native backend.
+	mounts *sync.Map
+	// sessions holds the host sessions of the curlftpfs mounts, the native
+	// backend takes a session per connection.
+	sessions *sync.Map
+	// checks holds the mountpoints with a running check.
+	checks *sync.Map
+}
+
+type nativeMount struct {
+	server *fuse.Server
+	fsys   *ftpfs.FS
+}
+
+func NewMountManager(opts *Options, logger pkgLogger.Logger) MountManager {
+	return &mountmngr{logger: logger, opts: opts, mounts: &sync.Map{}, sessions: &sync.Map{}, checks: &sync.Map{}}
 }
 
-func NewMountManager(logger pkgLogger.Logger) MountManager {
-	return &mountmngr{logger: logger}
+// log returns the logger with the request fields carried by ctx.
+func (mngr *mountmngr) log(ctx context.Context) pkgLogger.Logger {
+	return pkgLogger.FromContext(ctx, mngr.logger)
 }
 
-func (mngr *mountmngr) Mount(vol *volume.Volume, opt *models.VolumeOptions) (string, error) {
+// volumeLog returns the logger of the file system of a volume, its lines
+// outlive the request mounting it.
+func (mngr *mountmngr) volumeLog(name string) pkgLogger.Logger {
+	return pkgLogger.FromContext(pkgLogger.WithFields(context.Background(), "volume", name), mngr.logger)
+}
+
+func (mngr *mountmngr) Mount(ctx context.Context, vol *volume.Volume, opt *models.VolumeOptions, usage *models.QuotaUsage) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "mountmngr.Mount",
+		attribute.String("volume.name", vol.Name), attribute.String("volume.backend", opt.Backend))
+	defer func() { tracing.End(span, err) }()
+
 	if err := os.MkdirAll(vol.Mountpoint, 0755); err != nil {
+		metrics.MountFailures.WithLabelValues(reasonMountpoint).Inc()
 		return "", fmt.Errorf("unable to create mount directory in mountmngr.Mount: %w", err)
 	}
 
+	if opt.Backend == models.BackendNative {
+		return mngr.mountNative(ctx, vol, opt, usage)
+	}
+
+	session, err := mngr.opts.Limiter.Acquire(ctx, &opt.FTPConnectionOpt)
+	if err != nil {
+		metrics.MountFailures.WithLabelValues(reasonSessions).Inc()
+		return "", fmt.Errorf("failed hostlimit.Acquire in mountmngr.Mount: %w", err)
+	}
+
+	err = retry.Do(ctx, mngr.opts.Retry.Override(opt.Retry), func(ctx context.Context) error {
+		return mngr.mountCurlFtpFS(ctx, vol, opt)
+	}, func(attempt int, err error) {
+		mngr.log(ctx).Warnw("retrying mount", "name", vol.Name, "attempt", attempt, "error", err.Error())
+	})
+	if err != nil {
+		session()
+
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			metrics.MountFailures.WithLabelValues(reasonTimeout).Inc()
+		} else {
+			metrics.MountFailures.WithLabelValues(reasonCurlFtpFS).Inc()
+		}
+
+		return "", fmt.Errorf("failed mountmngr.mountCurlFtpFS in mountmngr.Mount: %w", err)
+	}
+
+	mngr.sessions.Store(vol.Name, session)
+	metrics.ActiveMounts.Inc()
+
+	return vol.Mountpoint, nil
+}
+
+func (mngr *mountmngr) Bind(ctx context.Context, vol *volume.Volume, dir string, readOnly bool) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "mountmngr.Bind", attribute.String("volume.name", vol.Name))
+	defer func() { tracing.End(span, err) }()
+
+	mngr.log(ctx).Debugw("binding local copy", "name", vol.Name, "source", dir, "mountpoint", vol.Mountpoint)
+
+	if err := os.MkdirAll(vol.Mountpoint, 0755); err != nil {
+		metrics.MountFailures.WithLabelValues(reasonMountpoint).Inc()
+		return "", fmt.Errorf("unable to create mount directory in mountmngr.Bind: %w", err)
+	}
+
+	mountCtx, cancel := context.WithTimeout(ctx, mngr.opts.MountTimeout)
+	defer cancel()
+
+	flags := "bind"
+	if readOnly {
+		flags += ",ro"
+	}
+
+	if err := run(mountCtx, exec.Command("mount", "-o", flags, dir, vol.Mountpoint)); err != nil {
+		if mountCtx.Err() != nil {
+			metrics.MountFailures.WithLabelValues(reasonTimeout).Inc()
+		} else {
+			metrics.MountFailures.WithLabelValues(reasonBind).Inc()
+		}
+
+		return "", fmt.Errorf("unable to bind directory in mountmngr.Bind: %w", err)
+	}
+
+	metrics.ActiveMounts.Inc()
+
+	return vol.Mountpoint, nil
+}
+
+// curlFtpFSArgs returns the arguments of curlftpfs, adapted to the features
+// of the server when they are known.
+func curlFtpFSArgs(ftpPath, mountpoint string, opt *models.VolumeOptions) []string {
+	args := []string{ftpPath, mountpoint, "-o", fmt.Sprintf("user=%s:%s", opt.User, opt.Password), "-o", "nonempty"}
+
+	// a server without EPSV makes curl fall back to PASV on every transfer
+	if opt.Capabilities.Lacks(models.FeatureEPSV) {
+		args = append(args, "-o", "disable_epsv")
+	}
+
+	// curlftpfs transcodes the names with iconv, which knows the canonical
+	// names of the encodings
+	switch {
+	case opt.Encoding != "":
+		args = append(args, "-o", "codepage="+opt.Encoding)
+	case opt.Capabilities.Has(models.FeatureUTF8):
+		args = append(args, "-o", "utf8")
+	}
+
+	return args
+}
+
+// mountCurlFtpFS makes one attempt to mount the volume with curlftpfs. A
+// failing curlftpfs does not tell why, its failures are treated as transient.
+func (mngr *mountmngr) mountCurlFtpFS(ctx context.Context, vol *volume.Volume, opt *models.VolumeOptions) (err error) {
 	ftpPath := fmt.Sprintf("%s:%d%s", opt.Host, opt.Port, opt.RemotePath)
+	mngr.log(ctx).Debugw("mounting with curlftpfs", "name", vol.Name, "source", ftpPath, "mountpoint", vol.Mountpoint)
 
-	cmd := exec.Command("curlftpfs", ftpPath, vol.Mountpoint, "-o", fmt.Sprintf("user=%s:%s", opt.User, opt.Password), "-o", "nonempty")
+	cmd := exec.Command("curlftpfs", curlFtpFSArgs(ftpPath, vol.Mountpoint, opt)...)
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("unable to mount directory in mountmngr.Mount: %w", err)
+	mountCtx, cancel := context.WithTimeout(ctx, mngr.opts.MountTimeout)
+	defer cancel()
+
+	_, execSpan := tracing.Start(ctx, "exec curlftpfs", attribute.String("mount.source", ftpPath))
+	err = run(mountCtx, cmd)
+	tracing.End(execSpan, err)
+	if err != nil {
+		if mountCtx.Err() != nil {
+			mngr.release(ctx, vol.Mountpoint)
+			return fmt.Errorf("unable to mount directory in mountmngr.mountCurlFtpFS: %w", err)
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = retry.Transient(err)
+		}
+
+		return fmt.Errorf("unable to mount directory in mountmngr.mountCurlFtpFS: %w", err)
+	}
+
+	return nil
+}
+
+func (mngr *mountmngr) mountNative(ctx context.Context, vol *volume.Volume, opt *models.VolumeOptions, usage *models.QuotaUsage) (string, error) {
+	mngr.log(ctx).Debugw("mounting with native backend", "name", vol.Name, "mountpoint", vol.Mountpoint)
+
+	codec, err := charset.New(opt.Encoding)
+	if err != nil {
+		return "", fmt.Errorf("failed charset.New in mountmngr.mountNative: %w", err)
+	}
+
+	loc, err := models.LoadServerLocation(opt.ServerTZ)
+	if err != nil {
+		return "", fmt.Errorf("failed models.LoadServerLocation in mountmngr.mountNative: %w", err)
 	}
 
+	fsys := ftpfs.New(&ftpfs.Options{
+		RemotePath:     opt.RemotePath,
+		FTP:            opt.FTPConnectionOpt,
+		SpoolDir:       mngr.spoolDir(vol.Name),
+		Quota:          opt.Quota,
+		Usage:          usage,
+		DialTimeout:    mngr.opts.DialTimeout,
+		Limiter:        mngr.opts.Limiter,
+		Cache:          mngr.opts.Cache,
+		Retry:          mngr.opts.Retry.Override(opt.Retry),
+		PartialPattern: opt.PartialPattern,
+		Checksum:       opt.Checksum,
+		Capabilities:   opt.Capabilities,
+		Encoding:       codec,
+		Location:       loc,
+	}, mngr.volumeLog(vol.Name))
+
+	_, fuseSpan := tracing.Start(ctx, "fuse mount")
+	server, err := mngr.mountFS(ctx, vol.Mountpoint, fsys)
+	tracing.End(fuseSpan, err)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			metrics.MountFailures.WithLabelValues(reasonTimeout).Inc()
+		} else {
+			metrics.MountFailures.WithLabelValues(reasonFuse).Inc()
+		}
+
+		return "", fmt.Errorf("failed mountmngr.mountFS in mountmngr.mountNative: %w", err)
+	}
+
+	metrics.ActiveMounts.Inc()
+
+	mngr.mounts.Store(vol.Name, &nativeMount{server: server, fsys: fsys})
+
 	return vol.Mountpoint, nil
 }
 
-func (mngr *mountmngr) Unmount(volume *volume.Volume) error {
-	cmd := exec.Command("umount", volume.Mountpoint)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("unable to unmount directory in mountmngr.Unmount: %w", err)
+// Unmount unmounts the volume. Files of the native backend which are still
+// written back to the server are waited for, failed uploads are reported
+// once the volume is unmounted.
+func (mngr *mountmngr) Unmount(ctx context.Context, volume *volume.Volume) (err error) {
+	ctx, span := tracing.Start(ctx, "mountmngr.Unmount", attribute.String("volume.name", volume.Name))
+	defer func() { tracing.End(span, err) }()
+
+	mngr.log(ctx).Debugw("unmounting volume", "name", volume.Name, "mountpoint", volume.Mountpoint)
+
+	var flushErr error
+	if m, ok := mngr.mounts.LoadAndDelete(volume.Name); ok {
+		native := m.(*nativeMount)
+		if err := native.server.Unmount(); err != nil {
+			mngr.mounts.Store(volume.Name, native)
+			metrics.UnmountFailures.WithLabelValues(reasonFuse).Inc()
+			return fmt.Errorf("unable to unmount directory in mountmngr.Unmount: %w", err)
+		}
+
+		_, syncSpan := tracing.Start(ctx, "flush uploads")
+		flushErr = native.fsys.Sync(ctx)
+		tracing.End(syncSpan, flushErr)
+		native.fsys.Close()
+
+		if flushErr != nil {
+			metrics.UnmountFailures.WithLabelValues(reasonUpload).Inc()
+		}
+	} else {
+		umountCtx, cancel := context.WithTimeout(ctx, mngr.opts.UnmountTimeout)
+		defer cancel()
+
+		if err := run(umountCtx, exec.Command("umount", volume.Mountpoint)); err != nil {
+			metrics.UnmountFailures.WithLabelValues(reasonUmount).Inc()
+			return fmt.Errorf("unable to unmount directory in mountmngr.Unmount: %w", err)
+		}
+
+		if session, ok := mngr.sessions.LoadAndDelete(volume.Name); ok {
+			session.(func())()
+		}
 	}
 
+	metrics.ActiveMounts.Dec()
+
 	if err := os.RemoveAll(volume.Mountpoint); err != nil {
+		metrics.UnmountFailures.WithLabelValues(reasonMountpoint).Inc()
 		return fmt.Errorf("failed to remove directory in mountmngr.Unmount: %w", err)
 	}
 
+	if flushErr != nil {
+		return fmt.Errorf("failed ftpfs.FS.Sync in mountmngr.Unmount: %w", flushErr)
+	}
+
 	return nil
 }
 
-func (mngr *mountmngr) Remove(volume *volume.Volume) error {
+// mountFS mounts the native file system within the mount timeout. A mount
+// which completes after the timeout is released in the background.
+func (mngr *mountmngr) mountFS(ctx context.Context, mountpoint string, fsys *ftpfs.FS) (*fuse.Server, error) {
+	ctx, cancel := context.WithTimeout(ctx, mngr.opts.MountTimeout)
+	defer cancel()
+
+	type result struct {
+		server *fuse.Server
+		err    error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		server, err := ftpfs.Mount(mountpoint, fsys)
+		done <- result{server: server, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			fsys.Close()
+		}
+
+		return res.server, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-done; res.err == nil {
+				_ = res.server.Unmount()
+			}
+			fsys.Close()
+		}()
+
+		return nil, fmt.Errorf("mount of '%s' did not finish in mountmngr.mountFS: %w", mountpoint, ctx.Err())
+	}
+}
+
+// release lazily unmounts a mountpoint left behind by a killed mount helper.
+func (mngr *mountmngr) release(ctx context.Context, mountpoint string) {
+	umountCtx, cancel := context.WithTimeout(context.Background(), mngr.opts.UnmountTimeout)
+	defer cancel()
+
+	if err := run(umountCtx, exec.Command("umount", "-l", mountpoint)); err != nil {
+		mngr.log(ctx).Debugw("unable to release mountpoint", "mountpoint", mountpoint, "error", err.Error())
+	}
+}
+
+func (mngr *mountmngr) Remove(ctx context.Context, volume *volume.Volume) error {
 	if err := os.RemoveAll(volume.Mountpoint); err != nil {
 		return fmt.Errorf("failed to remove directory in mountmngr.Remove: %w", err)
 	}
 
+	if err := os.RemoveAll(mngr.spoolDir(volume.Name)); err != nil {
+		return fmt.Errorf("failed to remove spool directory in mountmngr.Remove: %w", err)
+	}
+
 	return nil
 }
+
+// spoolDir returns the spool directory of the native backend of a volume.
+func (mngr *mountmngr) spoolDir(name string) string {
+	return filepath.Join(mngr.opts.SpoolDir, name)
+}
@@ -0,0 +1,254 @@
+package mountmngr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr/ftptest"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/hostlimit"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// fakeCurlFtpFS installs a curlftpfs script which runs body and returns the
+// file counting its runs.
+func fakeCurlFtpFS(t *testing.T, body string) string {
+	bin := t.TempDir()
+	runs := filepath.Join(bin, "runs")
+
+	script := fmt.Sprintf("#!/bin/sh\necho run >> %s\n%s\n", runs, body)
+	require.Nil(t, os.WriteFile(filepath.Join(bin, "curlftpfs"), []byte(script), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	return runs
+}
+
+func countRuns(t *testing.T, runs string) int {
+	data, err := os.ReadFile(runs)
+	require.Nil(t, err)
+
+	return strings.Count(string(data), "run")
+}
+
+func testVolume(t *testing.T) (*volume.Volume, *models.VolumeOptions) {
+	vol := &volume.Volume{Name: "test", Mountpoint: filepath.Join(t.TempDir(), "test")}
+	opt := &models.VolumeOptions{
+		RemotePath:       "/",
+		Backend:          models.BackendCurlFtpFS,
+		FTPConnectionOpt: models.FTPConnectionOpt{Host: "localhost", Port: 21, User: "user", Password: "password"},
+	}
+
+	return vol, opt
+}
+
+func TestCurlFtpFSArgs(t *testing.T) {
+	_, opt := testVolume(t)
+	base := []string{"localhost:21/", "/mnt", "-o", "user=user:password", "-o", "nonempty"}
+
+	t.Run("unknown features", func(t *testing.T) {
+		assert.Equal(t, base, curlFtpFSArgs("localhost:21/", "/mnt", opt))
+	})
+
+	t.Run("utf8 without epsv", func(t *testing.T) {
+		opt.Capabilities = &models.ServerCapabilities{Features: map[string]string{"SIZE": "", "UTF8": ""}}
+		assert.Equal(t, append(base, "-o", "disable_epsv", "-o", "utf8"), curlFtpFSArgs("localhost:21/", "/mnt", opt))
+	})
+
+	t.Run("epsv", func(t *testing.T) {
+		opt.Capabilities = &models.ServerCapabilities{Features: map[string]string{"EPSV": ""}}
+		assert.Equal(t, base, curlFtpFSArgs("localhost:21/", "/mnt", opt))
+	})
+
+	t.Run("encoding", func(t *testing.T) {
+		opt.Capabilities = &models.ServerCapabilities{Features: map[string]string{"EPSV": "", "UTF8": ""}}
+		opt.Encoding = "windows-1251"
+		assert.Equal(t, append(base, "-o", "codepage=windows-1251"), curlFtpFSArgs("localhost:21/", "/mnt", opt))
+	})
+}
+
+func TestMountTimeout(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	runs := fakeCurlFtpFS(t, "sleep 10")
+
+	opts := DefaultOptions()
+	opts.MountTimeout = 100 * time.Millisecond
+	opts.UnmountTimeout = time.Second
+	mngr := NewMountManager(opts, logger)
+
+	vol, opt := testVolume(t)
+
+	begin := time.Now()
+	_, err := mngr.Mount(context.Background(), vol, opt, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(begin), 5*time.Second)
+	assert.Equal(t, 1, countRuns(t, runs))
+}
+
+func TestMountRetry(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	opts := DefaultOptions()
+	opts.Retry = models.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	mngr := NewMountManager(opts, logger)
+
+	tests := []struct {
+		name     string
+		failures int
+		retry    *models.RetryPolicy
+		runs     int
+		err      bool
+	}{
+		{name: "transient failures", failures: 2, runs: 3},
+		{name: "attempts used up", failures: 3, runs: 3, err: true},
+		{name: "volume with more attempts", failures: 3, retry: &models.RetryPolicy{MaxAttempts: 4}, runs: 4},
+		{name: "volume without retries", failures: 1, retry: &models.RetryPolicy{MaxAttempts: 1}, runs: 1, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the script fails until it ran more than failures times
+			runs := fakeCurlFtpFS(t, fmt.Sprintf(`[ $(wc -l < "$(dirname "$0")/runs") -gt %d ]`, test.failures))
+
+			vol, opt := testVolume(t)
+			opt.Retry = test.retry
+
+			_, err := mngr.Mount(context.Background(), vol, opt, nil)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, test.runs, countRuns(t, runs))
+		})
+	}
+}
+
+func TestMountHostLimit(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	fakeCurlFtpFS(t, "true")
+
+	opts := DefaultOptions()
+	opts.Limiter = hostlimit.New(&hostlimit.Options{MaxSessions: 1, WaitTimeout: 50 * time.Millisecond})
+	mngr := NewMountManager(opts, logger)
+
+	vol, opt := testVolume(t)
+	_, err := mngr.Mount(context.Background(), vol, opt, nil)
+	require.Nil(t, err)
+	assert.Equal(t, hostlimit.Stats{Active: 1}, opts.Limiter.Stats(&opt.FTPConnectionOpt))
+
+	other, otherOpt := testVolume(t)
+	other.Name = "other"
+	_, err = mngr.Mount(context.Background(), other, otherOpt, nil)
+	assert.Error(t, err)
+	assert.Equal(t, hostlimit.Stats{Active: 1}, opts.Limiter.Stats(&opt.FTPConnectionOpt))
+}
+
+func TestMountAfterPooledConnection(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	fakeCurlFtpFS(t, "true")
+
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	t.Cleanup(server.Close)
+
+	limiter := hostlimit.New(&hostlimit.Options{MaxSessions: 1, WaitTimeout: 50 * time.Millisecond})
+	ftpOpts := ftpmngr.DefaultOptions()
+	ftpOpts.Limiter = limiter
+	ftpManager := ftpmngr.NewFTPManager(ftpOpts, logger)
+
+	opts := DefaultOptions()
+	opts.Limiter = limiter
+	mngr := NewMountManager(opts, logger)
+
+	// the checks leave an idle connection in the pool of the ftp manager
+	require.Nil(t, ftpManager.CheckConnection(context.Background(), server.Opt()))
+	require.Nil(t, ftpManager.CheckConnection(context.Background(), server.Opt()))
+	assert.Equal(t, 1, server.Accepted())
+	assert.Equal(t, hostlimit.Stats{Active: 1}, limiter.Stats(server.Opt()))
+
+	vol, opt := testVolume(t)
+	opt.FTPConnectionOpt = *server.Opt()
+	_, err = mngr.Mount(context.Background(), vol, opt, nil)
+	require.Nil(t, err)
+	assert.Equal(t, hostlimit.Stats{Active: 1}, limiter.Stats(server.Opt()))
+
+	// the pooled connection was closed for the mount
+	assert.Error(t, ftpManager.CheckConnection(context.Background(), server.Opt()))
+	assert.Equal(t, 1, server.Accepted())
+}
+
+func TestBind(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	bin := t.TempDir()
+	args := filepath.Join(bin, "args")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\n[ \"$3\" != /fail ]\n", args)
+	require.Nil(t, os.WriteFile(filepath.Join(bin, "mount"), []byte(script), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	mngr := NewMountManager(DefaultOptions(), logger)
+	vol, _ := testVolume(t)
+
+	t.Run("binds the directory", func(t *testing.T) {
+		path, err := mngr.Bind(context.Background(), vol, "/cache", false)
+		require.NoError(t, err)
+		assert.Equal(t, vol.Mountpoint, path)
+		assert.DirExists(t, vol.Mountpoint)
+
+		data, err := os.ReadFile(args)
+		require.NoError(t, err)
+		assert.Equal(t, "-o bind /cache "+vol.Mountpoint+"\n", string(data))
+	})
+
+	t.Run("binds read-only", func(t *testing.T) {
+		_, err := mngr.Bind(context.Background(), vol, "/cache", true)
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(args)
+		require.NoError(t, err)
+		assert.Equal(t, "-o bind,ro /cache "+vol.Mountpoint+"\n", string(data))
+	})
+
+	t.Run("failing mount", func(t *testing.T) {
+		_, err := mngr.Bind(context.Background(), vol, "/fail", false)
+		assert.Error(t, err)
+	})
+}
+
+func TestVolumeLog(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	mngr := NewMountManager(DefaultOptions(), zap.New(core).Sugar()).(*mountmngr)
+
+	mngr.volumeLog("data").Info("uploaded")
+
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "data", logs.All()[0].ContextMap()["volume"])
+}
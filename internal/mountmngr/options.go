@@ -0,0 +1,81 @@
+package mountmngr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/filecache"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/hostlimit"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/retry"
+)
+
+// Environment variables read by OptionsFromEnv.
+const (
+	EnvMountTimeout   = "MOUNT_TIMEOUT"
+	EnvUnmountTimeout = "UNMOUNT_TIMEOUT"
+)
+
+const (
+	DefaultMountTimeout   = 30 * time.Second
+	DefaultUnmountTimeout = 30 * time.Second
+)
+
+// Options configures the mount manager. Mount helpers which do not finish
+// within the timeouts are killed, DialTimeout bounds the connections of the
+// native backend. Retry is the driver-wide retry policy of mount attempts.
+type Options struct {
+	MountTimeout   time.Duration
+	UnmountTimeout time.Duration
+	DialTimeout    time.Duration
+	Retry          models.RetryPolicy
+	// Limiter caps the sessions per ftp server, shared with the ftp manager.
+	Limiter *hostlimit.Limiter
+	// Cache keeps the files read through the native backend, it may be nil.
+	Cache *filecache.Cache
+	// SpoolDir holds the spools of the native backend, a directory per
+	// volume. Files which could not be written back stay there until the
+	// next mount of the volume.
+	SpoolDir string
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		MountTimeout:   DefaultMountTimeout,
+		UnmountTimeout: DefaultUnmountTimeout,
+		Retry:          retry.DefaultPolicy(),
+		SpoolDir:       filepath.Join(os.TempDir(), "ftp-driver"),
+	}
+}
+
+// OptionsFromEnv reads the mount manager options with getenv, unset variables
+// keep their defaults.
+func OptionsFromEnv(getenv func(string) string) (*Options, error) {
+	opts := DefaultOptions()
+
+	for key, dst := range map[string]*time.Duration{
+		EnvMountTimeout:   &opts.MountTimeout,
+		EnvUnmountTimeout: &opts.UnmountTimeout,
+	} {
+		value := getenv(key)
+		if value == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid %s value '%s' in mountmngr.OptionsFromEnv", key, value)
+		}
+		*dst = d
+	}
+
+	policy, err := retry.PolicyFromEnv(getenv)
+	if err != nil {
+		return nil, fmt.Errorf("failed retry.PolicyFromEnv in mountmngr.OptionsFromEnv: %w", err)
+	}
+	opts.Retry = policy
+
+	return opts, nil
+}
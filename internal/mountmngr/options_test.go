@@ -0,0 +1,47 @@
+package mountmngr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/retry"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected *Options
+		err      bool
+	}{
+		{
+			name:     "defaults",
+			env:      map[string]string{},
+			expected: DefaultOptions(),
+		},
+		{
+			name:     "timeouts",
+			env:      map[string]string{EnvMountTimeout: "1m", EnvUnmountTimeout: "5s"},
+			expected: &Options{MountTimeout: time.Minute, UnmountTimeout: 5 * time.Second, Retry: retry.DefaultPolicy(), SpoolDir: DefaultOptions().SpoolDir},
+		},
+		{
+			name: "invalid duration",
+			env:  map[string]string{EnvMountTimeout: "30"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := OptionsFromEnv(func(key string) string { return test.env[key] })
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, opts)
+		})
+	}
+}
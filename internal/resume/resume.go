@@ -0,0 +1,205 @@
+// Package resume transfers files over ftp and resumes interrupted transfers
+// with REST instead of starting over, when the server allows it.
+package resume
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/retry"
+)
+
+// Conn is the part of an ftp connection used by the transfers.
+type Conn interface {
+	FileSize(path string) (int64, error)
+	RetrFrom(path string, offset uint64) (*ftp.Response, error)
+	StorFrom(path string, r io.Reader, offset uint64) error
+}
+
+// With runs fn with a connection. A connection broken by fn must be
+// replaced for the next call, so the transfer can be resumed.
+type With func(fn func(conn Conn) error) error
+
+// Stats describes a completed transfer.
+type Stats struct {
+	Bytes   int64
+	Resumes int
+}
+
+// Retr downloads remote into dst. Interrupted attempts are retried under
+// policy from the offset reached. The size of the download is checked
+// against the size reported by the server before and after the transfer.
+func Retr(ctx context.Context, policy models.RetryPolicy, with With, remote string, dst io.WriterAt) (Stats, error) {
+	var stats Stats
+
+	expected, err := fileSize(with, remote)
+	if err != nil {
+		return stats, fmt.Errorf("unable to get size of '%s' in resume.Retr: %w", remote, err)
+	}
+
+	var offset int64
+	rest, attempts := true, 0
+	err = retry.Do(ctx, policy, func(ctx context.Context) error {
+		attempts++
+		if !rest {
+			offset = 0
+		}
+		if attempts > 1 && offset > 0 {
+			stats.Resumes++
+		}
+
+		start := offset
+		err := with(func(conn Conn) error {
+			resp, err := conn.RetrFrom(remote, uint64(offset))
+			if err != nil {
+				return err
+			}
+
+			n, err := io.Copy(&offsetWriter{dst: dst, offset: offset}, resp)
+			offset += n
+			if closeErr := resp.Close(); err == nil {
+				err = closeErr
+			}
+
+			return err
+		})
+
+		return classify(err, start > 0, &rest)
+	}, nil)
+	if err != nil {
+		return stats, fmt.Errorf("unable to download '%s' in resume.Retr: %w", remote, err)
+	}
+
+	stats.Bytes = offset
+
+	if err := verify(with, remote, expected, offset); err != nil {
+		return stats, fmt.Errorf("failed resume.verify in resume.Retr: %w", err)
+	}
+
+	return stats, nil
+}
+
+// Stor uploads size bytes of src to remote. Interrupted attempts are retried
+// under policy from the size the server has received, which is checked
+// against size after the transfer.
+func Stor(ctx context.Context, policy models.RetryPolicy, with With, remote string, src io.ReaderAt, size int64) (Stats, error) {
+	var stats Stats
+
+	var offset int64
+	rest, attempts := true, 0
+	err := retry.Do(ctx, policy, func(ctx context.Context) error {
+		attempts++
+		offset = 0
+		if attempts > 1 && rest {
+			// the server tells how much of the interrupted transfer arrived
+			received, err := fileSize(with, remote)
+			if err != nil {
+				return retry.Transient(err)
+			}
+			if received > 0 && received <= size {
+				offset = received
+				stats.Resumes++
+			}
+		}
+
+		err := with(func(conn Conn) error {
+			return conn.StorFrom(remote, io.NewSectionReader(src, offset, size-offset), uint64(offset))
+		})
+
+		return classify(err, offset > 0, &rest)
+	}, nil)
+	if err != nil {
+		return stats, fmt.Errorf("unable to upload '%s' in resume.Stor: %w", remote, err)
+	}
+
+	stats.Bytes = size
+
+	if err := verify(with, remote, size, size); err != nil {
+		return stats, fmt.Errorf("failed resume.verify in resume.Stor: %w", err)
+	}
+
+	return stats, nil
+}
+
+// classify marks the error of an attempt as worth another attempt when the
+// connection broke, the reply codes are left to the policy. A server refusing
+// REST is not asked to resume again and the transfer starts over.
+func classify(err error, resumed bool, rest *bool) error {
+	if err == nil {
+		return nil
+	}
+
+	var protoErr *textproto.Error
+	if !errors.As(err, &protoErr) {
+		return retry.Transient(err)
+	}
+
+	if resumed && *rest && isRefused(protoErr.Code) {
+		*rest = false
+		return retry.Transient(err)
+	}
+
+	return err
+}
+
+// isRefused reports whether code is the reply of a server which does not
+// understand REST.
+func isRefused(code int) bool {
+	return code == ftp.StatusBadCommand || code == ftp.StatusNotImplemented || code == ftp.StatusNotImplementedParameter
+}
+
+// fileSize returns the size of remote, or -1 when the server does not tell.
+func fileSize(with With, remote string) (int64, error) {
+	size := int64(-1)
+
+	err := with(func(conn Conn) error {
+		n, err := conn.FileSize(remote)
+		if err == nil {
+			size = n
+		}
+		return err
+	})
+
+	var protoErr *textproto.Error
+	if err != nil && !errors.As(err, &protoErr) {
+		return -1, err
+	}
+
+	return size, nil
+}
+
+// verify checks that the transferred bytes match the expected size of remote
+// and that the server still reports it, known sizes of -1 are skipped.
+func verify(with With, remote string, expected, transferred int64) error {
+	if expected >= 0 && transferred != expected {
+		return fmt.Errorf("transferred %d of %d bytes of '%s'", transferred, expected, remote)
+	}
+
+	size, err := fileSize(with, remote)
+	if err != nil {
+		return err
+	}
+
+	if size >= 0 && size != transferred {
+		return fmt.Errorf("'%s' has %d bytes on the server after transferring %d", remote, size, transferred)
+	}
+
+	return nil
+}
+
+// offsetWriter writes to dst from offset on.
+type offsetWriter struct {
+	dst    io.WriterAt
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.dst.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
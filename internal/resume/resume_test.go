@@ -0,0 +1,151 @@
+package resume
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/textproto"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr/ftptest"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+var testPolicy = models.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond, Codes: []int{426}}
+
+// dialer returns a With which dials the server again after a broken
+// connection, like the connection pools of the callers.
+func dialer(t *testing.T, server *ftptest.Server) With {
+	var conn *ftp.ServerConn
+	t.Cleanup(func() {
+		if conn != nil {
+			conn.Quit()
+		}
+	})
+
+	return func(fn func(conn Conn) error) error {
+		if conn == nil {
+			c, err := ftp.Dial(fmt.Sprintf("%s:%d", server.Host, server.Port), ftp.DialWithTimeout(5*time.Second))
+			if err != nil {
+				return err
+			}
+			if err := c.Login(server.User, server.Password); err != nil {
+				c.Quit()
+				return err
+			}
+			conn = c
+		}
+
+		err := fn(conn)
+		if _, ok := err.(*textproto.Error); err != nil && !ok {
+			conn.Quit()
+			conn = nil
+		}
+
+		return err
+	}
+}
+
+func newTestServer(t *testing.T) *ftptest.Server {
+	server, err := ftptest.NewServer("user", "password")
+	require.Nil(t, err)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func retr(t *testing.T, with With, remote string) (Stats, []byte, error) {
+	dst, err := os.CreateTemp(t.TempDir(), "retr")
+	require.Nil(t, err)
+	defer dst.Close()
+
+	stats, err := Retr(context.Background(), testPolicy, with, remote, dst)
+
+	data, readErr := os.ReadFile(dst.Name())
+	require.Nil(t, readErr)
+
+	return stats, data, err
+}
+
+func TestRetr(t *testing.T) {
+	server := newTestServer(t)
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	server.WriteFile("/file", content)
+
+	t.Run("complete", func(t *testing.T) {
+		stats, data, err := retr(t, dialer(t, server), "/file")
+		require.Nil(t, err)
+		assert.Equal(t, Stats{Bytes: int64(len(content)), Resumes: 0}, stats)
+		assert.Equal(t, content, data)
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		server.Interrupt("RETR", 4096)
+
+		stats, data, err := retr(t, dialer(t, server), "/file")
+		require.Nil(t, err)
+		assert.Equal(t, Stats{Bytes: int64(len(content)), Resumes: 1}, stats)
+		assert.Equal(t, content, data)
+	})
+
+	t.Run("rest not supported", func(t *testing.T) {
+		server.SetFeatures("EPSV", "MDTM", "SIZE", "UTF8")
+		defer server.SetFeatures(ftptest.DefaultFeatures...)
+		server.Interrupt("RETR", 4096)
+
+		stats, data, err := retr(t, dialer(t, server), "/file")
+		require.Nil(t, err)
+		assert.Equal(t, int64(len(content)), stats.Bytes)
+		assert.Equal(t, content, data)
+	})
+
+	t.Run("attempts used up", func(t *testing.T) {
+		server.Fail("RETR", 3)
+
+		_, _, err := retr(t, dialer(t, server), "/file")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestStor(t *testing.T) {
+	server := newTestServer(t)
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	t.Run("complete", func(t *testing.T) {
+		stats, err := Stor(context.Background(), testPolicy, dialer(t, server), "/complete", bytes.NewReader(content), int64(len(content)))
+		require.Nil(t, err)
+		assert.Equal(t, Stats{Bytes: int64(len(content)), Resumes: 0}, stats)
+
+		data, _ := server.ReadFile("/complete")
+		assert.Equal(t, content, data)
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		server.Interrupt("STOR", 4096)
+
+		stats, err := Stor(context.Background(), testPolicy, dialer(t, server), "/interrupted", bytes.NewReader(content), int64(len(content)))
+		require.Nil(t, err)
+		assert.Equal(t, Stats{Bytes: int64(len(content)), Resumes: 1}, stats)
+
+		data, _ := server.ReadFile("/interrupted")
+		assert.Equal(t, content, data)
+	})
+
+	t.Run("rest not supported", func(t *testing.T) {
+		server.SetFeatures("EPSV", "MDTM", "SIZE", "UTF8")
+		defer server.SetFeatures(ftptest.DefaultFeatures...)
+		server.Interrupt("STOR", 4096)
+
+		stats, err := Stor(context.Background(), testPolicy, dialer(t, server), "/restarted", bytes.NewReader(content), int64(len(content)))
+		require.Nil(t, err)
+		assert.Equal(t, int64(len(content)), stats.Bytes)
+
+		data, _ := server.ReadFile("/restarted")
+		assert.Equal(t, content, data)
+	})
+}
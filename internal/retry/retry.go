@@ -0,0 +1,193 @@
+// Package retry retries ftp operations which failed with a transient error.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+// Keys of the policy settings, used as RETRY_<KEY> plugin settings and as
+// retry_<key> volume options.
+const (
+	KeyAttempts   = "attempts"
+	KeyBackoff    = "backoff"
+	KeyMaxBackoff = "max_backoff"
+	KeyJitter     = "jitter"
+	KeyCodes      = "codes"
+)
+
+// Keys lists the policy settings.
+var Keys = []string{KeyAttempts, KeyBackoff, KeyMaxBackoff, KeyJitter, KeyCodes}
+
+// DefaultPolicy retries 421 (too many connections), 425 and 426 (data
+// connection failures) twice.
+func DefaultPolicy() models.RetryPolicy {
+	return models.RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     500 * time.Millisecond,
+		MaxBackoff:  10 * time.Second,
+		Jitter:      0.2,
+		Codes:       []int{421, 425, 426},
+	}
+}
+
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// Transient marks err as retryable whatever it wraps, for failures which
+// carry no reply code such as a failed mount helper.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &transientError{err: err}
+}
+
+// Retryable reports whether err is worth retrying under policy: ftp replies
+// with one of the policy codes, network timeouts, connections closed by the
+// server and errors marked with Transient. Errors of a done context are
+// never retried.
+func Retryable(err error, policy models.RetryPolicy) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var transient *transientError
+	if errors.As(err, &transient) {
+		return true
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		for _, code := range policy.Codes {
+			if protoErr.Code == code {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Delay returns the delay before the given retry, counted from 1.
+func Delay(policy models.RetryPolicy, retry int) time.Duration {
+	delay := policy.Backoff
+	for i := 1; i < retry && (policy.MaxBackoff <= 0 || delay < policy.MaxBackoff); i++ {
+		delay *= 2
+	}
+
+	if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+		delay = policy.MaxBackoff
+	}
+
+	if policy.Jitter > 0 {
+		delay += time.Duration(float64(delay) * policy.Jitter * (2*rand.Float64() - 1))
+	}
+
+	return delay
+}
+
+// Do calls op until it succeeds, fails with an error which is not retryable,
+// the attempts of policy are used up or ctx is done. onRetry is called with
+// the failed attempt and its error before waiting for the next one, it may be
+// nil. The error of the last attempt is returned.
+func Do(ctx context.Context, policy models.RetryPolicy, op func(ctx context.Context) error, onRetry func(attempt int, err error)) error {
+	for attempt := 1; ; attempt++ {
+		err := op(ctx)
+		if err == nil || attempt >= policy.MaxAttempts || !Retryable(err, policy) {
+			return err
+		}
+
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+
+		timer := time.NewTimer(Delay(policy, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("retry canceled after %d attempts in retry.Do: %w", attempt, err)
+		case <-timer.C:
+		}
+	}
+}
+
+// ParsePolicy reads the policy settings with get, keyed by the names in Keys.
+// Settings which are not set are left zero.
+func ParsePolicy(get func(key string) string) (*models.RetryPolicy, error) {
+	policy := &models.RetryPolicy{}
+
+	if value := get(KeyAttempts); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts <= 0 {
+			return nil, fmt.Errorf("invalid %s value '%s' in retry.ParsePolicy", KeyAttempts, value)
+		}
+		policy.MaxAttempts = attempts
+	}
+
+	for key, dst := range map[string]*time.Duration{KeyBackoff: &policy.Backoff, KeyMaxBackoff: &policy.MaxBackoff} {
+		value := get(key)
+		if value == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid %s value '%s' in retry.ParsePolicy", key, value)
+		}
+		*dst = d
+	}
+
+	if value := get(KeyJitter); value != "" {
+		jitter, err := strconv.ParseFloat(value, 64)
+		if err != nil || jitter < 0 || jitter > 1 {
+			return nil, fmt.Errorf("invalid %s value '%s' in retry.ParsePolicy", KeyJitter, value)
+		}
+		policy.Jitter = jitter
+	}
+
+	if value := get(KeyCodes); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || code < 100 || code > 599 {
+				return nil, fmt.Errorf("invalid %s value '%s' in retry.ParsePolicy", KeyCodes, value)
+			}
+			policy.Codes = append(policy.Codes, code)
+		}
+	}
+
+	return policy, nil
+}
+
+// PolicyFromEnv reads the driver-wide policy from the RETRY_* variables with
+// getenv on top of DefaultPolicy.
+func PolicyFromEnv(getenv func(string) string) (models.RetryPolicy, error) {
+	policy, err := ParsePolicy(func(key string) string { return getenv("RETRY_" + strings.ToUpper(key)) })
+	if err != nil {
+		return models.RetryPolicy{}, fmt.Errorf("failed retry.ParsePolicy in retry.PolicyFromEnv: %w", err)
+	}
+
+	return DefaultPolicy().Override(policy), nil
+}
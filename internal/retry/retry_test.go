@@ -0,0 +1,142 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+func TestDo(t *testing.T) {
+	policy := models.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Codes: []int{421}}
+	busy := &textproto.Error{Code: 421, Msg: "too many connections"}
+
+	tests := []struct {
+		name     string
+		failures int
+		err      error
+		attempts int
+		retries  int
+	}{
+		{name: "success", failures: 0, err: busy, attempts: 1, retries: 0},
+		{name: "transient failures", failures: 2, err: busy, attempts: 3, retries: 2},
+		{name: "attempts used up", failures: 5, err: busy, attempts: 3, retries: 2},
+		{name: "permanent failure", failures: 5, err: &textproto.Error{Code: 530, Msg: "not logged in"}, attempts: 1, retries: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts, retries := 0, 0
+
+			err := Do(context.Background(), policy, func(ctx context.Context) error {
+				attempts++
+				if attempts <= test.failures {
+					return fmt.Errorf("unable to connect: %w", test.err)
+				}
+				return nil
+			}, func(attempt int, err error) { retries++ })
+
+			if test.failures >= test.attempts {
+				assert.ErrorIs(t, err, test.err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, test.attempts, attempts)
+			assert.Equal(t, test.retries, retries)
+		})
+	}
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := policy
+		slow.Backoff = time.Hour
+		slow.MaxBackoff = time.Hour
+
+		err := Do(ctx, slow, func(ctx context.Context) error { return busy }, func(attempt int, err error) { cancel() })
+		assert.ErrorIs(t, err, busy)
+	})
+}
+
+func TestRetryable(t *testing.T) {
+	policy := DefaultPolicy()
+
+	assert.True(t, Retryable(&textproto.Error{Code: 421}, policy))
+	assert.False(t, Retryable(&textproto.Error{Code: 550}, policy))
+	assert.True(t, Retryable(fmt.Errorf("read greeting: %w", io.EOF), policy))
+	assert.True(t, Retryable(Transient(errors.New("exit status 1")), policy))
+	assert.False(t, Retryable(errors.New("exit status 1"), policy))
+	assert.False(t, Retryable(Transient(context.DeadlineExceeded), policy))
+	assert.False(t, Retryable(nil, policy))
+}
+
+func TestDelay(t *testing.T) {
+	policy := models.RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	assert.Equal(t, 100*time.Millisecond, Delay(policy, 1))
+	assert.Equal(t, 200*time.Millisecond, Delay(policy, 2))
+	assert.Equal(t, 800*time.Millisecond, Delay(policy, 4))
+	assert.Equal(t, time.Second, Delay(policy, 10))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := Delay(policy, 1)
+		assert.GreaterOrEqual(t, delay, 50*time.Millisecond)
+		assert.LessOrEqual(t, delay, 150*time.Millisecond)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]string
+		expected *models.RetryPolicy
+		err      bool
+	}{
+		{
+			name:     "empty",
+			values:   map[string]string{},
+			expected: &models.RetryPolicy{},
+		},
+		{
+			name: "all settings",
+			values: map[string]string{
+				KeyAttempts: "5", KeyBackoff: "1s", KeyMaxBackoff: "30s", KeyJitter: "0.1", KeyCodes: "421, 450",
+			},
+			expected: &models.RetryPolicy{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: 30 * time.Second, Jitter: 0.1, Codes: []int{421, 450}},
+		},
+		{name: "invalid attempts", values: map[string]string{KeyAttempts: "0"}, err: true},
+		{name: "invalid backoff", values: map[string]string{KeyBackoff: "1"}, err: true},
+		{name: "invalid jitter", values: map[string]string{KeyJitter: "2"}, err: true},
+		{name: "invalid codes", values: map[string]string{KeyCodes: "421,abc"}, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := ParsePolicy(func(key string) string { return test.values[key] })
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, policy)
+		})
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	env := map[string]string{"RETRY_ATTEMPTS": "1"}
+
+	policy, err := PolicyFromEnv(func(key string) string { return env[key] })
+	assert.Nil(t, err)
+
+	expected := DefaultPolicy()
+	expected.MaxAttempts = 1
+	assert.Equal(t, expected, policy)
+}
@@ -9,6 +9,20 @@ type StateManager struct {
 	mock.Mock
 }
 
+// CheckState provides a mock function with given fields:
+func (_m *StateManager) CheckState() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SaveState provides a mock function with given fields:
 func (_m *StateManager) SaveState() error {
 	ret := _m.Called()
@@ -23,6 +37,20 @@ func (_m *StateManager) SaveState() error {
 	return r0
 }
 
+// SaveUsage provides a mock function with given fields:
+func (_m *StateManager) SaveUsage() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SyncState provides a mock function with given fields:
 func (_m *StateManager) SyncState() error {
 	ret := _m.Called()
@@ -3,4 +3,6 @@ package statemngr
 type StateManager interface {
 	SyncState() error
 	SaveState() error
+	SaveUsage() error
+	CheckState() error
 }
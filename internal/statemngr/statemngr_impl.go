@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/docker/go-plugins-helpers/volume"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
@@ -19,6 +20,10 @@ type statemanager struct {
 	mountpoint      string
 	volumesInfoPath string
 	optionsInfoPath string
+	usageInfoPath   string
+	// usageMu serializes the writes of the usage file, it is saved while
+	// volumes are mounted as well as with the rest of the state.
+	usageMu sync.Mutex
 }
 
 // errors
@@ -28,10 +33,17 @@ var (
 	OptionsInfoFileNotFoundError = errors.New("Options info file not found")
 )
 
+// StateDir returns the directory of the driver state below mountpoint. The
+// local data of the volumes lives there too, apart from their mountpoints.
+func StateDir(mountpoint string) string {
+	return filepath.Join(mountpoint, "state")
+}
+
 func NewStateManager(mountpoint string, logger pkgLogger.Logger, rep pkgVolume.VolumeRepository) (StateManager, error) {
-	volumesPath := filepath.Join(mountpoint, "state", "volumes.json")
-	optionsPath := filepath.Join(mountpoint, "state", "options.json")
-	if err := os.MkdirAll(filepath.Join(mountpoint, "state"), 0755); err != nil {
+	volumesPath := filepath.Join(StateDir(mountpoint), "volumes.json")
+	optionsPath := filepath.Join(StateDir(mountpoint), "options.json")
+	usagePath := filepath.Join(StateDir(mountpoint), "usage.json")
+	if err := os.MkdirAll(StateDir(mountpoint), 0755); err != nil {
 		return nil, fmt.Errorf("unable to create state directory in NewStateManager: %w", err)
 	}
 
@@ -40,6 +52,7 @@ func NewStateManager(mountpoint string, logger pkgLogger.Logger, rep pkgVolume.V
 		mountpoint:      mountpoint,
 		volumesInfoPath: volumesPath,
 		optionsInfoPath: optionsPath,
+		usageInfoPath:   usagePath,
 		logger:          logger,
 	}, nil
 }
@@ -59,6 +72,17 @@ func (mng *statemanager) SyncState() error {
 		}
 	}
 
+	usage, err := mng.readUsage()
+	if err != nil {
+		return fmt.Errorf("unable to read usage in statemngr.SyncSate: %w", err)
+	}
+
+	for key, used := range usage {
+		if _, ok := volumes[key]; ok {
+			mng.rep.GetQuotaUsage(key).Set(used)
+		}
+	}
+
 	return nil
 }
 
@@ -70,12 +94,16 @@ func (mnr *statemanager) SaveState() error {
 
 	volumesMap := make(map[string]volume.Volume)
 	optionsMap := make(map[string]models.VolumeOptions)
+	usageMap := make(map[string]int64)
 
 	for _, vol := range volumesList {
 		volumesMap[vol.Name] = *vol
 		options := mnr.rep.GetVolumeOptions(vol.Name)
 		if options != nil {
 			optionsMap[vol.Name] = *options
+			if options.Quota > 0 {
+				usageMap[vol.Name] = mnr.rep.GetQuotaUsage(vol.Name).Used()
+			}
 		}
 	}
 
@@ -97,6 +125,56 @@ func (mnr *statemanager) SaveState() error {
 		return fmt.Errorf("unable to write options in statemngr.SaveState: %w", err)
 	}
 
+	if err := mnr.writeUsage(usageMap); err != nil {
+		return fmt.Errorf("failed statemngr.writeUsage in statemngr.SaveState: %w", err)
+	}
+
+	return nil
+}
+
+// SaveUsage writes the quota usage of the volumes without the rest of the
+// state. It is called periodically while volumes with a quota are mounted so
+// a crash does not lose the writes made since the mount.
+func (mnr *statemanager) SaveUsage() error {
+	volumesList, err := mnr.rep.List()
+	if err != nil {
+		return fmt.Errorf("unable to repository.List() in statemngr.SaveUsage: %w", err)
+	}
+
+	usageMap := make(map[string]int64)
+	for _, vol := range volumesList {
+		if options := mnr.rep.GetVolumeOptions(vol.Name); options != nil && options.Quota > 0 {
+			usageMap[vol.Name] = mnr.rep.GetQuotaUsage(vol.Name).Used()
+		}
+	}
+
+	if err := mnr.writeUsage(usageMap); err != nil {
+		return fmt.Errorf("failed statemngr.writeUsage in statemngr.SaveUsage: %w", err)
+	}
+
+	return nil
+}
+
+// writeUsage replaces the usage file through a rename, a crash while writing
+// leaves the previous file in place.
+func (mnr *statemanager) writeUsage(usage map[string]int64) error {
+	usageJson, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("unable to serialize volumes usage in statemngr.writeUsage: %w", err)
+	}
+
+	mnr.usageMu.Lock()
+	defer mnr.usageMu.Unlock()
+
+	tmp := mnr.usageInfoPath + ".tmp"
+	if err := os.WriteFile(tmp, usageJson, 0644); err != nil {
+		return fmt.Errorf("unable to write usage in statemngr.writeUsage: %w", err)
+	}
+
+	if err := os.Rename(tmp, mnr.usageInfoPath); err != nil {
+		return fmt.Errorf("unable to replace usage in statemngr.writeUsage: %w", err)
+	}
+
 	return nil
 }
 
@@ -132,3 +210,38 @@ func (mng *statemanager) readState() (map[string]volume.Volume, map[string]model
 
 	return volumes, options, nil
 }
+
+// readUsage reads the quota usage of the volumes, a missing file means that
+// no usage was recorded yet.
+func (mng *statemanager) readUsage() (map[string]int64, error) {
+	usage := make(map[string]int64)
+
+	data, err := os.ReadFile(mng.usageInfoPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return usage, nil
+		}
+		return usage, fmt.Errorf("unable to read usage state from file in statemngr.readUsage: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return usage, fmt.Errorf("unable to desirialize usage state in statemngr.readUsage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// CheckState checks that the state files can be read and parsed. Missing
+// files are fine, they are created on the first change.
+func (mng *statemanager) CheckState() error {
+	if _, _, err := mng.readState(); err != nil &&
+		!errors.Is(err, VolumeInfoFileNotFoundError) && !errors.Is(err, OptionsInfoFileNotFoundError) {
+		return fmt.Errorf("unable to read state in statemngr.CheckState: %w", err)
+	}
+
+	if _, err := mng.readUsage(); err != nil {
+		return fmt.Errorf("unable to read usage in statemngr.CheckState: %w", err)
+	}
+
+	return nil
+}
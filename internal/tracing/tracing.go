@@ -0,0 +1,133 @@
+// Package tracing sets up OpenTelemetry tracing for the driver. Spans are
+// exported to an OTLP collector over http or written to a file as JSON.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName = "docker-volume-ftp-driver"
+	tracerName  = "github.com/t1d333/docker-volume-ftp-driver"
+)
+
+// Exporters selected by TRACES_EXPORTER.
+const (
+	ExporterNone = "none"
+	ExporterOTLP = "otlp"
+	ExporterFile = "file"
+)
+
+// Environment variables read by ConfigFromEnv. The OTLP exporter also reads
+// the standard OTEL_EXPORTER_OTLP_* variables.
+const (
+	EnvExporter = "TRACES_EXPORTER"
+	EnvFile     = "TRACES_FILE"
+)
+
+type Config struct {
+	Exporter string
+	// File receives the spans of the file exporter.
+	File string
+}
+
+// ConfigFromEnv reads the tracing configuration with getenv. Tracing is
+// disabled unless TRACES_EXPORTER is set, the file exporter writes to
+// defaultFile unless TRACES_FILE is set.
+func ConfigFromEnv(getenv func(string) string, defaultFile string) (*Config, error) {
+	conf := &Config{Exporter: ExporterNone, File: getenv(EnvFile)}
+	if conf.File == "" {
+		conf.File = defaultFile
+	}
+
+	if value := getenv(EnvExporter); value != "" {
+		switch value = strings.ToLower(value); value {
+		case ExporterNone, ExporterOTLP, ExporterFile:
+			conf.Exporter = value
+		default:
+			return nil, fmt.Errorf("invalid %s value '%s' in tracing.ConfigFromEnv", EnvExporter, value)
+		}
+	}
+
+	return conf, nil
+}
+
+// Setup installs the global tracer provider for conf. The returned function
+// flushes the pending spans and stops the exporter.
+func Setup(ctx context.Context, conf *Config) (func(context.Context) error, error) {
+	var (
+		exporter sdktrace.SpanExporter
+		file     *os.File
+		err      error
+	)
+
+	switch conf.Exporter {
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create otlp exporter in tracing.Setup: %w", err)
+		}
+	case ExporterFile:
+		file, err = os.OpenFile(conf.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open traces file in tracing.Setup: %w", err)
+		}
+
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("unable to create file exporter in tracing.Setup: %w", err)
+		}
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+
+		return err
+	}, nil
+}
+
+// Start starts a span of the driver tracer. Without Setup spans are not
+// recorded.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := map[string]struct {
+		env      map[string]string
+		expected *Config
+		isErr    bool
+	}{
+		"defaults": {
+			env:      map[string]string{},
+			expected: &Config{Exporter: ExporterNone, File: "/state/traces.json"},
+		},
+		"otlp exporter": {
+			env:      map[string]string{EnvExporter: "OTLP"},
+			expected: &Config{Exporter: ExporterOTLP, File: "/state/traces.json"},
+		},
+		"file exporter": {
+			env:      map[string]string{EnvExporter: "file", EnvFile: "/tmp/traces.json"},
+			expected: &Config{Exporter: ExporterFile, File: "/tmp/traces.json"},
+		},
+		"invalid exporter": {
+			env:   map[string]string{EnvExporter: "jaeger"},
+			isErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf, err := ConfigFromEnv(func(key string) string { return test.env[key] }, "/state/traces.json")
+			if test.isErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.Nil(t, err)
+			assert.Equal(t, test.expected, conf)
+		})
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "traces.json")
+
+	shutdown, err := Setup(context.Background(), &Config{Exporter: ExporterFile, File: file})
+	require.Nil(t, err)
+
+	ctx, parent := Start(context.Background(), "FTPDriver.Mount")
+	_, child := Start(ctx, "ftp.dial")
+	End(child, errors.New("connection refused"))
+	End(parent, nil)
+
+	require.Nil(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(file)
+	require.Nil(t, err)
+
+	type span struct {
+		Name        string
+		SpanContext struct{ TraceID, SpanID string }
+		Parent      struct{ SpanID string }
+		Status      struct{ Code string }
+	}
+
+	spans := map[string]*span{}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	for decoder.More() {
+		s := &span{}
+		require.Nil(t, decoder.Decode(s))
+		spans[s.Name] = s
+	}
+
+	require.Contains(t, spans, "FTPDriver.Mount")
+	require.Contains(t, spans, "ftp.dial")
+	assert.Equal(t, spans["FTPDriver.Mount"].SpanContext.TraceID, spans["ftp.dial"].SpanContext.TraceID)
+	assert.Equal(t, spans["FTPDriver.Mount"].SpanContext.SpanID, spans["ftp.dial"].Parent.SpanID)
+	assert.Equal(t, "Error", spans["ftp.dial"].Status.Code)
+}
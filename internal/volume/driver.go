@@ -1,8 +1,16 @@
 package volume
 
 import (
+	"context"
+	"strings"
+	"time"
+
 	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/google/uuid"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/metrics"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/tracing"
 	pkgLogger "github.com/t1d333/docker-volume-ftp-driver/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type FTPDriver struct {
@@ -14,47 +22,88 @@ func InitializeNewFTPDriver(serv VolumeService, logger pkgLogger.Logger) *FTPDri
 	return &FTPDriver{logger: logger, serv: serv}
 }
 
-func (d *FTPDriver) Create(req *volume.CreateRequest) error {
-	d.logger.Infow("create request", "name", req.Name, "opt", req.Options)
-	return d.serv.Create(req.Name, req.Options)
+// start starts the root span of a plugin request and attaches a new
+// correlation id to its context. The returned function ends the span and
+// records the request metrics.
+func (d *FTPDriver) start(method string, attrs ...attribute.KeyValue) (context.Context, func(err error)) {
+	begin := time.Now()
+	id := uuid.NewString()
+	ctx := pkgLogger.WithCorrelationID(context.Background(), id)
+	ctx, span := tracing.Start(ctx, "FTPDriver."+method, append(attrs, attribute.String(pkgLogger.CorrelationIDKey, id))...)
+
+	return ctx, func(err error) {
+		tracing.End(span, err)
+		metrics.ObserveRequest(strings.ToLower(method), begin, err)
+	}
+}
+
+func (d *FTPDriver) Create(req *volume.CreateRequest) (err error) {
+	ctx, done := d.start("Create", attribute.String("volume.name", req.Name))
+	defer func() { done(err) }()
+
+	pkgLogger.FromContext(ctx, d.logger).Infow("create request", "name", req.Name, "opt", req.Options)
+	return d.serv.Create(ctx, req.Name, req.Options)
 }
 
-func (d *FTPDriver) List() (*volume.ListResponse, error) {
-	d.logger.Info("List request")
-	list, err := d.serv.List()
+func (d *FTPDriver) List() (res *volume.ListResponse, err error) {
+	ctx, done := d.start("List")
+	defer func() { done(err) }()
+
+	pkgLogger.FromContext(ctx, d.logger).Info("List request")
+	list, err := d.serv.List(ctx)
 	return &volume.ListResponse{Volumes: list}, err
 }
 
-func (d *FTPDriver) Get(req *volume.GetRequest) (*volume.GetResponse, error) {
-	d.logger.Infow("get request", "name", req.Name)
-	vol, err := d.serv.Get(req.Name)
+func (d *FTPDriver) Get(req *volume.GetRequest) (res *volume.GetResponse, err error) {
+	ctx, done := d.start("Get", attribute.String("volume.name", req.Name))
+	defer func() { done(err) }()
+
+	pkgLogger.FromContext(ctx, d.logger).Infow("get request", "name", req.Name)
+	vol, err := d.serv.Get(ctx, req.Name)
 	return &volume.GetResponse{Volume: vol}, err
 }
 
-func (d *FTPDriver) Remove(req *volume.RemoveRequest) error {
-	d.logger.Infow("remove request", "name", req.Name)
-	return d.serv.Remove(req.Name)
+func (d *FTPDriver) Remove(req *volume.RemoveRequest) (err error) {
+	ctx, done := d.start("Remove", attribute.String("volume.name", req.Name))
+	defer func() { done(err) }()
+
+	pkgLogger.FromContext(ctx, d.logger).Infow("remove request", "name", req.Name)
+	return d.serv.Remove(ctx, req.Name)
 }
 
-func (d *FTPDriver) Path(req *volume.PathRequest) (*volume.PathResponse, error) {
-	d.logger.Infow("path request", "name", req.Name)
-	path, err := d.serv.Path(req.Name)
+func (d *FTPDriver) Path(req *volume.PathRequest) (res *volume.PathResponse, err error) {
+	ctx, done := d.start("Path", attribute.String("volume.name", req.Name))
+	defer func() { done(err) }()
+
+	pkgLogger.FromContext(ctx, d.logger).Infow("path request", "name", req.Name)
+	path, err := d.serv.Path(ctx, req.Name)
 	return &volume.PathResponse{Mountpoint: path}, err
 }
 
-func (d *FTPDriver) Mount(req *volume.MountRequest) (*volume.MountResponse, error) {
-	d.logger.Infow("mount request", "name", req.Name, "id", req.ID)
-	path, err := d.serv.Mount(req.ID, req.Name)
+func (d *FTPDriver) Mount(req *volume.MountRequest) (res *volume.MountResponse, err error) {
+	ctx, done := d.start("Mount", attribute.String("volume.name", req.Name), attribute.String("mount.id", req.ID))
+	defer func() { done(err) }()
+	ctx = pkgLogger.WithFields(ctx, "mount_id", req.ID)
+
+	pkgLogger.FromContext(ctx, d.logger).Infow("mount request", "name", req.Name)
+	path, err := d.serv.Mount(ctx, req.ID, req.Name)
 	return &volume.MountResponse{Mountpoint: path}, err
 }
 
-func (d *FTPDriver) Unmount(req *volume.UnmountRequest) error {
-	d.logger.Infow("unmount request", "name", req.Name, "id", req.ID)
-	return d.serv.Unmount(req.ID, req.Name)
+func (d *FTPDriver) Unmount(req *volume.UnmountRequest) (err error) {
+	ctx, done := d.start("Unmount", attribute.String("volume.name", req.Name), attribute.String("mount.id", req.ID))
+	defer func() { done(err) }()
+	ctx = pkgLogger.WithFields(ctx, "mount_id", req.ID)
+
+	pkgLogger.FromContext(ctx, d.logger).Infow("unmount request", "name", req.Name)
+	return d.serv.Unmount(ctx, req.ID, req.Name)
 }
 
 func (d *FTPDriver) Capabilities() *volume.CapabilitiesResponse {
-	d.logger.Info("capabilities request")
+	ctx, done := d.start("Capabilities")
+	defer done(nil)
+
+	pkgLogger.FromContext(ctx, d.logger).Info("capabilities request")
 	tmp := d.serv.Capabilities()
 	return &volume.CapabilitiesResponse{Capabilities: tmp}
 }
@@ -1,6 +1,7 @@
 package volume
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/volume/mocks"
+	pkgLogger "github.com/t1d333/docker-volume-ftp-driver/pkg/logger"
 	"go.uber.org/zap"
 )
 
@@ -23,7 +25,7 @@ func TestCreate(t *testing.T) {
 	logger := log.Sugar()
 
 	t.Run("Success creation", func(t *testing.T) {
-		mockServ.On("Create", name, options).Return(nil).Once()
+		mockServ.On("Create", mock.Anything, name, options).Return(nil).Once()
 
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
@@ -35,7 +37,7 @@ func TestCreate(t *testing.T) {
 	expectedErr := errors.New("Failed to create")
 
 	t.Run("Failed creation", func(t *testing.T) {
-		mockServ.On("Create", name, options).Return(expectedErr)
+		mockServ.On("Create", mock.Anything, name, options).Return(expectedErr)
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
 		err := driver.Create(&volume.CreateRequest{Name: name, Options: options})
@@ -62,7 +64,7 @@ func TestGet(t *testing.T) {
 	}
 
 	t.Run("Success get", func(t *testing.T) {
-		mockServ.On("Get", name).Return(expected, nil).Once()
+		mockServ.On("Get", mock.Anything, name).Return(expected, nil).Once()
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
 		got, err := driver.Get(&volume.GetRequest{Name: "test"})
@@ -78,7 +80,7 @@ func TestGet(t *testing.T) {
 	expectedErr := errors.New("Failed to get volume")
 
 	t.Run("Failed get", func(t *testing.T) {
-		mockServ.On("Get", mock.Anything).Return(nil, expectedErr).Once()
+		mockServ.On("Get", mock.Anything, mock.Anything).Return(nil, expectedErr).Once()
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
 		_, err := driver.Get(&volume.GetRequest{Name: "test"})
@@ -97,7 +99,7 @@ func TestList(t *testing.T) {
 	expectedList := make([]*volume.Volume, 0)
 
 	t.Run("Success get list", func(t *testing.T) {
-		mockServ.On("List").Return(expectedList, nil).Once()
+		mockServ.On("List", mock.Anything).Return(expectedList, nil).Once()
 
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
@@ -111,7 +113,7 @@ func TestList(t *testing.T) {
 	expectedErr := errors.New("Failed to get list")
 
 	t.Run("Failed to get list", func(t *testing.T) {
-		mockServ.On("List").Return(make([]*volume.Volume, 0), expectedErr).Once()
+		mockServ.On("List", mock.Anything).Return(make([]*volume.Volume, 0), expectedErr).Once()
 
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
@@ -133,7 +135,7 @@ func TestPath(t *testing.T) {
 	expectedPath := "/test/test1"
 
 	t.Run("Success get path", func(t *testing.T) {
-		mockServ.On("Path", volumeName).Return(expectedPath, nil).Once()
+		mockServ.On("Path", mock.Anything, volumeName).Return(expectedPath, nil).Once()
 
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
@@ -147,7 +149,7 @@ func TestPath(t *testing.T) {
 	expectedErr := errors.New("Failed to get path")
 
 	t.Run("Failed to get path", func(t *testing.T) {
-		mockServ.On("Path", volumeName).Return("", expectedErr).Once()
+		mockServ.On("Path", mock.Anything, volumeName).Return("", expectedErr).Once()
 
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
@@ -167,7 +169,7 @@ func TestRemove(t *testing.T) {
 	volumeName := "test"
 
 	t.Run("Success remove", func(t *testing.T) {
-		mockServ.On("Remove", volumeName).Return(nil).Once()
+		mockServ.On("Remove", mock.Anything, volumeName).Return(nil).Once()
 
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
@@ -179,7 +181,7 @@ func TestRemove(t *testing.T) {
 	expectedErr := errors.New("Failed to remove")
 
 	t.Run("Failed remove", func(t *testing.T) {
-		mockServ.On("Remove", volumeName).Return(expectedErr).Once()
+		mockServ.On("Remove", mock.Anything, volumeName).Return(expectedErr).Once()
 
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
@@ -201,7 +203,7 @@ func TestMount(t *testing.T) {
 	id := uuid.NewString()
 
 	t.Run("Success mount", func(t *testing.T) {
-		mockServ.On("Mount", id, volumeName).Return(expectedPath, nil).Once()
+		mockServ.On("Mount", mock.Anything, id, volumeName).Return(expectedPath, nil).Once()
 
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
@@ -215,7 +217,7 @@ func TestMount(t *testing.T) {
 	expectedErr := errors.New("Failed to mount volume")
 
 	t.Run("Failed mount", func(t *testing.T) {
-		mockServ.On("Mount", id, volumeName).Return(expectedPath, expectedErr).Once()
+		mockServ.On("Mount", mock.Anything, id, volumeName).Return(expectedPath, expectedErr).Once()
 
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
@@ -236,7 +238,7 @@ func TestUnmount(t *testing.T) {
 	id := uuid.NewString()
 
 	t.Run("Success unmount", func(t *testing.T) {
-		mockServ.On("Unmount", id, volumeName).Return(nil).Once()
+		mockServ.On("Unmount", mock.Anything, id, volumeName).Return(nil).Once()
 
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
@@ -248,7 +250,7 @@ func TestUnmount(t *testing.T) {
 	expectedErr := errors.New("Failed to unmount volume")
 
 	t.Run("Failed unmount", func(t *testing.T) {
-		mockServ.On("Unmount", id, volumeName).Return(expectedErr).Once()
+		mockServ.On("Unmount", mock.Anything, id, volumeName).Return(expectedErr).Once()
 
 		driver := InitializeNewFTPDriver(mockServ, logger)
 
@@ -279,3 +281,32 @@ func TestCapabilities(t *testing.T) {
 		assert.Equal(t, expected.Scope, got.Capabilities.Scope)
 	})
 }
+
+func TestCorrelationID(t *testing.T) {
+	mockServ := mocks.NewVolumeService(t)
+	name := "test"
+	id := uuid.NewString()
+
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ids := make([]string, 0)
+	mockServ.On("Mount", mock.Anything, id, name).Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		ids = append(ids, pkgLogger.CorrelationID(ctx))
+		assert.Contains(t, pkgLogger.Fields(ctx), id)
+	}).Return("/test", nil).Twice()
+
+	driver := InitializeNewFTPDriver(mockServ, logger)
+
+	_, err := driver.Mount(&volume.MountRequest{Name: name, ID: id})
+	assert.Nil(t, err)
+	_, err = driver.Mount(&volume.MountRequest{Name: name, ID: id})
+	assert.Nil(t, err)
+
+	assert.Len(t, ids, 2)
+	assert.NotEmpty(t, ids[0])
+	assert.NotEqual(t, ids[0], ids[1])
+}
@@ -3,8 +3,12 @@
 package mocks
 
 import (
+	context "context"
+
 	volume "github.com/docker/go-plugins-helpers/volume"
 	mock "github.com/stretchr/testify/mock"
+
+	models "github.com/t1d333/docker-volume-ftp-driver/internal/models"
 )
 
 // VolumeService is an autogenerated mock type for the VolumeService type
@@ -26,13 +30,13 @@ func (_m *VolumeService) Capabilities() volume.Capability {
 	return r0
 }
 
-// Create provides a mock function with given fields: name, opt
-func (_m *VolumeService) Create(name string, opt map[string]string) error {
-	ret := _m.Called(name, opt)
+// Create provides a mock function with given fields: ctx, name, opt
+func (_m *VolumeService) Create(ctx context.Context, name string, opt map[string]string) error {
+	ret := _m.Called(ctx, name, opt)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, map[string]string) error); ok {
-		r0 = rf(name, opt)
+	if rf, ok := ret.Get(0).(func(context.Context, string, map[string]string) error); ok {
+		r0 = rf(ctx, name, opt)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -40,25 +44,25 @@ func (_m *VolumeService) Create(name string, opt map[string]string) error {
 	return r0
 }
 
-// Get provides a mock function with given fields: name
-func (_m *VolumeService) Get(name string) (*volume.Volume, error) {
-	ret := _m.Called(name)
+// Get provides a mock function with given fields: ctx, name
+func (_m *VolumeService) Get(ctx context.Context, name string) (*volume.Volume, error) {
+	ret := _m.Called(ctx, name)
 
 	var r0 *volume.Volume
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string) (*volume.Volume, error)); ok {
-		return rf(name)
+	if rf, ok := ret.Get(0).(func(context.Context, string) (*volume.Volume, error)); ok {
+		return rf(ctx, name)
 	}
-	if rf, ok := ret.Get(0).(func(string) *volume.Volume); ok {
-		r0 = rf(name)
+	if rf, ok := ret.Get(0).(func(context.Context, string) *volume.Volume); ok {
+		r0 = rf(ctx, name)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*volume.Volume)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(name)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -66,25 +70,41 @@ func (_m *VolumeService) Get(name string) (*volume.Volume, error) {
 	return r0, r1
 }
 
-// List provides a mock function with given fields:
-func (_m *VolumeService) List() ([]*volume.Volume, error) {
-	ret := _m.Called()
+// Health provides a mock function with given fields: ctx
+func (_m *VolumeService) Health(ctx context.Context) *models.HealthReport {
+	ret := _m.Called(ctx)
+
+	var r0 *models.HealthReport
+	if rf, ok := ret.Get(0).(func(context.Context) *models.HealthReport); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.HealthReport)
+		}
+	}
+
+	return r0
+}
+
+// List provides a mock function with given fields: ctx
+func (_m *VolumeService) List(ctx context.Context) ([]*volume.Volume, error) {
+	ret := _m.Called(ctx)
 
 	var r0 []*volume.Volume
 	var r1 error
-	if rf, ok := ret.Get(0).(func() ([]*volume.Volume, error)); ok {
-		return rf()
+	if rf, ok := ret.Get(0).(func(context.Context) ([]*volume.Volume, error)); ok {
+		return rf(ctx)
 	}
-	if rf, ok := ret.Get(0).(func() []*volume.Volume); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(context.Context) []*volume.Volume); ok {
+		r0 = rf(ctx)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*volume.Volume)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -92,23 +112,23 @@ func (_m *VolumeService) List() ([]*volume.Volume, error) {
 	return r0, r1
 }
 
-// Mount provides a mock function with given fields: id, name
-func (_m *VolumeService) Mount(id string, name string) (string, error) {
-	ret := _m.Called(id, name)
+// Mount provides a mock function with given fields: ctx, id, name
+func (_m *VolumeService) Mount(ctx context.Context, id string, name string) (string, error) {
+	ret := _m.Called(ctx, id, name)
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string, string) (string, error)); ok {
-		return rf(id, name)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (string, error)); ok {
+		return rf(ctx, id, name)
 	}
-	if rf, ok := ret.Get(0).(func(string, string) string); ok {
-		r0 = rf(id, name)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) string); ok {
+		r0 = rf(ctx, id, name)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
-	if rf, ok := ret.Get(1).(func(string, string) error); ok {
-		r1 = rf(id, name)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, id, name)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -116,23 +136,23 @@ func (_m *VolumeService) Mount(id string, name string) (string, error) {
 	return r0, r1
 }
 
-// Path provides a mock function with given fields: name
-func (_m *VolumeService) Path(name string) (string, error) {
-	ret := _m.Called(name)
+// Path provides a mock function with given fields: ctx, name
+func (_m *VolumeService) Path(ctx context.Context, name string) (string, error) {
+	ret := _m.Called(ctx, name)
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string) (string, error)); ok {
-		return rf(name)
+	if rf, ok := ret.Get(0).(func(context.Context, string) (string, error)); ok {
+		return rf(ctx, name)
 	}
-	if rf, ok := ret.Get(0).(func(string) string); ok {
-		r0 = rf(name)
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, name)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(name)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -140,13 +160,27 @@ func (_m *VolumeService) Path(name string) (string, error) {
 	return r0, r1
 }
 
-// Remove provides a mock function with given fields: name
-func (_m *VolumeService) Remove(name string) error {
-	ret := _m.Called(name)
+// Refresh provides a mock function with given fields: ctx, name
+func (_m *VolumeService) Refresh(ctx context.Context, name string) error {
+	ret := _m.Called(ctx, name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Remove provides a mock function with given fields: ctx, name
+func (_m *VolumeService) Remove(ctx context.Context, name string) error {
+	ret := _m.Called(ctx, name)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string) error); ok {
-		r0 = rf(name)
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, name)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -154,13 +188,13 @@ func (_m *VolumeService) Remove(name string) error {
 	return r0
 }
 
-// Unmount provides a mock function with given fields: id, name
-func (_m *VolumeService) Unmount(id string, name string) error {
-	ret := _m.Called(id, name)
+// Unmount provides a mock function with given fields: ctx, id, name
+func (_m *VolumeService) Unmount(ctx context.Context, id string, name string) error {
+	ret := _m.Called(ctx, id, name)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, string) error); ok {
-		r0 = rf(id, name)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, id, name)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -16,4 +16,7 @@ type VolumeRepository interface {
 	IsMount(name string) bool
 	GetMountedIdsList(name string) []string
 	GetVolumeOptions(name string) *models.VolumeOptions
+	// SetVolumeOptions replaces the options of an existing volume.
+	SetVolumeOptions(name string, opt *models.VolumeOptions) error
+	GetQuotaUsage(name string) *models.QuotaUsage
 }
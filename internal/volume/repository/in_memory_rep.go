@@ -16,11 +16,12 @@ type repository struct {
 	volumes        *sync.Map
 	options        *sync.Map
 	mountedVolumes *sync.Map
+	quotaUsage     *sync.Map
 	logger         pkgLogger.Logger
 }
 
 func CreateInMemoryRepository(logger pkgLogger.Logger) pkgVolume.VolumeRepository {
-	return &repository{volumes: new(sync.Map), options: new(sync.Map), mountedVolumes: new(sync.Map), logger: logger}
+	return &repository{volumes: new(sync.Map), options: new(sync.Map), mountedVolumes: new(sync.Map), quotaUsage: new(sync.Map), logger: logger}
 }
 
 func (r *repository) Create(v *volume.Volume, opt *models.VolumeOptions) error {
@@ -37,10 +38,32 @@ func (r *repository) Create(v *volume.Volume, opt *models.VolumeOptions) error {
 }
 
 func (r *repository) GetVolumeOptions(name string) *models.VolumeOptions {
-	opt, _ := r.options.Load(name)
+	opt, ok := r.options.Load(name)
+	if !ok {
+		return nil
+	}
+
 	return opt.(*models.VolumeOptions)
 }
 
+func (r *repository) SetVolumeOptions(name string, opt *models.VolumeOptions) error {
+	if opt == nil {
+		return errors.New("Options is nil")
+	}
+
+	if _, err := r.Get(name); err != nil {
+		return err
+	}
+
+	r.options.Store(name, opt)
+	return nil
+}
+
+func (r *repository) GetQuotaUsage(name string) *models.QuotaUsage {
+	usage, _ := r.quotaUsage.LoadOrStore(name, new(models.QuotaUsage))
+	return usage.(*models.QuotaUsage)
+}
+
 func (r *repository) List() ([]*volume.Volume, error) {
 	res := make([]*volume.Volume, 0)
 	r.volumes.Range(func(key any, value any) bool {
@@ -70,6 +93,7 @@ func (r *repository) Remove(name string) error {
 	}
 
 	r.volumes.Delete(name)
+	r.quotaUsage.Delete(name)
 
 	return nil
 }
@@ -192,6 +192,26 @@ func TestGetOptionsSimpe(t *testing.T) {
 	assert.Equal(t, options.Port, got.Port)
 }
 
+func TestSetOptions(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	rep := CreateInMemoryRepository(logger)
+
+	volume := &volume.Volume{Name: "test"}
+	err := rep.Create(volume, &models.VolumeOptions{RemotePath: "/test"})
+	assert.Nil(t, err)
+
+	updated := &models.VolumeOptions{RemotePath: "/test", Capabilities: &models.ServerCapabilities{Features: map[string]string{"SIZE": ""}}}
+	assert.Nil(t, rep.SetVolumeOptions(volume.Name, updated))
+	assert.Equal(t, updated, rep.GetVolumeOptions(volume.Name))
+
+	assert.NotNil(t, rep.SetVolumeOptions("missing", updated))
+	assert.NotNil(t, rep.SetVolumeOptions(volume.Name, nil))
+}
+
 func TestPathSimple(t *testing.T) {
 	conf := zap.NewDevelopmentConfig()
 	conf.Level.SetLevel(zap.PanicLevel)
@@ -366,3 +386,22 @@ func TestGetMountedIdsList(t *testing.T) {
 	assert.Equal(t, 1, len(rep.GetMountedIdsList("test")))
 	assert.Equal(t, id, rep.GetMountedIdsList("test")[0])
 }
+
+func TestGetQuotaUsage(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	rep := CreateInMemoryRepository(logger)
+	volume := &volume.Volume{Name: "test"}
+	assert.Nil(t, rep.Create(volume, &models.VolumeOptions{Quota: 100}))
+
+	usage := rep.GetQuotaUsage(volume.Name)
+	usage.Set(42)
+	assert.Same(t, usage, rep.GetQuotaUsage(volume.Name))
+	assert.Equal(t, int64(42), rep.GetQuotaUsage(volume.Name).Used())
+
+	assert.Nil(t, rep.Remove(volume.Name))
+	assert.Equal(t, int64(0), rep.GetQuotaUsage(volume.Name).Used())
+}
@@ -1,14 +1,22 @@
 package volume
 
-import "github.com/docker/go-plugins-helpers/volume"
+import (
+	"context"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
 
 type VolumeService interface {
-	Create(name string, opt map[string]string) error
-	List() ([]*volume.Volume, error)
-	Get(name string) (*volume.Volume, error)
-	Remove(name string) error
-	Path(name string) (string, error)
-	Mount(id, name string) (string, error)
-	Unmount(id, name string) error
+	Create(ctx context.Context, name string, opt map[string]string) error
+	List(ctx context.Context) ([]*volume.Volume, error)
+	Get(ctx context.Context, name string) (*volume.Volume, error)
+	Remove(ctx context.Context, name string) error
+	Path(ctx context.Context, name string) (string, error)
+	Mount(ctx context.Context, id, name string) (string, error)
+	Unmount(ctx context.Context, id, name string) error
 	Capabilities() volume.Capability
+	Health(ctx context.Context) *models.HealthReport
+	// Refresh syncs the local copy of a mirrored volume.
+	Refresh(ctx context.Context, name string) error
 }
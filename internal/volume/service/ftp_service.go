@@ -1,19 +1,33 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"os"
+	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/audit"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/charset"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/filecache"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/hostlimit"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/mountmngr"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/retry"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/statemngr"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/tracing"
 	pkgVolume "github.com/t1d333/docker-volume-ftp-driver/internal/volume"
 	pkgLogger "github.com/t1d333/docker-volume-ftp-driver/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type service struct {
@@ -21,41 +35,272 @@ type service struct {
 	stateManager statemngr.StateManager
 	mountManager mountmngr.MountManager
 	ftpManager   ftpmngr.FTPManager
+	auditLog     audit.Log
+	limiter      *hostlimit.Limiter
+	cache        *filecache.Cache
 	logger       pkgLogger.Logger
 	mountpoint   string
+	health       *sync.Map
+	// usage holds the last usage of each volume.
+	usage *sync.Map
+	// mirrorLocks serializes the syncs of each mirrored volume, refreshers
+	// holds the channels stopping their periodic refresh.
+	mirrorLocks *sync.Map
+	refreshers  *sync.Map
+	// usageSavers holds the channels stopping the periodic save of the
+	// quota usage of mounted volumes.
+	usageSavers *sync.Map
 }
 
-func CreateFTPService(mountpoint string, ftpManager ftpmngr.FTPManager, mountManager mountmngr.MountManager, stateManager statemngr.StateManager, rep pkgVolume.VolumeRepository, logger pkgLogger.Logger) (pkgVolume.VolumeService, error) {
+func CreateFTPService(mountpoint string, ftpManager ftpmngr.FTPManager, mountManager mountmngr.MountManager, stateManager statemngr.StateManager, rep pkgVolume.VolumeRepository, auditLog audit.Log, limiter *hostlimit.Limiter, cache *filecache.Cache, logger pkgLogger.Logger) (pkgVolume.VolumeService, error) {
 	serv := &service{
+		auditLog:     auditLog,
+		limiter:      limiter,
+		cache:        cache,
 		logger:       logger,
 		rep:          rep,
 		mountpoint:   mountpoint,
 		stateManager: stateManager,
 		mountManager: mountManager,
 		ftpManager:   ftpManager,
+		health:       new(sync.Map),
+		usage:        new(sync.Map),
+		mirrorLocks:  new(sync.Map),
+		refreshers:   new(sync.Map),
+		usageSavers:  new(sync.Map),
 	}
 
 	if err := stateManager.SyncState(); err != nil {
 		switch {
 		case errors.Is(statemngr.OptionsInfoFileNotFoundError, err):
-			return serv, nil
 		case errors.Is(statemngr.VolumeInfoFileNotFoundError, err):
-			return serv, nil
 		default:
 			return serv, err
 		}
 	}
 
+	serv.moveLegacyDir("stage")
+	serv.moveLegacyDir("mirror")
+
 	return serv, nil
 }
 
-func (s *service) Create(name string, opt map[string]string) error {
+// reservedNames can not name volumes, their mountpoints would be the state
+// of the driver or the local data earlier versions kept next to the
+// mountpoints, which an unmount removes.
+var reservedNames = map[string]struct{}{
+	"state":  {},
+	"stage":  {},
+	"mirror": {},
+	"cache":  {},
+}
+
+// moveLegacyDir moves the local data earlier versions kept in dir next to the
+// mountpoints into the state directory.
+func (s *service) moveLegacyDir(dir string) {
+	legacy := filepath.Join(s.mountpoint, dir)
+	target := filepath.Join(statemngr.StateDir(s.mountpoint), dir)
+
+	// the mountpoint of a volume created before the name was reserved
+	if _, err := s.rep.Get(dir); err == nil {
+		return
+	}
+
+	if _, err := os.Stat(legacy); err != nil {
+		return
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		s.logger.Warnf("local volume data left in '%s', '%s' exists already", legacy, target)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		s.logger.Warnf("unable to move local volume data from '%s': %s", legacy, err.Error())
+		return
+	}
+
+	if err := os.Rename(legacy, target); err != nil {
+		s.logger.Warnf("unable to move local volume data from '%s': %s", legacy, err.Error())
+		return
+	}
+
+	s.logger.Infow("moved local volume data into state directory", "from", legacy, "to", target)
+}
+
+func (s *service) Create(ctx context.Context, name string, opt map[string]string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Create", attribute.String("volume.name", name))
+	defer func() { tracing.End(span, err) }()
+
+	defer func() {
+		endpoint := s.endpoint(name)
+		if err != nil {
+			endpoint = fmt.Sprintf("%s@%s:%s%s", opt["user"], opt["host"], opt["port"], opt["remotepath"])
+		}
+		secret := &models.VolumeOptions{FTPConnectionOpt: models.FTPConnectionOpt{Password: opt["password"]}}
+		s.recordAudit(ctx, audit.ActionCreate, name, "", endpoint, secret, err)
+	}()
+
+	if _, ok := reservedNames[name]; ok {
+		return fmt.Errorf("volume name %s is reserved by the driver", name)
+	}
+
 	path, ok := opt["remotepath"]
 
 	if !ok {
 		path = "/"
 	}
 
+	removeRemote := false
+	if value, ok := opt["remove_remote"]; ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("Not a valid remove_remote value")
+		}
+		removeRemote = parsed
+	}
+
+	if removeRemote && isServerRoot(path) {
+		return errors.New("remove_remote can not be used with the server root as remotepath")
+	}
+
+	share, ok := opt["share"]
+	if !ok {
+		share = models.ShareWarn
+	}
+
+	switch share {
+	case models.ShareReject, models.ShareWarn, models.ShareAllow:
+	default:
+		return errors.New("Not a valid share value")
+	}
+
+	backend, ok := opt["backend"]
+	if !ok {
+		backend = models.BackendCurlFtpFS
+	}
+
+	switch backend {
+	case models.BackendCurlFtpFS, models.BackendNative:
+	default:
+		return errors.New("Not a valid backend value")
+	}
+
+	mode, ok := opt["mode"]
+	if !ok {
+		mode = models.ModeMount
+	}
+
+	switch mode {
+	case models.ModeMount, models.ModeStage, models.ModeMirror:
+	default:
+		return errors.New("Not a valid mode value")
+	}
+
+	if removeRemote && mode == models.ModeMirror {
+		return errors.New("remove_remote can not be used with mode=mirror")
+	}
+
+	var refresh time.Duration
+	if value, ok := opt["refresh"]; ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return errors.New("Not a valid refresh value")
+		}
+		refresh = parsed
+	}
+
+	if refresh > 0 && mode != models.ModeMirror {
+		return errors.New("refresh requires mode=mirror")
+	}
+
+	var quota int64
+	if value, ok := opt["quota"]; ok {
+		parsed, err := parseSize(value)
+		if err != nil {
+			return errors.New("Not a valid quota value")
+		}
+		quota = parsed
+	}
+
+	if quota > 0 && backend != models.BackendNative {
+		return errors.New("quota requires the native backend")
+	}
+
+	if quota > 0 && mode != models.ModeMount {
+		return errors.New("quota requires mode=mount")
+	}
+
+	var atomicUpload bool
+	if value, ok := opt["atomic_upload"]; ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("Not a valid atomic_upload value")
+		}
+		atomicUpload = parsed
+	}
+
+	if atomicUpload && backend != models.BackendNative && mode != models.ModeStage {
+		return errors.New("atomic_upload requires the native backend or mode=stage")
+	}
+
+	partialPattern, ok := opt["partial_pattern"]
+	if !ok {
+		partialPattern = models.DefaultPartialPattern
+	}
+
+	if !validPartialPattern(partialPattern) {
+		return errors.New("Not a valid partial_pattern value")
+	}
+
+	var checksum bool
+	if value, ok := opt["checksum"]; ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("Not a valid checksum value")
+		}
+		checksum = parsed
+	}
+
+	if checksum && backend != models.BackendNative {
+		return errors.New("checksum requires the native backend")
+	}
+
+	if checksum && mode != models.ModeMount {
+		return errors.New("checksum requires mode=mount")
+	}
+
+	var encoding string
+	if value, ok := opt["encoding"]; ok {
+		canonical, err := charset.Canonical(value)
+		if err != nil {
+			return errors.New("Not a valid encoding value")
+		}
+		encoding = canonical
+	}
+
+	if encoding != "" && mode != models.ModeMount {
+		return errors.New("encoding requires mode=mount")
+	}
+
+	// only the names below the remote path are transcoded
+	if encoding != "" && !isASCII(path) {
+		return errors.New("encoding requires an ASCII remotepath")
+	}
+
+	serverTZ := opt["server_tz"]
+	if _, err := models.LoadServerLocation(serverTZ); err != nil {
+		return errors.New("Not a valid server_tz value")
+	}
+
+	if serverTZ != "" && backend != models.BackendNative {
+		return errors.New("server_tz requires the native backend")
+	}
+
+	if serverTZ != "" && mode != models.ModeMount {
+		return errors.New("server_tz requires mode=mount")
+	}
+
 	ftpOpt := models.FTPConnectionOpt{}
 
 	if host, ok := opt["host"]; !ok {
@@ -86,65 +331,168 @@ func (s *service) Create(name string, opt map[string]string) error {
 		ftpOpt.Password = password
 	}
 
-	if err := s.ftpManager.CheckConnection(&ftpOpt); err != nil {
+	if hasRetryOptions(opt) {
+		policy, err := retry.ParsePolicy(func(key string) string { return opt["retry_"+key] })
+		if err != nil {
+			return fmt.Errorf("failed retry.ParsePolicy in service.Create: %w", err)
+		}
+		ftpOpt.Retry = policy
+	}
+
+	volumeOpt := &models.VolumeOptions{
+		RemotePath:       path,
+		RemoveRemote:     removeRemote,
+		Share:            share,
+		Backend:          backend,
+		Mode:             mode,
+		Refresh:          refresh,
+		Quota:            quota,
+		AtomicUpload:     atomicUpload,
+		PartialPattern:   partialPattern,
+		Checksum:         checksum,
+		Encoding:         encoding,
+		ServerTZ:         serverTZ,
+		FTPConnectionOpt: ftpOpt,
+	}
+
+	if err := s.checkSharing(ctx, name, volumeOpt); err != nil {
+		return fmt.Errorf("failed service.checkSharing in service.Create: %w", err)
+	}
+
+	if err := s.ftpManager.CheckConnection(ctx, &ftpOpt); err != nil {
 		return fmt.Errorf("failed to ftpManager.CheckConnection in service.Create: %w", err)
 	}
 
-	if err := s.ftpManager.CheckRemoteDir(path, &ftpOpt); err != nil {
+	if err := s.ftpManager.CheckRemoteDir(ctx, path, &ftpOpt); err != nil {
 		return fmt.Errorf("failed to ftpManager.CheckRemoteDir in service.Create: %w", err)
 	}
 
+	// the backends keep their defaults for a server which can not be asked
+	if caps, err := s.ftpManager.Capabilities(ctx, &ftpOpt); err != nil {
+		s.log(ctx).Warnf("unable to discover ftp server features: %s", err.Error())
+	} else {
+		volumeOpt.Capabilities = caps
+	}
+
 	vol := &volume.Volume{
 		Name:       name,
 		CreatedAt:  time.Now().Format(time.RFC3339Nano),
 		Mountpoint: filepath.Join(s.mountpoint, name),
 	}
 
-	volumeOpt := &models.VolumeOptions{
-		RemotePath:       path,
-		FTPConnectionOpt: ftpOpt,
-	}
-
 	if err := s.rep.Create(vol, volumeOpt); err != nil {
 		return fmt.Errorf("failed to repository.Create in service.Create: %w", err)
 	}
 
+	s.setCheckResult(name, volumeOpt, nil)
+
+	if quota > 0 {
+		s.initQuotaUsage(ctx, name, volumeOpt)
+	}
+
 	if err := s.stateManager.SaveState(); err != nil {
-		s.logger.Errorf("Failed to update state data file: %s", err.Error())
+		s.log(ctx).Errorf("Failed to update state data file: %s", err.Error())
 	}
 
 	return nil
 }
 
-func (s *service) List() ([]*volume.Volume, error) {
+// refreshCapabilities discovers the features of the server again before the
+// volume is mounted, the server may have changed since it was last asked.
+// The known features are kept when the server can not be asked.
+func (s *service) refreshCapabilities(ctx context.Context, name string, opt *models.VolumeOptions) *models.VolumeOptions {
+	caps, err := s.ftpManager.Capabilities(ctx, &opt.FTPConnectionOpt)
+	if err != nil {
+		s.log(ctx).Warnf("unable to refresh ftp server features of volume '%s': %s", name, err.Error())
+		return opt
+	}
+
+	updated := *opt
+	updated.Capabilities = caps
+
+	if err := s.rep.SetVolumeOptions(name, &updated); err != nil {
+		s.log(ctx).Warnf("unable to store ftp server features of volume '%s': %s", name, err.Error())
+		return opt
+	}
+
+	if err := s.stateManager.SaveState(); err != nil {
+		s.log(ctx).Errorf("Failed to update state data file: %s", err.Error())
+	}
+
+	return &updated
+}
+
+// log returns the logger with the request fields carried by ctx.
+func (s *service) log(ctx context.Context) pkgLogger.Logger {
+	return pkgLogger.FromContext(ctx, s.logger)
+}
+
+func (s *service) List(ctx context.Context) ([]*volume.Volume, error) {
 	return s.rep.List()
 }
 
-func (s *service) Get(name string) (*volume.Volume, error) {
-	return s.rep.Get(name)
+func (s *service) Get(ctx context.Context, name string) (_ *volume.Volume, err error) {
+	ctx, span := tracing.Start(ctx, "service.Get", attribute.String("volume.name", name))
+	defer func() { tracing.End(span, err) }()
+
+	vol, err := s.rep.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := *vol
+	res.Status = make(map[string]interface{})
+
+	if opt := s.rep.GetVolumeOptions(name); opt != nil {
+		res.Status = s.status(ctx, name, opt)
+	}
+
+	return &res, nil
 }
 
-func (s *service) Remove(name string) error {
+func (s *service) Remove(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Remove", attribute.String("volume.name", name))
+	defer func() { tracing.End(span, err) }()
+
+	endpoint, opt := s.endpoint(name), s.rep.GetVolumeOptions(name)
+	defer func() { s.recordAudit(ctx, audit.ActionRemove, name, "", endpoint, opt, err) }()
+
 	volume, err := s.rep.Get(name)
 	if err != nil {
-		s.logger.Errorf("failed to get volume for remove with name: %s, err : %s", name, err.Error())
+		s.log(ctx).Errorf("failed to get volume for remove with name: %s, err : %s", name, err.Error())
 
 		return fmt.Errorf("failed repository.Get in service.Remove: %w", err)
 	}
 
 	if isMount := s.rep.IsMount(name); isMount {
-		s.logger.Errorf("volume with name '%s' is currently used", name)
+		s.log(ctx).Errorf("volume with name '%s' is currently used", name)
 		return fmt.Errorf("volume with name '%s' is currently used", name)
 	}
 
+	if opt := s.rep.GetVolumeOptions(name); opt != nil && opt.RemoveRemote {
+		if err := s.removeRemoteData(ctx, name, opt); err != nil {
+			return fmt.Errorf("failed service.removeRemoteData in service.Remove: %w", err)
+		}
+	}
+
 	if err := s.rep.Remove(name); err != nil {
 		return fmt.Errorf("failed repository.Remove in service.Remove: %w", err)
 	}
 
-	if err := s.mountManager.Remove(volume); err != nil {
+	s.health.Delete(name)
+	s.usage.Delete(name)
+
+	if err := s.mountManager.Remove(ctx, volume); err != nil {
 		return fmt.Errorf("failed mountmngr.Remove in service.Remove: %w", err)
 	}
 
+	for _, dir := range []string{s.stageDir(name), s.mirrorDir(name)} {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("unable to remove local copy in service.Remove: %w", err)
+		}
+	}
+	s.mirrorLocks.Delete(name)
+
 	if err := s.stateManager.SaveState(); err != nil {
 		return fmt.Errorf("failed statemngr.SaveState in service.Remove: %w", err)
 	}
@@ -152,14 +500,21 @@ func (s *service) Remove(name string) error {
 	return nil
 }
 
-func (s *service) Path(name string) (string, error) {
+func (s *service) Path(ctx context.Context, name string) (string, error) {
 	return s.rep.Path(name)
 }
 
-func (s *service) Mount(id, name string) (string, error) {
-	volume, err := s.Get(name)
+func (s *service) Mount(ctx context.Context, id, name string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "service.Mount", attribute.String("volume.name", name), attribute.String("mount.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	defer func() {
+		s.recordAudit(ctx, audit.ActionMount, name, id, s.endpoint(name), s.rep.GetVolumeOptions(name), err)
+	}()
+
+	volume, err := s.rep.Get(name)
 	if err != nil {
-		return "", fmt.Errorf("failed service.Get in service.Mount: %w", err)
+		return "", fmt.Errorf("failed repository.Get in service.Mount: %w", err)
 	}
 
 	if s.rep.IsMount(volume.Name) {
@@ -170,20 +525,44 @@ func (s *service) Mount(id, name string) (string, error) {
 		return "", fmt.Errorf("failed repository.Mount in service.Mount: %w", err)
 	}
 
-	opt := s.rep.GetVolumeOptions(volume.Name)
+	opt := s.refreshCapabilities(ctx, volume.Name, s.rep.GetVolumeOptions(volume.Name))
 
-	path, err := s.mountManager.Mount(volume, opt)
+	var path string
+	switch opt.Mode {
+	case models.ModeStage:
+		path, err = s.mountStaged(ctx, volume, opt)
+	case models.ModeMirror:
+		path, err = s.mountMirror(ctx, volume, opt)
+	default:
+		path, err = s.mountManager.Mount(ctx, volume, opt, s.rep.GetQuotaUsage(volume.Name))
+	}
+	s.setMountResult(volume.Name, opt, err)
 	if err != nil {
+		if err := s.rep.Unmount(id, volume.Name); err != nil {
+			s.log(ctx).Errorf("failed to release mount of volume '%s': %s", volume.Name, err.Error())
+		}
+
 		return path, fmt.Errorf("failed mountmngr.Mount in service.Mount: %w", err)
 	}
 
+	if opt.Quota > 0 {
+		s.startUsageSaver(volume.Name)
+	}
+
 	return path, nil
 }
 
-func (s *service) Unmount(id, name string) error {
-	volume, err := s.Get(name)
+func (s *service) Unmount(ctx context.Context, id, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Unmount", attribute.String("volume.name", name), attribute.String("mount.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	defer func() {
+		s.recordAudit(ctx, audit.ActionUnmount, name, id, s.endpoint(name), s.rep.GetVolumeOptions(name), err)
+	}()
+
+	volume, err := s.rep.Get(name)
 	if err != nil {
-		return fmt.Errorf("failed service.Get in service.Unmount: %w", err)
+		return fmt.Errorf("failed repository.Get in service.Unmount: %w", err)
 	}
 
 	if !s.rep.IsMount(volume.Name) {
@@ -198,13 +577,213 @@ func (s *service) Unmount(id, name string) error {
 		return nil
 	}
 
-	if err := s.mountManager.Unmount(volume); err != nil {
+	s.stopRefresh(name)
+	s.stopUsageSaver(name)
+
+	if err := s.mountManager.Unmount(ctx, volume); err != nil {
 		return fmt.Errorf("failed mountmngr.Mount in service.Mount: %w", err)
 	}
 
+	if opt := s.rep.GetVolumeOptions(name); opt != nil && opt.Mode == models.ModeStage {
+		if err := s.unstage(ctx, name, opt); err != nil {
+			return fmt.Errorf("failed service.unstage in service.Unmount: %w", err)
+		}
+	}
+
+	if err := s.stateManager.SaveState(); err != nil {
+		s.log(ctx).Errorf("Failed to update state data file: %s", err.Error())
+	}
+
 	return nil
 }
 
 func (s *service) Capabilities() volume.Capability {
 	return volume.Capability{Scope: "local"}
 }
+
+// removeRemoteData deletes the remote directory of the volume unless it is the
+// server root or is shared with another volume. Skipped deletions are logged
+// and do not prevent the volume from being removed.
+func (s *service) removeRemoteData(ctx context.Context, name string, opt *models.VolumeOptions) error {
+	if isServerRoot(opt.RemotePath) {
+		s.log(ctx).Warnf("keeping remote data of volume '%s': remote path is the server root", name)
+		return nil
+	}
+
+	if shared := s.overlappingVolumes(ctx, name, opt); len(shared) != 0 {
+		s.log(ctx).Warnf("keeping remote data of volume '%s': remote path is shared with volumes %v", name, shared)
+		return nil
+	}
+
+	if err := s.ftpManager.RemoveRemoteDir(ctx, path.Clean(opt.RemotePath), &opt.FTPConnectionOpt); err != nil {
+		return fmt.Errorf("failed ftpManager.RemoveRemoteDir in service.removeRemoteData: %w", err)
+	}
+
+	return nil
+}
+
+// recordAudit appends a lifecycle event to the audit log, the error is
+// stripped of the password of opt. A failing audit log is logged but does not
+// fail the operation.
+func (s *service) recordAudit(ctx context.Context, action, name, id, endpoint string, opt *models.VolumeOptions, err error) {
+	event := audit.NewEvent(action, name, err)
+	event.ContainerID = id
+	event.Endpoint = endpoint
+	event.Error = redact(event.Error, opt)
+
+	if err := s.auditLog.Record(event); err != nil {
+		s.log(ctx).Errorf("failed to record audit event '%s' of volume '%s': %s", action, name, err.Error())
+	}
+}
+
+// endpoint describes the remote directory of a volume without its password.
+func (s *service) endpoint(name string) string {
+	opt := s.rep.GetVolumeOptions(name)
+	if opt == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s@%s:%d%s", opt.User, opt.Host, opt.Port, opt.RemotePath)
+}
+
+// initQuotaUsage seeds the quota usage of a new volume with the size of the
+// data already stored under its remote path. Only the walk of the path is
+// used, the account usage reported by SITE QUOTA covers other directories.
+func (s *service) initQuotaUsage(ctx context.Context, name string, opt *models.VolumeOptions) {
+	usage, err := s.ftpManager.Usage(ctx, opt.RemotePath, &opt.FTPConnectionOpt)
+	if err != nil {
+		s.log(ctx).Warnf("unable to get initial usage of volume '%s': %s", name, redact(err.Error(), opt))
+		return
+	}
+
+	if usage.Used > 0 {
+		s.rep.GetQuotaUsage(name).Set(usage.Used)
+	}
+}
+
+// checkSharing applies the share mode of a new volume to the volumes already
+// using an overlapping remote path on the same ftp server. Sharing is rejected
+// if either side asked for it.
+func (s *service) checkSharing(ctx context.Context, name string, opt *models.VolumeOptions) error {
+	shared := s.overlappingVolumes(ctx, name, opt)
+	if len(shared) == 0 {
+		return nil
+	}
+
+	if opt.Share == models.ShareReject {
+		return fmt.Errorf("remote path '%s' overlaps with volumes %v", opt.RemotePath, shared)
+	}
+
+	for _, other := range shared {
+		if otherOpt := s.rep.GetVolumeOptions(other); otherOpt != nil && otherOpt.Share == models.ShareReject {
+			return fmt.Errorf("remote path '%s' overlaps with volume '%s' which does not allow sharing", opt.RemotePath, other)
+		}
+	}
+
+	if opt.Share != models.ShareAllow {
+		s.log(ctx).Warnf("remote path of volume '%s' overlaps with volumes %v", name, shared)
+	}
+
+	return nil
+}
+
+// overlappingVolumes returns the names of the other volumes on the same ftp
+// server whose remote path is equal to, contains or is contained in the
+// remote path of opt.
+func (s *service) overlappingVolumes(ctx context.Context, name string, opt *models.VolumeOptions) []string {
+	res := make([]string, 0)
+
+	volumes, err := s.rep.List()
+	if err != nil {
+		s.log(ctx).Errorf("failed to list volumes: %s", err.Error())
+		return res
+	}
+
+	for _, vol := range volumes {
+		if vol.Name == name {
+			continue
+		}
+
+		other := s.rep.GetVolumeOptions(vol.Name)
+		if other == nil || !isSameServer(&opt.FTPConnectionOpt, &other.FTPConnectionOpt) {
+			continue
+		}
+
+		if isNestedPath(opt.RemotePath, other.RemotePath) || isNestedPath(other.RemotePath, opt.RemotePath) {
+			res = append(res, vol.Name)
+		}
+	}
+
+	return res
+}
+
+// hasRetryOptions reports whether the volume overrides the retry policy.
+func hasRetryOptions(opt map[string]string) bool {
+	for _, key := range retry.Keys {
+		if _, ok := opt["retry_"+key]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isSameServer(a, b *models.FTPConnectionOpt) bool {
+	return strings.EqualFold(a.Host, b.Host) && a.Port == b.Port
+}
+
+func isServerRoot(remotepath string) bool {
+	return path.Clean("/"+remotepath) == "/"
+}
+
+// isNestedPath reports whether child is equal to parent or lies below it.
+func isNestedPath(child, parent string) bool {
+	child = path.Clean("/" + child)
+	parent = path.Clean("/" + parent)
+
+	return child == parent || parent == "/" || strings.HasPrefix(child, parent+"/")
+}
+
+// validPartialPattern reports whether pattern names a temporary file next to
+// the uploaded one which differs from it.
+func validPartialPattern(pattern string) bool {
+	return strings.Contains(pattern, models.PartialPlaceholder) &&
+		pattern != models.PartialPlaceholder &&
+		!strings.Contains(pattern, "/")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseSize parses a size in bytes with an optional binary unit suffix
+// (K, M, G or T, optionally followed by B or iB).
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+
+	multiplier := int64(1)
+	if n := len(value); n > 0 {
+		if shift := strings.IndexByte("KMGT", value[n-1]); shift >= 0 {
+			multiplier = int64(1) << (10 * (shift + 1))
+			value = value[:n-1]
+		}
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size in service.parseSize: %w", err)
+	}
+
+	if size < 0 || size > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size '%s' out of range in service.parseSize", value)
+	}
+
+	return size * multiplier, nil
+}
@@ -1,7 +1,12 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,14 +15,38 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/audit"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/filecache"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr"
 	ftpMock "github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr/mocks"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/hostlimit"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
 	mountMock "github.com/t1d333/docker-volume-ftp-driver/internal/mountmngr/mocks"
 	stateMock "github.com/t1d333/docker-volume-ftp-driver/internal/statemngr/mocks"
+	pkgVolume "github.com/t1d333/docker-volume-ftp-driver/internal/volume"
 	"github.com/t1d333/docker-volume-ftp-driver/internal/volume/repository"
 	"go.uber.org/zap"
 )
 
+var testCapabilities = &models.ServerCapabilities{Features: map[string]string{"EPSV": "", "SIZE": "", "UTF8": ""}}
+
+// waitUsageRefresh waits for the background refresh of the usage of the
+// volume to finish.
+func waitUsageRefresh(t *testing.T, serv pkgVolume.VolumeService, name string) {
+	require.Eventually(t, func() bool {
+		value, ok := serv.(*service).usage.Load(name)
+		if !ok {
+			return true
+		}
+
+		entry := value.(*volumeUsage)
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+
+		return !entry.refreshing
+	}, time.Second, time.Millisecond)
+}
+
 func TestGet(t *testing.T) {
 	conf := zap.NewDevelopmentConfig()
 	conf.Level.SetLevel(zap.PanicLevel)
@@ -37,31 +66,131 @@ func TestGet(t *testing.T) {
 		CreatedAt:  time.Now().Format(time.RFC3339Nano),
 	}
 
-	err := rep.Create(inVolume, &models.VolumeOptions{})
+	err := rep.Create(inVolume, &models.VolumeOptions{
+		RemotePath:       "/data",
+		FTPConnectionOpt: models.FTPConnectionOpt{Host: "localhost", Port: 21, User: "user", Password: "secret"},
+	})
+
+	require.Nil(t, err)
+
+	id := uuid.NewString()
+	err = rep.Mount(id, inVolume)
 
 	require.Nil(t, err)
 
 	statemngr.On("SyncState").Return(nil)
 
+	usage := &models.VolumeUsage{Used: 1024, Available: -1, AccountUsed: -1, Quota: -1, Sources: []string{models.UsageSourceWalk}, CheckedAt: time.Now()}
+	ftpmngr.On("Usage", mock.Anything, "/data", mock.Anything).Return(usage, nil).Once()
+
 	t.Run("succsess get volume", func(t *testing.T) {
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		got, err := serv.Get("test")
+		got, err := serv.Get(context.Background(), "test")
+		require.Nil(t, err)
+		assert.NotContains(t, got.Status, "usage")
 
+		// the usage is refreshed in the background
+		waitUsageRefresh(t, serv, "test")
+		got, err = serv.Get(context.Background(), "test")
 		require.Nil(t, err)
 
 		assert.Equal(t, inVolume.Name, got.Name)
 		assert.Equal(t, inVolume.CreatedAt, got.CreatedAt)
 		assert.Equal(t, inVolume.Mountpoint, got.Mountpoint)
-		assert.Equal(t, inVolume.Status, got.Status)
+
+		assert.Equal(t, "localhost", got.Status["host"])
+		assert.Equal(t, 21, got.Status["port"])
+		assert.Equal(t, "user", got.Status["user"])
+		assert.Equal(t, "/data", got.Status["remotepath"])
+		assert.Equal(t, true, got.Status["mounted"])
+		assert.Equal(t, []string{id}, got.Status["mounted_by"])
+		assert.NotContains(t, got.Status, "password")
+		assert.NotContains(t, got.Status, "last_mount_error")
+
+		require.Contains(t, got.Status, "usage")
+		assert.Equal(t, int64(1024), got.Status["usage"].(map[string]interface{})["used"])
+		assert.NotContains(t, got.Status["usage"], "available")
+	})
+
+	t.Run("host sessions", func(t *testing.T) {
+		ftpmngr.On("Usage", mock.Anything, "/data", mock.Anything).Return(usage, nil).Once()
+
+		limiter := hostlimit.New(&hostlimit.Options{MaxSessions: 2, WaitTimeout: time.Second})
+		release, err := limiter.Acquire(context.Background(), &models.FTPConnectionOpt{Host: "LOCALHOST", Port: 21})
+		require.NoError(t, err)
+		defer release()
+
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), limiter, nil, logger)
+		require.Nil(t, err)
+
+		got, err := serv.Get(context.Background(), "test")
+		require.Nil(t, err)
+
+		assert.Equal(t, 1, got.Status["host_sessions"])
+		assert.Equal(t, 0, got.Status["host_queue"])
+		waitUsageRefresh(t, serv, "test")
+	})
+
+	t.Run("failed usage refresh", func(t *testing.T) {
+		ftpmngr.On("Usage", mock.Anything, "/data", mock.Anything).Return(nil, errors.New("connection refused")).Once()
+		ftpmngr.On("Usage", mock.Anything, "/data", mock.Anything).Return(usage, nil).Once()
+
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+		require.Nil(t, err)
+
+		_, err = serv.Get(context.Background(), "test")
+		require.Nil(t, err)
+		waitUsageRefresh(t, serv, "test")
+
+		// a failure is reported once and tried again
+		got, err := serv.Get(context.Background(), "test")
+		require.Nil(t, err)
+		assert.Equal(t, "connection refused", got.Status["usage_error"])
+		waitUsageRefresh(t, serv, "test")
+
+		got, err = serv.Get(context.Background(), "test")
+		require.Nil(t, err)
+		assert.NotContains(t, got.Status, "usage_error")
+		assert.Equal(t, int64(1024), got.Status["usage"].(map[string]interface{})["used"])
+	})
+
+	t.Run("file cache", func(t *testing.T) {
+		ftpmngr.On("Usage", mock.Anything, "/data", mock.Anything).Return(usage, nil).Twice()
+
+		cache, err := filecache.New(&filecache.Options{Dir: t.TempDir(), MaxSize: 1 << 20})
+		require.Nil(t, err)
+
+		err = rep.Create(&volume.Volume{Name: "native", Mountpoint: "/test/native", Status: make(map[string]interface{})}, &models.VolumeOptions{
+			RemotePath:       "/data",
+			Backend:          models.BackendNative,
+			FTPConnectionOpt: models.FTPConnectionOpt{Host: "localhost", Port: 21, User: "user", Password: "secret"},
+		})
+		require.Nil(t, err)
+
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, cache, logger)
+		require.Nil(t, err)
+
+		got, err := serv.Get(context.Background(), "native")
+		require.Nil(t, err)
+
+		require.Contains(t, got.Status, "cache")
+		assert.Equal(t, int64(1<<20), got.Status["cache"].(map[string]interface{})["max_size"])
+
+		// curlftpfs mounts do not use the cache
+		got, err = serv.Get(context.Background(), "test")
+		require.Nil(t, err)
+		assert.NotContains(t, got.Status, "cache")
+		waitUsageRefresh(t, serv, "native")
+		waitUsageRefresh(t, serv, "test")
 	})
 
 	t.Run("failed get volume", func(t *testing.T) {
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		_, err = serv.Get("test1")
+		_, err = serv.Get(context.Background(), "test1")
 
 		assert.Error(t, err)
 	})
@@ -74,6 +203,7 @@ func TestCreate(t *testing.T) {
 	logger := log.Sugar()
 
 	ftpmngr := ftpMock.NewFTPManager(t)
+	ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
 	mountmngr := mountMock.NewMountManager(t)
 	statemngr := stateMock.NewStateManager(t)
 	rep := repository.CreateInMemoryRepository(logger)
@@ -81,8 +211,8 @@ func TestCreate(t *testing.T) {
 
 	statemngr.On("SyncState").Return(nil)
 	statemngr.On("SaveState").Return(nil)
-	ftpmngr.On("CheckConnection", mock.Anything).Return(nil).Once()
-	ftpmngr.On("CheckRemoteDir", mock.Anything, mock.Anything).Return(nil)
+	ftpmngr.On("CheckConnection", mock.Anything, mock.Anything).Return(nil).Once()
+	ftpmngr.On("CheckRemoteDir", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	t.Run("succsess creation", func(t *testing.T) {
 		name := "volume"
@@ -94,10 +224,10 @@ func TestCreate(t *testing.T) {
 			"port":     "21",
 		}
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		err = serv.Create(name, opt)
+		err = serv.Create(context.Background(), name, opt)
 		require.Nil(t, err)
 
 		got, _ := rep.Get(name)
@@ -116,10 +246,10 @@ func TestCreate(t *testing.T) {
 			"port": "21",
 		}
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		err = serv.Create(name, opt)
+		err = serv.Create(context.Background(), name, opt)
 		require.Error(t, err)
 	})
 
@@ -131,10 +261,10 @@ func TestCreate(t *testing.T) {
 			"port":     "21",
 		}
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		err = serv.Create(name, opt)
+		err = serv.Create(context.Background(), name, opt)
 		require.Error(t, err)
 	})
 
@@ -146,10 +276,10 @@ func TestCreate(t *testing.T) {
 			"port":     "21",
 		}
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		err = serv.Create(name, opt)
+		err = serv.Create(context.Background(), name, opt)
 		require.Error(t, err)
 	})
 
@@ -161,10 +291,10 @@ func TestCreate(t *testing.T) {
 			"host":     "host",
 		}
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		err = serv.Create(name, opt)
+		err = serv.Create(context.Background(), name, opt)
 		require.Error(t, err)
 	})
 
@@ -177,14 +307,101 @@ func TestCreate(t *testing.T) {
 			"port":     "abc",
 		}
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+		require.Nil(t, err)
+
+		err = serv.Create(context.Background(), name, opt)
+		require.Error(t, err)
+	})
+
+	t.Run("creation with invalid remove_remote option", func(t *testing.T) {
+		name := "invalidRemoveRemote"
+		opt := map[string]string{
+			"user":          "user",
+			"password":      "pswd",
+			"host":          "host",
+			"port":          "21",
+			"remotepath":    "/jobs/1",
+			"remove_remote": "abc",
+		}
+
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+		require.Nil(t, err)
+
+		err = serv.Create(context.Background(), name, opt)
+		require.Error(t, err)
+	})
+
+	t.Run("creation with remove_remote for server root", func(t *testing.T) {
+		name := "removeRemoteRoot"
+		opt := map[string]string{
+			"user":          "user",
+			"password":      "pswd",
+			"host":          "host",
+			"port":          "21",
+			"remove_remote": "true",
+		}
+
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+		require.Nil(t, err)
+
+		err = serv.Create(context.Background(), name, opt)
+		require.Error(t, err)
+	})
+
+	t.Run("creation with invalid quota option", func(t *testing.T) {
+		name := "invalidQuota"
+		opt := map[string]string{
+			"user":     "user",
+			"password": "pswd",
+			"host":     "host",
+			"port":     "21",
+			"backend":  models.BackendNative,
+			"quota":    "10X",
+		}
+
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+		require.Nil(t, err)
+
+		err = serv.Create(context.Background(), name, opt)
+		require.Error(t, err)
+	})
+
+	t.Run("creation with quota for curlftpfs backend", func(t *testing.T) {
+		name := "quotaCurlFtpFS"
+		opt := map[string]string{
+			"user":     "user",
+			"password": "pswd",
+			"host":     "host",
+			"port":     "21",
+			"quota":    "10G",
+		}
+
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+		require.Nil(t, err)
+
+		err = serv.Create(context.Background(), name, opt)
+		require.Error(t, err)
+	})
+
+	t.Run("creation with invalid backend option", func(t *testing.T) {
+		name := "invalidBackend"
+		opt := map[string]string{
+			"user":     "user",
+			"password": "pswd",
+			"host":     "host",
+			"port":     "21",
+			"backend":  "sshfs",
+		}
+
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		err = serv.Create(name, opt)
+		err = serv.Create(context.Background(), name, opt)
 		require.Error(t, err)
 	})
 
-	ftpmngr.On("CheckConnection", mock.Anything).Return(nil).Once()
+	ftpmngr.On("CheckConnection", mock.Anything, mock.Anything).Return(nil).Once()
 	stateError := errors.New("Failed to save state")
 	statemngr.On("SaveState").Return(stateError)
 
@@ -197,15 +414,15 @@ func TestCreate(t *testing.T) {
 			"port":     "21",
 		}
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		err = serv.Create(name, opt)
+		err = serv.Create(context.Background(), name, opt)
 		require.Nil(t, err)
 	})
 
 	ftpError := errors.New("Failed to connect to ftp server")
-	ftpmngr.On("CheckConnection", mock.Anything).Return(ftpError)
+	ftpmngr.On("CheckConnection", mock.Anything, mock.Anything).Return(ftpError)
 	statemngr.On("SaveState").Return(nil)
 
 	t.Run("get error from ftp manager", func(t *testing.T) {
@@ -217,14 +434,277 @@ func TestCreate(t *testing.T) {
 			"port":     "21",
 		}
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		err = serv.Create(name, opt)
+		err = serv.Create(context.Background(), name, opt)
 		require.Error(t, err)
 	})
 }
 
+func TestCreateWithQuota(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpmngr := ftpMock.NewFTPManager(t)
+	ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
+	mountmngr := mountMock.NewMountManager(t)
+	statemngr := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+	mountpoint := "/test"
+
+	statemngr.On("SyncState").Return(nil)
+	statemngr.On("SaveState").Return(nil)
+	ftpmngr.On("CheckConnection", mock.Anything, mock.Anything).Return(nil)
+	ftpmngr.On("CheckRemoteDir", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	// the account usage covers the whole ftp account, only the walk of the
+	// remote path seeds the quota
+	usage := &models.VolumeUsage{Used: 2048, Available: -1, AccountUsed: 1 << 30, Quota: 2 << 30, Sources: []string{models.UsageSourceSiteQuota, models.UsageSourceWalk}, CheckedAt: time.Now()}
+	ftpmngr.On("Usage", mock.Anything, "/data", mock.Anything).Return(usage, nil)
+
+	serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+	require.Nil(t, err)
+
+	err = serv.Create(context.Background(), "quota", map[string]string{
+		"user":       "user",
+		"password":   "pswd",
+		"host":       "host",
+		"port":       "21",
+		"remotepath": "/data",
+		"backend":    models.BackendNative,
+		"quota":      "10M",
+	})
+	require.Nil(t, err)
+
+	opt := rep.GetVolumeOptions("quota")
+	require.NotNil(t, opt)
+	assert.Equal(t, models.BackendNative, opt.Backend)
+	assert.Equal(t, int64(10<<20), opt.Quota)
+	assert.Equal(t, int64(2048), rep.GetQuotaUsage("quota").Used())
+
+	got, err := serv.Get(context.Background(), "quota")
+	require.Nil(t, err)
+	assert.Equal(t, int64(10<<20), got.Status["quota"])
+	assert.Equal(t, int64(2048), got.Status["quota_used"])
+}
+
+func TestQuotaUsageSaved(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	interval := usageSaveInterval
+	usageSaveInterval = 10 * time.Millisecond
+	defer func() { usageSaveInterval = interval }()
+
+	ftpmngr := ftpMock.NewFTPManager(t)
+	ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
+	mountmngr := mountMock.NewMountManager(t)
+	statemngr := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+	mountpoint := "/test"
+	id := uuid.NewString()
+
+	inVolume := &volume.Volume{
+		Name:       "quota",
+		Mountpoint: "/test/quota",
+		CreatedAt:  time.Now().Format(time.RFC3339Nano),
+	}
+	require.Nil(t, rep.Create(inVolume, &models.VolumeOptions{Mode: models.ModeMount, Backend: models.BackendNative, Quota: 10 << 20}))
+
+	saved := make(chan int64, 1)
+	statemngr.On("SyncState").Return(nil)
+	statemngr.On("SaveState").Return(nil)
+	statemngr.On("SaveUsage").Return(nil).Run(func(mock.Arguments) {
+		select {
+		case saved <- rep.GetQuotaUsage("quota").Used():
+		default:
+		}
+	})
+	mountmngr.On("Mount", mock.Anything, mock.Anything, mock.Anything, rep.GetQuotaUsage("quota")).Return(inVolume.Mountpoint, nil)
+	mountmngr.On("Unmount", mock.Anything, mock.Anything).Return(nil)
+
+	serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+	require.Nil(t, err)
+
+	_, err = serv.Mount(context.Background(), id, "quota")
+	require.Nil(t, err)
+
+	require.True(t, rep.GetQuotaUsage("quota").Reserve(4096, 10<<20))
+
+	select {
+	case used := <-saved:
+		assert.Equal(t, int64(4096), used)
+	case <-time.After(5 * time.Second):
+		t.Fatal("quota usage was not saved while mounted")
+	}
+
+	require.Nil(t, serv.Unmount(context.Background(), id, "quota"))
+
+	_, ok := serv.(*service).usageSavers.Load("quota")
+	assert.False(t, ok)
+}
+
+func TestCreateWithRetry(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpmngr := ftpMock.NewFTPManager(t)
+	ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
+	mountmngr := mountMock.NewMountManager(t)
+	statemngr := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+	mountpoint := "/test"
+
+	statemngr.On("SyncState").Return(nil)
+	statemngr.On("SaveState").Return(nil)
+
+	expected := &models.RetryPolicy{MaxAttempts: 5, Backoff: time.Second, Codes: []int{421, 450}}
+	withRetry := mock.MatchedBy(func(opt *models.FTPConnectionOpt) bool { return assert.ObjectsAreEqual(expected, opt.Retry) })
+	ftpmngr.On("CheckConnection", mock.Anything, withRetry).Return(nil).Once()
+	ftpmngr.On("CheckRemoteDir", mock.Anything, "/", withRetry).Return(nil).Once()
+
+	serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+	require.Nil(t, err)
+
+	options := map[string]string{
+		"user":           "user",
+		"password":       "pswd",
+		"host":           "host",
+		"port":           "21",
+		"retry_attempts": "5",
+		"retry_backoff":  "1s",
+		"retry_codes":    "421,450",
+	}
+
+	err = serv.Create(context.Background(), "retry", options)
+	require.Nil(t, err)
+	assert.Equal(t, expected, rep.GetVolumeOptions("retry").Retry)
+
+	options["retry_attempts"] = "many"
+	err = serv.Create(context.Background(), "invalid", options)
+	assert.Error(t, err)
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]struct {
+		in       string
+		expected int64
+		isErr    bool
+	}{
+		"bytes":         {"512", 512, false},
+		"kilobytes":     {"4K", 4 << 10, false},
+		"megabytes":     {"10MB", 10 << 20, false},
+		"gibibytes":     {"10GiB", 10 << 30, false},
+		"lower case":    {"1t", 1 << 40, false},
+		"invalid unit":  {"10X", 0, true},
+		"negative size": {"-1G", 0, true},
+		"overflow":      {"9999999999T", 0, true},
+		"empty":         {"", 0, true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseSize(test.in)
+			if test.isErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.Nil(t, err)
+			assert.Equal(t, test.expected, got)
+		})
+	}
+}
+
+func TestCreateSharedRemotePath(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpmngr := ftpMock.NewFTPManager(t)
+	ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
+	mountmngr := mountMock.NewMountManager(t)
+	statemngr := stateMock.NewStateManager(t)
+	mountpoint := "/test"
+
+	existing := &volume.Volume{
+		Name:       "existing",
+		Mountpoint: "/test/existing",
+		Status:     make(map[string]interface{}),
+		CreatedAt:  time.Now().Format(time.RFC3339Nano),
+	}
+
+	connOpt := models.FTPConnectionOpt{Host: "localhost", Port: 21, User: "user", Password: "pswd"}
+
+	statemngr.On("SyncState").Return(nil)
+	statemngr.On("SaveState").Return(nil)
+	ftpmngr.On("CheckConnection", mock.Anything, mock.Anything).Return(nil)
+	ftpmngr.On("CheckRemoteDir", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	ftpmngr.On("Usage", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("Unexpected")).Maybe()
+
+	opt := func(remotepath, share string) map[string]string {
+		res := map[string]string{
+			"user":       "user",
+			"password":   "pswd",
+			"host":       "localhost",
+			"port":       "21",
+			"remotepath": remotepath,
+		}
+
+		if share != "" {
+			res["share"] = share
+		}
+
+		return res
+	}
+
+	tests := map[string]struct {
+		existingShare string
+		remotepath    string
+		share         string
+		expectedErr   bool
+		sharedWith    interface{}
+	}{
+		"nested path with default share":  {models.ShareWarn, "/data/sub", "", false, []string{"new"}},
+		"same path with allow share":      {models.ShareWarn, "/data/", models.ShareAllow, false, []string{"new"}},
+		"parent path with reject share":   {models.ShareWarn, "/", models.ShareReject, true, nil},
+		"existing volume rejects sharing": {models.ShareReject, "/data/sub", models.ShareAllow, true, nil},
+		"not overlapping with reject":     {models.ShareReject, "/database", models.ShareReject, false, nil},
+		"invalid share value":             {models.ShareWarn, "/other", "abc", true, nil},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rep := repository.CreateInMemoryRepository(logger)
+			err := rep.Create(existing, &models.VolumeOptions{RemotePath: "/data", Share: test.existingShare, FTPConnectionOpt: connOpt})
+			require.Nil(t, err)
+
+			serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+			require.Nil(t, err)
+
+			err = serv.Create(context.Background(), "new", opt(test.remotepath, test.share))
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.Nil(t, err)
+
+			got, err := serv.Get(context.Background(), "existing")
+			require.Nil(t, err)
+			assert.Equal(t, test.sharedWith, got.Status["shared_with"])
+		})
+	}
+}
+
 func TestList(t *testing.T) {
 	conf := zap.NewDevelopmentConfig()
 	conf.Level.SetLevel(zap.PanicLevel)
@@ -251,10 +731,10 @@ func TestList(t *testing.T) {
 	statemngr.On("SyncState").Return(nil)
 
 	t.Run("succsess get list", func(t *testing.T) {
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		got, err := serv.List()
+		got, err := serv.List(context.Background())
 
 		require.Nil(t, err)
 
@@ -286,7 +766,7 @@ func TestRemove(t *testing.T) {
 
 	statemngr.On("SyncState").Return(nil)
 	statemngr.On("SaveState").Return(nil).Once()
-	mountmngr.On("Remove", inVolume).Return(nil).Once()
+	mountmngr.On("Remove", mock.Anything, inVolume).Return(nil).Once()
 
 	t.Run("succsess remove", func(t *testing.T) {
 		rep := repository.CreateInMemoryRepository(logger)
@@ -294,20 +774,20 @@ func TestRemove(t *testing.T) {
 
 		require.Nil(t, err)
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		err = serv.Remove("test")
+		err = serv.Remove(context.Background(), "test")
 		assert.Nil(t, err)
 	})
 
 	t.Run("remove not exists volume", func(t *testing.T) {
 		rep := repository.CreateInMemoryRepository(logger)
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 
 		require.Nil(t, err)
 
-		err = serv.Remove("notExists")
+		err = serv.Remove(context.Background(), "notExists")
 		assert.Error(t, err)
 	})
 
@@ -321,15 +801,15 @@ func TestRemove(t *testing.T) {
 
 		require.Nil(t, err)
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 
 		require.Nil(t, err)
 
-		err = serv.Remove("test")
+		err = serv.Remove(context.Background(), "test")
 		assert.Error(t, err)
 	})
 
-	mountmngr.On("Remove", mock.Anything).Return(errors.New("Unexpected")).Once()
+	mountmngr.On("Remove", mock.Anything, mock.Anything).Return(errors.New("Unexpected")).Once()
 
 	t.Run("get error from mount manager", func(t *testing.T) {
 		rep := repository.CreateInMemoryRepository(logger)
@@ -337,17 +817,17 @@ func TestRemove(t *testing.T) {
 
 		require.Nil(t, err)
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 
 		require.Nil(t, err)
 
-		err = serv.Remove("test")
+		err = serv.Remove(context.Background(), "test")
 
 		assert.Error(t, err)
 	})
 
 	statemngr.On("SaveState").Return(errors.New("Unexpected")).Once()
-	mountmngr.On("Remove", mock.Anything).Return(nil).Once()
+	mountmngr.On("Remove", mock.Anything, mock.Anything).Return(nil).Once()
 
 	t.Run("get error from state manager", func(t *testing.T) {
 		rep := repository.CreateInMemoryRepository(logger)
@@ -355,17 +835,17 @@ func TestRemove(t *testing.T) {
 
 		require.Nil(t, err)
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 
 		require.Nil(t, err)
 
-		err = serv.Remove("test")
+		err = serv.Remove(context.Background(), "test")
 
 		assert.Error(t, err)
 	})
 }
 
-func TestMount(t *testing.T) {
+func TestRemoveRemoteData(t *testing.T) {
 	conf := zap.NewDevelopmentConfig()
 	conf.Level.SetLevel(zap.PanicLevel)
 	log, _ := conf.Build()
@@ -383,78 +863,180 @@ func TestMount(t *testing.T) {
 		CreatedAt:  time.Now().Format(time.RFC3339Nano),
 	}
 
+	otherVolume := &volume.Volume{
+		Name:       "other",
+		Mountpoint: "/test/other",
+		Status:     make(map[string]interface{}),
+		CreatedAt:  time.Now().Format(time.RFC3339Nano),
+	}
+
+	connOpt := models.FTPConnectionOpt{Host: "localhost", Port: 21, User: "user", Password: "pswd"}
+
 	statemngr.On("SyncState").Return(nil)
+	statemngr.On("SaveState").Return(nil)
+	mountmngr.On("Remove", mock.Anything, mock.Anything).Return(nil)
 
-	mountmngr.On("Mount", mock.Anything, mock.Anything).Return(inVolume.Mountpoint, nil).Once()
+	ftpmngr.On("RemoveRemoteDir", mock.Anything, "/jobs/1", &connOpt).Return(nil).Once()
 
-	t.Run("succsess mount", func(t *testing.T) {
+	t.Run("succsess remove remote data", func(t *testing.T) {
 		rep := repository.CreateInMemoryRepository(logger)
-		err := rep.Create(inVolume, &models.VolumeOptions{})
-
+		err := rep.Create(inVolume, &models.VolumeOptions{RemotePath: "/jobs/1/", RemoveRemote: true, FTPConnectionOpt: connOpt})
 		require.Nil(t, err)
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
-
+		err = rep.Create(otherVolume, &models.VolumeOptions{RemotePath: "/jobs/2", RemoveRemote: true, FTPConnectionOpt: connOpt})
 		require.Nil(t, err)
 
-		path, err := serv.Mount(uuid.NewString(), "test")
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+		require.Nil(t, err)
 
+		err = serv.Remove(context.Background(), "test")
 		assert.Nil(t, err)
-		assert.Equal(t, inVolume.Mountpoint, path)
 	})
 
-	t.Run("mount already mounted volume", func(t *testing.T) {
+	t.Run("keep remote data of server root", func(t *testing.T) {
 		rep := repository.CreateInMemoryRepository(logger)
-		err := rep.Create(inVolume, &models.VolumeOptions{})
-
-		require.Nil(t, err)
-
-		err = rep.Mount(uuid.NewString(), inVolume)
-
+		err := rep.Create(inVolume, &models.VolumeOptions{RemotePath: "/", RemoveRemote: true, FTPConnectionOpt: connOpt})
 		require.Nil(t, err)
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
-
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		path, err := serv.Mount(uuid.NewString(), "test")
-
+		err = serv.Remove(context.Background(), "test")
 		assert.Nil(t, err)
-
-		assert.Equal(t, inVolume.Mountpoint, path)
 	})
 
-	mountmngr.On("Mount", mock.Anything, mock.Anything).Return(inVolume.Mountpoint, errors.New("Unexpected")).Once()
-
-	t.Run("get error from mount manager", func(t *testing.T) {
+	t.Run("keep remote data shared with another volume", func(t *testing.T) {
 		rep := repository.CreateInMemoryRepository(logger)
-		err := rep.Create(inVolume, &models.VolumeOptions{})
-
+		err := rep.Create(inVolume, &models.VolumeOptions{RemotePath: "/jobs/1/data", RemoveRemote: true, FTPConnectionOpt: connOpt})
 		require.Nil(t, err)
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
-
+		err = rep.Create(otherVolume, &models.VolumeOptions{RemotePath: "/jobs/1", FTPConnectionOpt: connOpt})
 		require.Nil(t, err)
 
-		_, err = serv.Mount(uuid.NewString(), "test")
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+		require.Nil(t, err)
 
-		assert.Error(t, err)
+		err = serv.Remove(context.Background(), "test")
+		assert.Nil(t, err)
 	})
 
-	t.Run("mount not exists volume", func(t *testing.T) {
-		rep := repository.CreateInMemoryRepository(logger)
-
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+	ftpmngr.On("RemoveRemoteDir", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("Unexpected")).Once()
 
+	t.Run("get error from ftp manager", func(t *testing.T) {
+		rep := repository.CreateInMemoryRepository(logger)
+		err := rep.Create(inVolume, &models.VolumeOptions{RemotePath: "/jobs/1", RemoveRemote: true, FTPConnectionOpt: connOpt})
 		require.Nil(t, err)
 
-		_, err = serv.Mount(uuid.NewString(), "test")
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+		require.Nil(t, err)
 
+		err = serv.Remove(context.Background(), "test")
 		assert.Error(t, err)
+
+		_, err = rep.Get("test")
+		assert.Nil(t, err)
 	})
 }
 
-func TestUnmount(t *testing.T) {
+func TestMount(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpmngr := ftpMock.NewFTPManager(t)
+	ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
+	mountmngr := mountMock.NewMountManager(t)
+	statemngr := stateMock.NewStateManager(t)
+	mountpoint := "/test"
+
+	inVolume := &volume.Volume{
+		Name:       "test",
+		Mountpoint: "/test/abc",
+		Status:     make(map[string]interface{}),
+		CreatedAt:  time.Now().Format(time.RFC3339Nano),
+	}
+
+	statemngr.On("SyncState").Return(nil)
+	statemngr.On("SaveState").Return(nil)
+
+	mountmngr.On("Mount", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(inVolume.Mountpoint, nil).Once()
+
+	t.Run("succsess mount", func(t *testing.T) {
+		rep := repository.CreateInMemoryRepository(logger)
+		err := rep.Create(inVolume, &models.VolumeOptions{})
+
+		require.Nil(t, err)
+
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+
+		require.Nil(t, err)
+
+		path, err := serv.Mount(context.Background(), uuid.NewString(), "test")
+
+		assert.Nil(t, err)
+		assert.Equal(t, inVolume.Mountpoint, path)
+	})
+
+	t.Run("mount already mounted volume", func(t *testing.T) {
+		rep := repository.CreateInMemoryRepository(logger)
+		err := rep.Create(inVolume, &models.VolumeOptions{})
+
+		require.Nil(t, err)
+
+		err = rep.Mount(uuid.NewString(), inVolume)
+
+		require.Nil(t, err)
+
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+
+		require.Nil(t, err)
+
+		path, err := serv.Mount(context.Background(), uuid.NewString(), "test")
+
+		assert.Nil(t, err)
+
+		assert.Equal(t, inVolume.Mountpoint, path)
+	})
+
+	mountmngr.On("Mount", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(inVolume.Mountpoint, errors.New("Unexpected")).Once()
+	ftpmngr.On("Usage", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("Unexpected")).Maybe()
+
+	t.Run("get error from mount manager", func(t *testing.T) {
+		rep := repository.CreateInMemoryRepository(logger)
+		err := rep.Create(inVolume, &models.VolumeOptions{})
+
+		require.Nil(t, err)
+
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+
+		require.Nil(t, err)
+
+		_, err = serv.Mount(context.Background(), uuid.NewString(), "test")
+
+		assert.Error(t, err)
+		assert.False(t, rep.IsMount("test"))
+
+		got, err := serv.Get(context.Background(), "test")
+
+		require.Nil(t, err)
+		assert.Equal(t, "Unexpected", got.Status["last_mount_error"])
+	})
+
+	t.Run("mount not exists volume", func(t *testing.T) {
+		rep := repository.CreateInMemoryRepository(logger)
+
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+
+		require.Nil(t, err)
+
+		_, err = serv.Mount(context.Background(), uuid.NewString(), "test")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestUnmount(t *testing.T) {
 	conf := zap.NewDevelopmentConfig()
 	conf.Level.SetLevel(zap.PanicLevel)
 	log, _ := conf.Build()
@@ -475,7 +1057,8 @@ func TestUnmount(t *testing.T) {
 
 	statemngr.On("SyncState").Return(nil)
 
-	mountmngr.On("Unmount", mock.Anything).Return(nil).Once()
+	mountmngr.On("Unmount", mock.Anything, mock.Anything).Return(nil).Once()
+	statemngr.On("SaveState").Return(nil).Once()
 
 	t.Run("succsess unmount", func(t *testing.T) {
 		rep := repository.CreateInMemoryRepository(logger)
@@ -487,11 +1070,11 @@ func TestUnmount(t *testing.T) {
 
 		require.Nil(t, err)
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 
 		require.Nil(t, err)
 
-		err = serv.Unmount(id, inVolume.Name)
+		err = serv.Unmount(context.Background(), id, inVolume.Name)
 
 		assert.Nil(t, err)
 	})
@@ -499,11 +1082,11 @@ func TestUnmount(t *testing.T) {
 	t.Run("unmount not exists volume", func(t *testing.T) {
 		rep := repository.CreateInMemoryRepository(logger)
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 
 		require.Nil(t, err)
 
-		err = serv.Unmount(id, inVolume.Name)
+		err = serv.Unmount(context.Background(), id, inVolume.Name)
 
 		assert.Error(t, err)
 	})
@@ -515,11 +1098,11 @@ func TestUnmount(t *testing.T) {
 
 		require.Nil(t, err)
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 
 		require.Nil(t, err)
 
-		err = serv.Unmount(id, inVolume.Name)
+		err = serv.Unmount(context.Background(), id, inVolume.Name)
 
 		assert.Error(t, err)
 	})
@@ -531,7 +1114,7 @@ func TestUnmount(t *testing.T) {
 
 		require.Nil(t, err)
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 
 		require.Nil(t, err)
 
@@ -545,14 +1128,14 @@ func TestUnmount(t *testing.T) {
 
 		require.Nil(t, err)
 
-		err = serv.Unmount(id, inVolume.Name)
+		err = serv.Unmount(context.Background(), id, inVolume.Name)
 
 		require.Nil(t, err)
 
 		assert.True(t, rep.IsMount(inVolume.Name))
 	})
 
-	mountmngr.On("Unmount", mock.Anything).Return(errors.New("Unexpected"))
+	mountmngr.On("Unmount", mock.Anything, mock.Anything).Return(errors.New("Unexpected"))
 
 	t.Run("get error from mount manager", func(t *testing.T) {
 		rep := repository.CreateInMemoryRepository(logger)
@@ -565,11 +1148,11 @@ func TestUnmount(t *testing.T) {
 
 		require.Nil(t, err)
 
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 
 		require.Nil(t, err)
 
-		err = serv.Unmount(id, inVolume.Name)
+		err = serv.Unmount(context.Background(), id, inVolume.Name)
 
 		require.Error(t, err)
 	})
@@ -601,10 +1184,10 @@ func TestPath(t *testing.T) {
 	statemngr.On("SyncState").Return(nil)
 
 	t.Run("succsess get path", func(t *testing.T) {
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		got, err := serv.Path("test")
+		got, err := serv.Path(context.Background(), "test")
 
 		require.Nil(t, err)
 
@@ -612,10 +1195,10 @@ func TestPath(t *testing.T) {
 	})
 
 	t.Run("failed get path", func(t *testing.T) {
-		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+		serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 		require.Nil(t, err)
 
-		_, err = serv.Path("test1")
+		_, err = serv.Path(context.Background(), "test1")
 
 		assert.Error(t, err)
 	})
@@ -635,7 +1218,7 @@ func TestCapabilities(t *testing.T) {
 
 	statemngr.On("SyncState").Return(nil).Once()
 
-	serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, logger)
+	serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
 
 	require.Nil(t, err)
 
@@ -644,3 +1227,670 @@ func TestCapabilities(t *testing.T) {
 	got := serv.Capabilities()
 	assert.Equal(t, expected, got.Scope)
 }
+
+func TestHealth(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpmngr := ftpMock.NewFTPManager(t)
+	mountmngr := mountMock.NewMountManager(t)
+	statemngr := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+	mountpoint := "/test"
+
+	opt := &models.VolumeOptions{
+		RemotePath:       "/data",
+		FTPConnectionOpt: models.FTPConnectionOpt{Host: "localhost", Port: 21, User: "user", Password: "secret"},
+	}
+
+	for _, name := range []string{"mounted", "broken", "idle"} {
+		vol := &volume.Volume{Name: name, Mountpoint: "/test/" + name}
+		require.Nil(t, rep.Create(vol, opt))
+		if name != "idle" {
+			require.Nil(t, rep.Mount(uuid.NewString(), vol))
+		}
+	}
+
+	statemngr.On("SyncState").Return(nil)
+	statemngr.On("CheckState").Return(nil)
+	mountmngr.On("CheckSystem").Return([]models.HealthCheck{models.NewHealthCheck("fuse_device", nil)})
+	mountmngr.On("CheckMount", mock.Anything, mock.MatchedBy(func(vol *volume.Volume) bool { return vol.Name == "mounted" })).Return(nil)
+	mountmngr.On("CheckMount", mock.Anything, mock.MatchedBy(func(vol *volume.Volume) bool { return vol.Name == "broken" })).
+		Return(errors.New("unable to list mountpoint: login secret rejected"))
+
+	serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+	require.Nil(t, err)
+
+	report := serv.Health(context.Background())
+
+	assert.Equal(t, models.HealthDegraded, report.Status)
+	assert.True(t, report.Ready())
+	assert.Equal(t, []models.HealthCheck{
+		{Name: "state", Status: models.HealthOK},
+		{Name: "fuse_device", Status: models.HealthOK},
+	}, report.Checks)
+
+	require.Len(t, report.Volumes, 2)
+	assert.Equal(t, models.HealthCheck{Name: "broken", Status: models.HealthDegraded, Error: "unable to list mountpoint: login ******** rejected"}, report.Volumes[0])
+	assert.Equal(t, models.HealthCheck{Name: "mounted", Status: models.HealthOK}, report.Volumes[1])
+
+	ftpmngr.On("Usage", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("Unexpected")).Maybe()
+
+	got, err := serv.Get(context.Background(), "broken")
+	require.Nil(t, err)
+	assert.Contains(t, got.Status, "last_health_check")
+	assert.Equal(t, "unable to list mountpoint: login ******** rejected", got.Status["last_health_check_error"])
+}
+
+func TestAuditLog(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpmngr := ftpMock.NewFTPManager(t)
+	ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
+	mountmngr := mountMock.NewMountManager(t)
+	statemngr := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+	mountpoint := "/test"
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := audit.NewFileLog(&audit.Options{Path: path})
+	require.Nil(t, err)
+	defer auditLog.Close()
+
+	statemngr.On("SyncState").Return(nil)
+	statemngr.On("SaveState").Return(nil)
+	ftpmngr.On("CheckConnection", mock.Anything, mock.Anything).Return(nil)
+	ftpmngr.On("CheckRemoteDir", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	// errors quoting the password are redacted
+	mountmngr.On("Mount", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return("", errors.New("login with secret refused")).Once()
+	mountmngr.On("Mount", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return("/test/volume", nil)
+	mountmngr.On("Unmount", mock.Anything, mock.Anything).Return(nil)
+	mountmngr.On("Remove", mock.Anything, mock.Anything).Return(nil)
+
+	serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, auditLog, nil, nil, logger)
+	require.Nil(t, err)
+
+	id := uuid.NewString()
+	opt := map[string]string{
+		"user":       "admin",
+		"host":       "localhost",
+		"password":   "secret",
+		"port":       "21",
+		"remotepath": "/data",
+	}
+
+	require.Nil(t, serv.Create(context.Background(), "volume", opt))
+	_, err = serv.Mount(context.Background(), id, "volume")
+	require.Error(t, err)
+	_, err = serv.Mount(context.Background(), id, "volume")
+	require.Nil(t, err)
+	require.Error(t, serv.Remove(context.Background(), "volume"))
+	require.Nil(t, serv.Unmount(context.Background(), id, "volume"))
+	require.Nil(t, serv.Remove(context.Background(), "volume"))
+
+	count, err := audit.Verify(path)
+	require.Nil(t, err)
+	assert.Equal(t, 6, count)
+
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	assert.NotContains(t, string(data), "secret")
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	expected := []struct {
+		action  string
+		id      string
+		outcome string
+	}{
+		{audit.ActionCreate, "", audit.OutcomeSuccess},
+		{audit.ActionMount, id, audit.OutcomeFailure},
+		{audit.ActionMount, id, audit.OutcomeSuccess},
+		{audit.ActionRemove, "", audit.OutcomeFailure},
+		{audit.ActionUnmount, id, audit.OutcomeSuccess},
+		{audit.ActionRemove, "", audit.OutcomeSuccess},
+	}
+
+	require.Len(t, lines, len(expected))
+	assert.Contains(t, lines[1], "login with ******** refused")
+	for i, line := range lines {
+		event := &audit.Event{}
+		require.Nil(t, json.Unmarshal([]byte(line), event))
+
+		assert.Equal(t, expected[i].action, event.Action)
+		assert.Equal(t, "volume", event.Volume)
+		assert.Equal(t, expected[i].id, event.ContainerID)
+		assert.Equal(t, expected[i].outcome, event.Outcome)
+		assert.Equal(t, "admin@localhost:21/data", event.Endpoint)
+	}
+}
+
+func TestCreateWithAtomicUpload(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpmngr := ftpMock.NewFTPManager(t)
+	ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
+	mountmngr := mountMock.NewMountManager(t)
+	statemngr := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+	mountpoint := "/test"
+
+	statemngr.On("SyncState").Return(nil)
+	statemngr.On("SaveState").Return(nil)
+	ftpmngr.On("CheckConnection", mock.Anything, mock.Anything).Return(nil)
+	ftpmngr.On("CheckRemoteDir", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+	require.Nil(t, err)
+
+	options := func(extra map[string]string) map[string]string {
+		opts := map[string]string{"user": "user", "password": "pswd", "host": "host", "port": "21"}
+		for key, value := range extra {
+			opts[key] = value
+		}
+		return opts
+	}
+
+	t.Run("default pattern", func(t *testing.T) {
+		err := serv.Create(context.Background(), "staged", options(map[string]string{"mode": models.ModeStage, "atomic_upload": "true"}))
+		require.Nil(t, err)
+
+		opt := rep.GetVolumeOptions("staged")
+		assert.True(t, opt.AtomicUpload)
+		assert.Equal(t, models.DefaultPartialPattern, opt.PartialPattern)
+	})
+
+	t.Run("custom pattern", func(t *testing.T) {
+		err := serv.Create(context.Background(), "native", options(map[string]string{
+			"backend":         models.BackendNative,
+			"atomic_upload":   "true",
+			"partial_pattern": "{name}.upload",
+		}))
+		require.Nil(t, err)
+		assert.Equal(t, "{name}.upload", rep.GetVolumeOptions("native").PartialPattern)
+	})
+
+	for name, extra := range map[string]map[string]string{
+		"curlftpfs mount":    {"atomic_upload": "true"},
+		"invalid value":      {"mode": models.ModeStage, "atomic_upload": "yes please"},
+		"missing name":       {"mode": models.ModeStage, "partial_pattern": ".partial"},
+		"pattern is name":    {"mode": models.ModeStage, "partial_pattern": "{name}"},
+		"pattern with slash": {"mode": models.ModeStage, "partial_pattern": "tmp/{name}"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, serv.Create(context.Background(), "invalid", options(extra)))
+		})
+	}
+}
+
+func TestCreateWithChecksum(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpmngr := ftpMock.NewFTPManager(t)
+	ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
+	mountmngr := mountMock.NewMountManager(t)
+	statemngr := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+	mountpoint := "/test"
+
+	statemngr.On("SyncState").Return(nil)
+	statemngr.On("SaveState").Return(nil)
+	ftpmngr.On("CheckConnection", mock.Anything, mock.Anything).Return(nil)
+	ftpmngr.On("CheckRemoteDir", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	serv, err := CreateFTPService(mountpoint, ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+	require.Nil(t, err)
+
+	options := func(extra map[string]string) map[string]string {
+		opts := map[string]string{"user": "user", "password": "pswd", "host": "host", "port": "21"}
+		for key, value := range extra {
+			opts[key] = value
+		}
+		return opts
+	}
+
+	err = serv.Create(context.Background(), "checked", options(map[string]string{"backend": models.BackendNative, "checksum": "true"}))
+	require.Nil(t, err)
+	assert.True(t, rep.GetVolumeOptions("checked").Checksum)
+
+	usage := &models.VolumeUsage{Used: -1, Available: -1, AccountUsed: -1, Quota: -1, Sources: []string{}, CheckedAt: time.Now()}
+	ftpmngr.On("Usage", mock.Anything, "/", mock.Anything).Return(usage, nil).Maybe()
+	status, err := serv.Get(context.Background(), "checked")
+	require.Nil(t, err)
+	assert.Equal(t, true, status.Status["checksum"])
+
+	for name, extra := range map[string]map[string]string{
+		"curlftpfs mount": {"checksum": "true"},
+		"stage mode":      {"backend": models.BackendNative, "mode": models.ModeStage, "checksum": "true"},
+		"invalid value":   {"backend": models.BackendNative, "checksum": "sha"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, serv.Create(context.Background(), "invalid", options(extra)))
+		})
+	}
+}
+
+func TestCreateWithEncoding(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpmngr := ftpMock.NewFTPManager(t)
+	ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
+	mountmngr := mountMock.NewMountManager(t)
+	statemngr := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+
+	statemngr.On("SyncState").Return(nil)
+	statemngr.On("SaveState").Return(nil)
+	ftpmngr.On("CheckConnection", mock.Anything, mock.Anything).Return(nil)
+	ftpmngr.On("CheckRemoteDir", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	serv, err := CreateFTPService("/test", ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+	require.Nil(t, err)
+
+	options := func(extra map[string]string) map[string]string {
+		opts := map[string]string{"user": "user", "password": "pswd", "host": "host", "port": "21"}
+		for key, value := range extra {
+			opts[key] = value
+		}
+		return opts
+	}
+
+	err = serv.Create(context.Background(), "cyrillic", options(map[string]string{"backend": models.BackendNative, "encoding": "CP1251"}))
+	require.Nil(t, err)
+	assert.Equal(t, "windows-1251", rep.GetVolumeOptions("cyrillic").Encoding)
+
+	err = serv.Create(context.Background(), "unicode", options(map[string]string{"encoding": "utf8"}))
+	require.Nil(t, err)
+	assert.Equal(t, "", rep.GetVolumeOptions("unicode").Encoding)
+
+	usage := &models.VolumeUsage{Used: -1, Available: -1, AccountUsed: -1, Quota: -1, Sources: []string{}, CheckedAt: time.Now()}
+	ftpmngr.On("Usage", mock.Anything, "/", mock.Anything).Return(usage, nil).Maybe()
+	status, err := serv.Get(context.Background(), "cyrillic")
+	require.Nil(t, err)
+	assert.Equal(t, "windows-1251", status.Status["encoding"])
+
+	status, err = serv.Get(context.Background(), "unicode")
+	require.Nil(t, err)
+	assert.NotContains(t, status.Status, "encoding")
+
+	for name, extra := range map[string]map[string]string{
+		"unknown encoding":     {"encoding": "cp9999"},
+		"unsupported encoding": {"encoding": "utf-16le"},
+		"stage mode":           {"mode": models.ModeStage, "encoding": "cp1251"},
+		"non ascii remotepath": {"remotepath": "/Отчёты", "encoding": "cp1251"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, serv.Create(context.Background(), "invalid", options(extra)))
+		})
+	}
+}
+
+func TestCreateWithServerTZ(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpmngr := ftpMock.NewFTPManager(t)
+	ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
+	mountmngr := mountMock.NewMountManager(t)
+	statemngr := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+
+	statemngr.On("SyncState").Return(nil)
+	statemngr.On("SaveState").Return(nil)
+	ftpmngr.On("CheckConnection", mock.Anything, mock.Anything).Return(nil)
+	ftpmngr.On("CheckRemoteDir", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	serv, err := CreateFTPService("/test", ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+	require.Nil(t, err)
+
+	options := func(extra map[string]string) map[string]string {
+		opts := map[string]string{"user": "user", "password": "pswd", "host": "host", "port": "21"}
+		for key, value := range extra {
+			opts[key] = value
+		}
+		return opts
+	}
+
+	err = serv.Create(context.Background(), "moscow", options(map[string]string{"backend": models.BackendNative, "server_tz": "Europe/Moscow"}))
+	require.Nil(t, err)
+	assert.Equal(t, "Europe/Moscow", rep.GetVolumeOptions("moscow").ServerTZ)
+
+	err = serv.Create(context.Background(), "offset", options(map[string]string{"backend": models.BackendNative, "server_tz": "-05:00"}))
+	require.Nil(t, err)
+	assert.Equal(t, "-05:00", rep.GetVolumeOptions("offset").ServerTZ)
+
+	usage := &models.VolumeUsage{Used: -1, Available: -1, AccountUsed: -1, Quota: -1, Sources: []string{}, CheckedAt: time.Now()}
+	ftpmngr.On("Usage", mock.Anything, "/", mock.Anything).Return(usage, nil).Maybe()
+	status, err := serv.Get(context.Background(), "moscow")
+	require.Nil(t, err)
+	assert.Equal(t, "Europe/Moscow", status.Status["server_tz"])
+
+	for name, extra := range map[string]map[string]string{
+		"unknown zone":    {"backend": models.BackendNative, "server_tz": "Mars/Olympus"},
+		"plugin zone":     {"backend": models.BackendNative, "server_tz": "Local"},
+		"curlftpfs mount": {"server_tz": "Europe/Moscow"},
+		"stage mode":      {"backend": models.BackendNative, "mode": models.ModeStage, "server_tz": "Europe/Moscow"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, serv.Create(context.Background(), "invalid", options(extra)))
+		})
+	}
+}
+
+func TestServerCapabilities(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpmngr := ftpMock.NewFTPManager(t)
+	mountmngr := mountMock.NewMountManager(t)
+	statemngr := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+
+	statemngr.On("SyncState").Return(nil)
+	statemngr.On("SaveState").Return(nil)
+	ftpmngr.On("CheckConnection", mock.Anything, mock.Anything).Return(nil)
+	ftpmngr.On("CheckRemoteDir", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	ftpmngr.On("Usage", mock.Anything, mock.Anything, mock.Anything).Return(&models.VolumeUsage{Used: -1, Available: -1, AccountUsed: -1, Quota: -1}, nil).Maybe()
+
+	serv, err := CreateFTPService("/test", ftpmngr, mountmngr, statemngr, rep, audit.NewNopLog(), nil, nil, logger)
+	require.Nil(t, err)
+
+	options := map[string]string{"user": "user", "password": "pswd", "host": "host", "port": "21"}
+	id := uuid.NewString()
+
+	t.Run("discovered on create", func(t *testing.T) {
+		ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil).Once()
+		require.Nil(t, serv.Create(context.Background(), "test", options))
+		assert.Equal(t, testCapabilities, rep.GetVolumeOptions("test").Capabilities)
+
+		got, err := serv.Get(context.Background(), "test")
+		require.Nil(t, err)
+		caps := got.Status["capabilities"].(map[string]interface{})
+		assert.Equal(t, []string{"EPSV", "SIZE", "UTF8"}, caps["features"])
+	})
+
+	t.Run("refreshed on mount", func(t *testing.T) {
+		refreshed := &models.ServerCapabilities{Features: map[string]string{"MLST": "size*;modify*;", "SIZE": ""}}
+		ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(refreshed, nil).Once()
+		mountmngr.On("Mount", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return("/test/test", nil).Once()
+
+		_, err := serv.Mount(context.Background(), id, "test")
+		require.Nil(t, err)
+		assert.Equal(t, refreshed, rep.GetVolumeOptions("test").Capabilities)
+
+		mountmngr.On("Unmount", mock.Anything, mock.Anything).Return(nil).Once()
+		require.Nil(t, serv.Unmount(context.Background(), id, "test"))
+	})
+
+	t.Run("kept when the server can not be asked", func(t *testing.T) {
+		known := rep.GetVolumeOptions("test").Capabilities
+		ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(nil, errors.New("connection refused")).Once()
+		mountmngr.On("Mount", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return("/test/test", nil).Once()
+
+		_, err := serv.Mount(context.Background(), id, "test")
+		require.Nil(t, err)
+		assert.Equal(t, known, rep.GetVolumeOptions("test").Capabilities)
+	})
+
+	t.Run("unknown when create can not ask", func(t *testing.T) {
+		ftpmngr.On("Capabilities", mock.Anything, mock.Anything).Return(nil, errors.New("connection refused")).Once()
+		require.Nil(t, serv.Create(context.Background(), "unknown", options))
+		assert.Nil(t, rep.GetVolumeOptions("unknown").Capabilities)
+	})
+}
+
+func TestReservedNames(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpManager := ftpMock.NewFTPManager(t)
+	mountManager := mountMock.NewMountManager(t)
+	stateManager := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+	mountpoint := t.TempDir()
+
+	stateManager.On("SyncState").Return(nil)
+
+	// local data of an earlier version next to the mountpoints
+	legacy := filepath.Join(mountpoint, "stage", "test", "data", "a.txt")
+	require.Nil(t, os.MkdirAll(filepath.Dir(legacy), 0755))
+	require.Nil(t, os.WriteFile(legacy, []byte("a"), 0644))
+	require.Nil(t, os.MkdirAll(filepath.Join(mountpoint, "mirror", "test", "data"), 0755))
+
+	serv, err := CreateFTPService(mountpoint, ftpManager, mountManager, stateManager, rep, audit.NewNopLog(), nil, nil, logger)
+	require.Nil(t, err)
+
+	t.Run("legacy data moved into state", func(t *testing.T) {
+		assert.NoDirExists(t, filepath.Join(mountpoint, "stage"))
+		assert.FileExists(t, filepath.Join(mountpoint, "state", "stage", "test", "data", "a.txt"))
+		assert.NoDirExists(t, filepath.Join(mountpoint, "mirror"))
+		assert.DirExists(t, filepath.Join(mountpoint, "state", "mirror", "test", "data"))
+	})
+
+	opts := map[string]string{"host": "localhost", "port": "21", "user": "user", "password": "password"}
+	for name := range reservedNames {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, serv.Create(context.Background(), name, opts))
+			_, err := rep.Get(name)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestStageMode(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpManager := ftpMock.NewFTPManager(t)
+	ftpManager.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
+	mountManager := mountMock.NewMountManager(t)
+	stateManager := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+	mountpoint := t.TempDir()
+	id := uuid.NewString()
+
+	stateManager.On("SyncState").Return(nil)
+	stateManager.On("SaveState").Return(nil)
+	ftpManager.On("Usage", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("Unexpected")).Maybe()
+
+	serv, err := CreateFTPService(mountpoint, ftpManager, mountManager, stateManager, rep, audit.NewNopLog(), nil, nil, logger)
+	require.Nil(t, err)
+
+	t.Run("invalid options", func(t *testing.T) {
+		opts := map[string]string{"host": "localhost", "port": "21", "user": "user", "password": "password"}
+
+		opts["mode"] = "copy"
+		assert.Error(t, serv.Create(context.Background(), "invalid", opts))
+
+		opts["mode"] = models.ModeStage
+		opts["backend"] = models.BackendNative
+		opts["quota"] = "1M"
+		assert.Error(t, serv.Create(context.Background(), "invalid", opts))
+	})
+
+	vol := &volume.Volume{Name: "test", Mountpoint: filepath.Join(mountpoint, "test"), CreatedAt: time.Now().Format(time.RFC3339Nano)}
+	opt := &models.VolumeOptions{
+		RemotePath:       "/data",
+		Mode:             models.ModeStage,
+		FTPConnectionOpt: models.FTPConnectionOpt{Host: "localhost", Port: 21, User: "user", Password: "secret"},
+	}
+	require.Nil(t, rep.Create(vol, opt))
+
+	data := filepath.Join(mountpoint, "state", "stage", "test", "data")
+	snapshot := models.StageSnapshot{"a.txt": {Size: 1, ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}}
+
+	// the local copy is downloaded once and kept while its upload fails
+	ftpManager.On("Download", mock.Anything, "/data", data, mock.Anything).Return(snapshot, nil).Once()
+	mountManager.On("Bind", mock.Anything, mock.Anything, data, false).Return(vol.Mountpoint, nil)
+	mountManager.On("Unmount", mock.Anything, mock.Anything).Return(nil)
+
+	t.Run("mount downloads", func(t *testing.T) {
+		path, err := serv.Mount(context.Background(), id, "test")
+		require.NoError(t, err)
+		assert.Equal(t, vol.Mountpoint, path)
+		assert.DirExists(t, data)
+
+		got, err := serv.Get(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, models.ModeStage, got.Status["mode"])
+		assert.Equal(t, models.StageStaged, got.Status["stage"].(map[string]interface{})["state"])
+	})
+
+	t.Run("conflicting upload", func(t *testing.T) {
+		conflict := &ftpmngr.ConflictError{Paths: []string{"a.txt"}}
+		ftpManager.On("Upload", mock.Anything, data, "/data", snapshot, "", mock.Anything).Return(conflict).Once()
+
+		err := serv.Unmount(context.Background(), id, "test")
+		assert.Error(t, err)
+
+		got, err := serv.Get(context.Background(), "test")
+		require.NoError(t, err)
+
+		stage := got.Status["stage"].(map[string]interface{})
+		assert.Equal(t, models.StageConflict, stage["state"])
+		assert.Equal(t, []string{"a.txt"}, stage["conflicts"])
+		assert.DirExists(t, data)
+	})
+
+	t.Run("remount keeps local copy", func(t *testing.T) {
+		_, err := serv.Mount(context.Background(), id, "test")
+		require.NoError(t, err)
+
+		ftpManager.On("Upload", mock.Anything, data, "/data", snapshot, "", mock.Anything).Return(nil).Once()
+
+		require.NoError(t, serv.Unmount(context.Background(), id, "test"))
+		assert.NoDirExists(t, filepath.Join(mountpoint, "state", "stage", "test"))
+
+		got, err := serv.Get(context.Background(), "test")
+		require.NoError(t, err)
+		assert.NotContains(t, got.Status, "stage")
+	})
+
+	t.Run("atomic upload", func(t *testing.T) {
+		// mounting replaces the options with refreshed server features
+		opt := rep.GetVolumeOptions("test")
+		opt.AtomicUpload = true
+		opt.PartialPattern = "{name}.tmp"
+		defer func() { opt.AtomicUpload = false }()
+
+		ftpManager.On("Download", mock.Anything, "/data", data, mock.Anything).Return(snapshot, nil).Once()
+		_, err := serv.Mount(context.Background(), id, "test")
+		require.NoError(t, err)
+
+		ftpManager.On("Upload", mock.Anything, data, "/data", snapshot, "{name}.tmp", mock.Anything).Return(nil).Once()
+		require.NoError(t, serv.Unmount(context.Background(), id, "test"))
+	})
+}
+
+func TestMirrorMode(t *testing.T) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level.SetLevel(zap.PanicLevel)
+	log, _ := conf.Build()
+	logger := log.Sugar()
+
+	ftpManager := ftpMock.NewFTPManager(t)
+	ftpManager.On("Capabilities", mock.Anything, mock.Anything).Return(testCapabilities, nil)
+	mountManager := mountMock.NewMountManager(t)
+	stateManager := stateMock.NewStateManager(t)
+	rep := repository.CreateInMemoryRepository(logger)
+	mountpoint := t.TempDir()
+	id := uuid.NewString()
+
+	stateManager.On("SyncState").Return(nil)
+	stateManager.On("SaveState").Return(nil)
+	ftpManager.On("Usage", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("Unexpected")).Maybe()
+
+	serv, err := CreateFTPService(mountpoint, ftpManager, mountManager, stateManager, rep, audit.NewNopLog(), nil, nil, logger)
+	require.Nil(t, err)
+
+	t.Run("invalid options", func(t *testing.T) {
+		for _, opts := range []map[string]string{
+			{"mode": models.ModeMirror, "remove_remote": "true", "remotepath": "/data"},
+			{"mode": models.ModeMirror, "refresh": "often"},
+			{"mode": models.ModeMount, "refresh": "1m"},
+		} {
+			for key, value := range map[string]string{"host": "localhost", "port": "21", "user": "user", "password": "password"} {
+				opts[key] = value
+			}
+
+			assert.Error(t, serv.Create(context.Background(), "invalid", opts))
+		}
+	})
+
+	vol := &volume.Volume{Name: "test", Mountpoint: filepath.Join(mountpoint, "test"), CreatedAt: time.Now().Format(time.RFC3339Nano)}
+	opt := &models.VolumeOptions{
+		RemotePath:       "/data",
+		Mode:             models.ModeMirror,
+		Refresh:          time.Hour,
+		FTPConnectionOpt: models.FTPConnectionOpt{Host: "localhost", Port: 21, User: "user", Password: "secret"},
+	}
+	require.Nil(t, rep.Create(vol, opt))
+
+	data := filepath.Join(mountpoint, "state", "mirror", "test", "data")
+	first := models.StageSnapshot{"a.txt": {Size: 1, ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}}
+	second := models.StageSnapshot{"a.txt": {Size: 2, ModTime: time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC)}}
+
+	ftpManager.On("Sync", mock.Anything, "/data", data, models.StageSnapshot(nil), mock.Anything).Return(first, nil).Once()
+	mountManager.On("Bind", mock.Anything, mock.Anything, data, true).Return(vol.Mountpoint, nil)
+	mountManager.On("Unmount", mock.Anything, mock.Anything).Return(nil)
+
+	t.Run("mount syncs read-only copy", func(t *testing.T) {
+		path, err := serv.Mount(context.Background(), id, "test")
+		require.NoError(t, err)
+		assert.Equal(t, vol.Mountpoint, path)
+
+		got, err := serv.Get(context.Background(), "test")
+		require.NoError(t, err)
+
+		mirror := got.Status["mirror"].(map[string]interface{})
+		assert.Equal(t, 1, mirror["entries"])
+		assert.Equal(t, "1h0m0s", mirror["refresh"])
+		assert.Contains(t, mirror, "synced_at")
+	})
+
+	t.Run("refresh on demand", func(t *testing.T) {
+		ftpManager.On("Sync", mock.Anything, "/data", data, first, mock.Anything).Return(second, errors.New("connection lost")).Once()
+
+		assert.Error(t, serv.Refresh(context.Background(), "test"))
+
+		got, err := serv.Get(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, "connection lost", got.Status["mirror"].(map[string]interface{})["error"])
+	})
+
+	t.Run("remount with unreachable server uses copy", func(t *testing.T) {
+		require.NoError(t, serv.Unmount(context.Background(), id, "test"))
+
+		ftpManager.On("Sync", mock.Anything, "/data", data, second, mock.Anything).Return(nil, errors.New("connection refused")).Once()
+
+		_, err := serv.Mount(context.Background(), id, "test")
+		assert.NoError(t, err)
+		require.NoError(t, serv.Unmount(context.Background(), id, "test"))
+	})
+
+	t.Run("refresh of other modes", func(t *testing.T) {
+		require.Nil(t, rep.Create(&volume.Volume{Name: "mounted"}, &models.VolumeOptions{Mode: models.ModeMount}))
+		assert.Error(t, serv.Refresh(context.Background(), "mounted"))
+	})
+}
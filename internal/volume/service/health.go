@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/tracing"
+)
+
+// Health checks the state files, the mount backends and the mounts of the
+// volumes. The result of a volume check is recorded in its status.
+func (s *service) Health(ctx context.Context) *models.HealthReport {
+	ctx, span := tracing.Start(ctx, "service.Health")
+	defer span.End()
+
+	report := &models.HealthReport{
+		Checks:  []models.HealthCheck{models.NewHealthCheck("state", s.stateManager.CheckState())},
+		Volumes: []models.HealthCheck{},
+	}
+
+	report.Checks = append(report.Checks, s.mountManager.CheckSystem()...)
+
+	volumes, err := s.rep.List()
+	if err != nil {
+		report.Checks = append(report.Checks, models.NewHealthCheck("volumes", err))
+	}
+
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+
+	for _, vol := range volumes {
+		if !s.rep.IsMount(vol.Name) {
+			continue
+		}
+
+		opt := s.rep.GetVolumeOptions(vol.Name)
+		if opt == nil {
+			continue
+		}
+
+		err := s.mountManager.CheckMount(ctx, vol)
+		s.setCheckResult(vol.Name, opt, err)
+
+		check := models.NewHealthCheck(vol.Name, err)
+		if err != nil {
+			check.Error = redact(err.Error(), opt)
+		}
+
+		report.Volumes = append(report.Volumes, check)
+	}
+
+	report.Status = models.HealthOK
+	if !report.Healthy() {
+		report.Status = models.HealthDegraded
+	}
+
+	return report
+}
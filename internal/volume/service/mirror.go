@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/statemngr"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/tracing"
+	pkgLogger "github.com/t1d333/docker-volume-ftp-driver/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// mirrorState is kept next to the local copy of a mirrored volume. The copy
+// outlives unmounts, so the next mount only downloads what changed.
+type mirrorState struct {
+	SyncedAt time.Time            `json:"synced_at"`
+	Error    string               `json:"error,omitempty"`
+	Snapshot models.StageSnapshot `json:"snapshot"`
+}
+
+func (s *service) mirrorDir(name string) string {
+	return filepath.Join(statemngr.StateDir(s.mountpoint), "mirror", name)
+}
+
+func (s *service) mirrorDataDir(name string) string {
+	return filepath.Join(s.mirrorDir(name), "data")
+}
+
+func (s *service) mirrorStateFile(name string) string {
+	return filepath.Join(s.mirrorDir(name), "state.json")
+}
+
+// loadMirror returns the mirror state of a volume, nil if it was never
+// synced.
+func (s *service) loadMirror(name string) (*mirrorState, error) {
+	state := &mirrorState{}
+	if ok, err := readStateFile(s.mirrorStateFile(name), state); !ok || err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// syncMirror updates the local copy of a mirrored volume. Syncs of the same
+// volume run one at a time.
+func (s *service) syncMirror(ctx context.Context, name string, opt *models.VolumeOptions) error {
+	lock, _ := s.mirrorLocks.LoadOrStore(name, new(sync.Mutex))
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	state, err := s.loadMirror(name)
+	if err != nil {
+		return fmt.Errorf("failed service.loadMirror in service.syncMirror: %w", err)
+	}
+
+	if state == nil {
+		state = &mirrorState{}
+	}
+
+	data := s.mirrorDataDir(name)
+	if err := os.MkdirAll(data, 0755); err != nil {
+		return fmt.Errorf("unable to create mirror dir in service.syncMirror: %w", err)
+	}
+
+	snapshot, err := s.ftpManager.Sync(ctx, opt.RemotePath, data, state.Snapshot, &opt.FTPConnectionOpt)
+	if snapshot != nil {
+		state.Snapshot = snapshot
+	}
+
+	state.Error = ""
+	if err != nil {
+		state.Error = redact(err.Error(), opt)
+	} else {
+		state.SyncedAt = time.Now()
+	}
+
+	if saveErr := writeStateFile(s.mirrorStateFile(name), state); saveErr != nil {
+		s.log(ctx).Errorf("failed to save mirror state of volume '%s': %s", name, saveErr.Error())
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed ftpManager.Sync in service.syncMirror: %w", err)
+	}
+
+	return nil
+}
+
+// mountMirror syncs the local copy of the volume and binds it read-only on
+// the mountpoint. A copy synced before is mounted even if the server can not
+// be reached.
+func (s *service) mountMirror(ctx context.Context, vol *volume.Volume, opt *models.VolumeOptions) (string, error) {
+	if err := s.syncMirror(ctx, vol.Name, opt); err != nil {
+		state, loadErr := s.loadMirror(vol.Name)
+		if loadErr != nil || state == nil || state.SyncedAt.IsZero() {
+			return "", fmt.Errorf("failed service.syncMirror in service.mountMirror: %w", err)
+		}
+
+		s.log(ctx).Warnf("mounting copy of volume '%s' synced at %s: %s", vol.Name, state.SyncedAt.Format(time.RFC3339), redact(err.Error(), opt))
+	}
+
+	path, err := s.mountManager.Bind(ctx, vol, s.mirrorDataDir(vol.Name), true)
+	if err != nil {
+		return "", fmt.Errorf("failed mountManager.Bind in service.mountMirror: %w", err)
+	}
+
+	if opt.Refresh > 0 {
+		s.startRefresh(vol.Name, opt)
+	}
+
+	return path, nil
+}
+
+// startRefresh syncs the mirrored volume every refresh interval until
+// stopRefresh is called.
+func (s *service) startRefresh(name string, opt *models.VolumeOptions) {
+	s.stopRefresh(name)
+
+	stop := make(chan struct{})
+	s.refreshers.Store(name, stop)
+
+	go func() {
+		ticker := time.NewTicker(opt.Refresh)
+		defer ticker.Stop()
+
+		ctx := pkgLogger.WithFields(context.Background(), "volume", name)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := s.syncMirror(ctx, name, opt); err != nil {
+					s.log(ctx).Warnf("failed to refresh mirror of volume '%s': %s", name, redact(err.Error(), opt))
+				}
+			}
+		}
+	}()
+}
+
+func (s *service) stopRefresh(name string) {
+	if stop, ok := s.refreshers.LoadAndDelete(name); ok {
+		close(stop.(chan struct{}))
+	}
+}
+
+// Refresh syncs the local copy of a mirrored volume on demand.
+func (s *service) Refresh(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Refresh", attribute.String("volume.name", name))
+	defer func() { tracing.End(span, err) }()
+
+	opt := s.rep.GetVolumeOptions(name)
+	if opt == nil {
+		return fmt.Errorf("volume with name '%s' not found", name)
+	}
+
+	if opt.Mode != models.ModeMirror {
+		return fmt.Errorf("volume with name '%s' is not a mirror", name)
+	}
+
+	return s.syncMirror(ctx, name, opt)
+}
+
+// mirrorStatus describes the local copy of a mirrored volume.
+func (s *service) mirrorStatus(name string, opt *models.VolumeOptions) map[string]interface{} {
+	res := map[string]interface{}{}
+	if opt.Refresh > 0 {
+		res["refresh"] = opt.Refresh.String()
+	}
+
+	state, err := s.loadMirror(name)
+	if err != nil {
+		res["error"] = err.Error()
+		return res
+	}
+
+	if state == nil {
+		return res
+	}
+
+	res["entries"] = len(state.Snapshot)
+	if !state.SyncedAt.IsZero() {
+		res["synced_at"] = state.SyncedAt.Format(time.RFC3339)
+	}
+
+	if state.Error != "" {
+		res["error"] = state.Error
+	}
+
+	return res
+}
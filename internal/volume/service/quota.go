@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	pkgLogger "github.com/t1d333/docker-volume-ftp-driver/pkg/logger"
+)
+
+// usageSaveInterval is how often the quota usage of a mounted volume is
+// written to the state. The usage is only written when it changed.
+var usageSaveInterval = 10 * time.Second
+
+// startUsageSaver saves the quota usage of a mounted volume every
+// usageSaveInterval until stopUsageSaver is called. The state is otherwise
+// only saved on create, remove and unmount.
+func (s *service) startUsageSaver(name string) {
+	s.stopUsageSaver(name)
+
+	stop := make(chan struct{})
+	s.usageSavers.Store(name, stop)
+
+	usage := s.rep.GetQuotaUsage(name)
+	saved := usage.Used()
+
+	go func() {
+		ticker := time.NewTicker(usageSaveInterval)
+		defer ticker.Stop()
+
+		ctx := pkgLogger.WithFields(context.Background(), "volume", name)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				used := usage.Used()
+				if used == saved {
+					continue
+				}
+
+				if err := s.stateManager.SaveUsage(); err != nil {
+					s.log(ctx).Warnf("failed to save quota usage of volume '%s': %s", name, err.Error())
+					continue
+				}
+				saved = used
+			}
+		}
+	}()
+}
+
+func (s *service) stopUsageSaver(name string) {
+	if stop, ok := s.usageSavers.LoadAndDelete(name); ok {
+		close(stop.(chan struct{}))
+	}
+}
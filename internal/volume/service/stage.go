@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/ftpmngr"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/statemngr"
+)
+
+// stageState is kept next to the local copy of a staged volume. It exists
+// from the download until the changes are uploaded, a volume whose upload
+// failed keeps its local copy for the next mount.
+type stageState struct {
+	State     string               `json:"state"`
+	Error     string               `json:"error,omitempty"`
+	Conflicts []string             `json:"conflicts,omitempty"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	Snapshot  models.StageSnapshot `json:"snapshot"`
+}
+
+func (s *service) stageDir(name string) string {
+	return filepath.Join(statemngr.StateDir(s.mountpoint), "stage", name)
+}
+
+func (s *service) stageDataDir(name string) string {
+	return filepath.Join(s.stageDir(name), "data")
+}
+
+func (s *service) stageStateFile(name string) string {
+	return filepath.Join(s.stageDir(name), "state.json")
+}
+
+// loadStage returns the stage state of a volume, nil if it has no local
+// copy.
+func (s *service) loadStage(name string) (*stageState, error) {
+	state := &stageState{}
+	if ok, err := readStateFile(s.stageStateFile(name), state); !ok || err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (s *service) saveStage(name string, state *stageState) error {
+	state.UpdatedAt = time.Now()
+	return writeStateFile(s.stageStateFile(name), state)
+}
+
+// readStateFile decodes the json file at path into v. It returns false if
+// the file does not exist.
+func readStateFile(path string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to read state file in service.readStateFile: %w", err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("unable to decode state file in service.readStateFile: %w", err)
+	}
+
+	return true, nil
+}
+
+// writeStateFile replaces the json file at path with v.
+func writeStateFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("unable to encode state file in service.writeStateFile: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("unable to write state file in service.writeStateFile: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("unable to write state file in service.writeStateFile: %w", err)
+	}
+
+	return nil
+}
+
+// mountStaged downloads the remote directory of the volume into its local
+// copy and binds the copy on the mountpoint. A local copy left by a failed
+// upload is mounted again instead, so its changes are not lost.
+func (s *service) mountStaged(ctx context.Context, vol *volume.Volume, opt *models.VolumeOptions) (string, error) {
+	state, err := s.loadStage(vol.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed service.loadStage in service.mountStaged: %w", err)
+	}
+
+	data := s.stageDataDir(vol.Name)
+
+	if state != nil {
+		s.log(ctx).Warnf("mounting local copy of volume '%s' kept after state '%s'", vol.Name, state.State)
+	} else {
+		if err := os.RemoveAll(s.stageDir(vol.Name)); err != nil {
+			return "", fmt.Errorf("unable to clean stage dir in service.mountStaged: %w", err)
+		}
+
+		if err := os.MkdirAll(data, 0755); err != nil {
+			return "", fmt.Errorf("unable to create stage dir in service.mountStaged: %w", err)
+		}
+
+		snapshot, err := s.ftpManager.Download(ctx, opt.RemotePath, data, &opt.FTPConnectionOpt)
+		if err != nil {
+			_ = os.RemoveAll(s.stageDir(vol.Name))
+			return "", fmt.Errorf("failed ftpManager.Download in service.mountStaged: %w", err)
+		}
+
+		state = &stageState{Snapshot: snapshot}
+	}
+
+	state.State = models.StageStaged
+	if err := s.saveStage(vol.Name, state); err != nil {
+		return "", fmt.Errorf("failed service.saveStage in service.mountStaged: %w", err)
+	}
+
+	path, err := s.mountManager.Bind(ctx, vol, data, false)
+	if err != nil {
+		return "", fmt.Errorf("failed mountManager.Bind in service.mountStaged: %w", err)
+	}
+
+	return path, nil
+}
+
+// unstage uploads the changes of the local copy of the volume and removes
+// the copy. A failed upload is recorded in the stage state and keeps the
+// copy.
+func (s *service) unstage(ctx context.Context, name string, opt *models.VolumeOptions) error {
+	state, err := s.loadStage(name)
+	if err != nil {
+		return fmt.Errorf("failed service.loadStage in service.unstage: %w", err)
+	}
+
+	if state == nil {
+		return fmt.Errorf("volume '%s' has no local copy", name)
+	}
+
+	partial := ""
+	if opt.AtomicUpload {
+		partial = opt.PartialPattern
+	}
+
+	err = s.ftpManager.Upload(ctx, s.stageDataDir(name), opt.RemotePath, state.Snapshot, partial, &opt.FTPConnectionOpt)
+	if err == nil {
+		if err := os.RemoveAll(s.stageDir(name)); err != nil {
+			s.log(ctx).Errorf("failed to remove local copy of volume '%s': %s", name, err.Error())
+		}
+
+		return nil
+	}
+
+	state.State = models.StageFailed
+	state.Error = redact(err.Error(), opt)
+	state.Conflicts = nil
+
+	var conflict *ftpmngr.ConflictError
+	if errors.As(err, &conflict) {
+		state.State = models.StageConflict
+		state.Conflicts = conflict.Paths
+	}
+
+	if saveErr := s.saveStage(name, state); saveErr != nil {
+		s.log(ctx).Errorf("failed to save stage state of volume '%s': %s", name, saveErr.Error())
+	}
+
+	return fmt.Errorf("failed ftpManager.Upload in service.unstage: %w", err)
+}
+
+// stageStatus describes the local copy of a staged volume.
+func (s *service) stageStatus(name string) map[string]interface{} {
+	state, err := s.loadStage(name)
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+
+	if state == nil {
+		return nil
+	}
+
+	res := map[string]interface{}{
+		"state":      state.State,
+		"updated_at": state.UpdatedAt.Format(time.RFC3339),
+	}
+
+	if state.Error != "" {
+		res["error"] = state.Error
+	}
+
+	if len(state.Conflicts) != 0 {
+		res["conflicts"] = state.Conflicts
+	}
+
+	return res
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/t1d333/docker-volume-ftp-driver/internal/metrics"
+	"github.com/t1d333/docker-volume-ftp-driver/internal/models"
+)
+
+// tlsMode is reported in the volume status, the driver only speaks plain ftp.
+const tlsMode = "none"
+
+const redacted = "********"
+
+// usageRefreshInterval is the age after which the usage of a volume is
+// refreshed, a failed refresh is tried again on the next status.
+const usageRefreshInterval = time.Minute
+
+// usageRefreshTimeout bounds a background refresh of the usage of a volume,
+// the size walk included.
+const usageRefreshTimeout = time.Minute
+
+// volumeUsage is the last usage of a volume on the ftp server. It is
+// refreshed in the background, the status never waits for the server.
+type volumeUsage struct {
+	mu          sync.Mutex
+	usage       *models.VolumeUsage
+	err         string
+	refreshedAt time.Time
+	refreshing  bool
+}
+
+// volumeHealth holds the runtime results of the last mount attempt and the
+// last connection check of a volume. It is not persisted.
+type volumeHealth struct {
+	mu             sync.Mutex
+	lastMountError string
+	lastCheck      time.Time
+	lastCheckError string
+}
+
+func (s *service) getHealth(name string) *volumeHealth {
+	health, _ := s.health.LoadOrStore(name, &volumeHealth{})
+	return health.(*volumeHealth)
+}
+
+func (s *service) setMountResult(name string, opt *models.VolumeOptions, err error) {
+	health := s.getHealth(name)
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	health.lastMountError = ""
+	if err != nil {
+		health.lastMountError = redact(err.Error(), opt)
+	}
+}
+
+func (s *service) setCheckResult(name string, opt *models.VolumeOptions, err error) {
+	metrics.ObserveHealthCheck(err)
+
+	health := s.getHealth(name)
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	health.lastCheck = time.Now()
+	health.lastCheckError = ""
+	if err != nil {
+		health.lastCheckError = redact(err.Error(), opt)
+	}
+}
+
+// status describes the connection, mount state and health of a volume for
+// docker volume inspect. Secrets are never included.
+func (s *service) status(ctx context.Context, name string, opt *models.VolumeOptions) map[string]interface{} {
+	ids := s.rep.GetMountedIdsList(name)
+
+	res := map[string]interface{}{
+		"host":       opt.Host,
+		"port":       opt.Port,
+		"user":       opt.User,
+		"remotepath": opt.RemotePath,
+		"tls":        tlsMode,
+		"backend":    opt.Backend,
+		"mounted":    len(ids) != 0,
+		"mounted_by": ids,
+	}
+
+	switch opt.Mode {
+	case models.ModeStage:
+		res["mode"] = opt.Mode
+		if stage := s.stageStatus(name); stage != nil {
+			res["stage"] = stage
+		}
+	case models.ModeMirror:
+		res["mode"] = opt.Mode
+		res["mirror"] = s.mirrorStatus(name, opt)
+	}
+
+	if opt.AtomicUpload {
+		res["atomic_upload"] = true
+		res["partial_pattern"] = opt.PartialPattern
+	}
+
+	if opt.Checksum {
+		res["checksum"] = true
+	}
+
+	if opt.Encoding != "" {
+		res["encoding"] = opt.Encoding
+	}
+
+	if opt.ServerTZ != "" {
+		res["server_tz"] = opt.ServerTZ
+	}
+
+	if opt.Quota > 0 {
+		res["quota"] = opt.Quota
+		res["quota_used"] = s.rep.GetQuotaUsage(name).Used()
+	}
+
+	if shared := s.overlappingVolumes(ctx, name, opt); len(shared) != 0 {
+		res["shared_with"] = shared
+	}
+
+	if s.limiter.Enabled() {
+		stats := s.limiter.Stats(&opt.FTPConnectionOpt)
+		res["host_sessions"] = stats.Active
+		res["host_queue"] = stats.Queued
+	}
+
+	// the cache is shared by the native mounts of all volumes
+	if s.cache.Enabled() && opt.Backend == models.BackendNative && opt.Mode != models.ModeStage && opt.Mode != models.ModeMirror {
+		stats := s.cache.Stats()
+		res["cache"] = map[string]interface{}{
+			"entries":   stats.Entries,
+			"size":      stats.Size,
+			"max_size":  stats.MaxSize,
+			"hits":      stats.Hits,
+			"misses":    stats.Misses,
+			"evictions": stats.Evictions,
+		}
+	}
+
+	if opt.Capabilities.Known() {
+		res["capabilities"] = map[string]interface{}{
+			"features":   opt.Capabilities.Supported(),
+			"checked_at": opt.Capabilities.CheckedAt.Format(time.RFC3339),
+		}
+	}
+
+	usage, usageErr := s.cachedUsage(name, opt)
+	if usage != nil {
+		res["usage"] = usageStatus(usage)
+	}
+	if usageErr != "" {
+		res["usage_error"] = usageErr
+	}
+
+	health := s.getHealth(name)
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	if health.lastMountError != "" {
+		res["last_mount_error"] = health.lastMountError
+	}
+
+	if !health.lastCheck.IsZero() {
+		res["last_health_check"] = health.lastCheck.Format(time.RFC3339)
+		if health.lastCheckError != "" {
+			res["last_health_check_error"] = health.lastCheckError
+		}
+	}
+
+	return res
+}
+
+// cachedUsage returns the last usage of the volume and the error of the last
+// refresh, and starts a refresh when the usage is stale.
+func (s *service) cachedUsage(name string, opt *models.VolumeOptions) (*models.VolumeUsage, string) {
+	value, _ := s.usage.LoadOrStore(name, &volumeUsage{})
+	entry := value.(*volumeUsage)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	stale := entry.err != "" || time.Since(entry.refreshedAt) >= usageRefreshInterval
+	if stale && !entry.refreshing {
+		entry.refreshing = true
+		go s.refreshUsage(entry, opt)
+	}
+
+	return entry.usage, entry.err
+}
+
+// refreshUsage asks the server for the usage of the volume. A failure keeps
+// the last usage.
+func (s *service) refreshUsage(entry *volumeUsage, opt *models.VolumeOptions) {
+	ctx, cancel := context.WithTimeout(context.Background(), usageRefreshTimeout)
+	defer cancel()
+
+	usage, err := s.ftpManager.Usage(ctx, opt.RemotePath, &opt.FTPConnectionOpt)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	entry.refreshing = false
+	entry.refreshedAt = time.Now()
+	entry.err = ""
+	if err != nil {
+		entry.err = redact(err.Error(), opt)
+		s.logger.Warnf("unable to refresh remote usage: %s", entry.err)
+		return
+	}
+
+	entry.usage = usage
+}
+
+func usageStatus(usage *models.VolumeUsage) map[string]interface{} {
+	res := map[string]interface{}{
+		"sources":    usage.Sources,
+		"truncated":  usage.Truncated,
+		"checked_at": usage.CheckedAt.Format(time.RFC3339),
+	}
+
+	if usage.Used >= 0 {
+		res["used"] = usage.Used
+	}
+
+	if usage.Available >= 0 {
+		res["available"] = usage.Available
+	}
+
+	if usage.AccountUsed >= 0 {
+		res["account_used"] = usage.AccountUsed
+	}
+
+	if usage.Quota >= 0 {
+		res["quota"] = usage.Quota
+	}
+
+	return res
+}
+
+// redact removes the password of the volume from a message.
+func redact(msg string, opt *models.VolumeOptions) string {
+	if opt == nil || opt.Password == "" {
+		return msg
+	}
+
+	return strings.ReplaceAll(msg, opt.Password, redacted)
+}
@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// CorrelationIDKey is the log field holding the correlation id of a request.
+const CorrelationIDKey = "correlation_id"
+
+type fieldsKey struct{}
+
+// WithFields returns a context carrying the key value pairs, loggers returned
+// by FromContext add them to every line.
+func WithFields(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	fields := append(append([]interface{}{}, Fields(ctx)...), keysAndValues...)
+
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// WithCorrelationID returns a context carrying the correlation id of a
+// request.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return WithFields(ctx, CorrelationIDKey, id)
+}
+
+// Fields returns the key value pairs carried by ctx.
+func Fields(ctx context.Context) []interface{} {
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	return fields
+}
+
+// CorrelationID returns the correlation id carried by ctx or an empty string.
+func CorrelationID(ctx context.Context) string {
+	fields := Fields(ctx)
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == CorrelationIDKey {
+			id, _ := fields[i+1].(string)
+			return id
+		}
+	}
+
+	return ""
+}
+
+// FromContext returns logger with the fields carried by ctx. Loggers which
+// can not add fields are returned unchanged.
+func FromContext(ctx context.Context, logger Logger) Logger {
+	fields := Fields(ctx)
+	if len(fields) == 0 {
+		return logger
+	}
+
+	switch l := logger.(type) {
+	case *zap.SugaredLogger:
+		return l.With(fields...)
+	case interface {
+		With(args ...interface{}) Logger
+	}:
+		return l.With(fields...)
+	default:
+		return logger
+	}
+}
@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestFromContext(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "driver.log")
+
+	logger, _, err := NewLogger(&Config{Level: zapcore.InfoLevel, Format: FormatJSON, File: file})
+	require.Nil(t, err)
+
+	ctx := WithCorrelationID(context.Background(), "abc")
+	ctx = WithFields(ctx, "mount_id", "123")
+
+	assert.Equal(t, "abc", CorrelationID(ctx))
+	assert.Equal(t, "", CorrelationID(context.Background()))
+
+	FromContext(ctx, logger).Infof("mounting volume '%s'", "test")
+	FromContext(context.Background(), logger).Info("without request")
+
+	data, err := os.ReadFile(file)
+	require.Nil(t, err)
+	assert.Contains(t, string(data), `"msg":"mounting volume 'test'","correlation_id":"abc","mount_id":"123"`)
+	assert.NotContains(t, string(data), `"msg":"without request","correlation_id"`)
+}
@@ -1,41 +1,141 @@
 package logger
 
 import (
-	"log"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 type Logger interface {
+	Debug(args ...interface{})
 	Info(args ...interface{})
 	Warn(args ...interface{})
 	Error(args ...interface{})
 	Fatal(args ...interface{})
 
+	Debugw(msg string, args ...interface{})
 	Infow(msg string, args ...interface{})
 	Warnw(msg string, args ...interface{})
 	Errorw(msg string, args ...interface{})
 	Fatalw(msg string, args ...interface{})
 
+	Debugf(s string, args ...interface{})
 	Infof(s string, args ...interface{})
 	Warnf(s string, args ...interface{})
 	Errorf(s string, args ...interface{})
 	Fatalf(s string, args ...interface{})
 }
 
-func NewLogger() Logger {
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// Environment variables read by ConfigFromEnv.
+const (
+	EnvDebug  = "DEBUG"
+	EnvLevel  = "LOG_LEVEL"
+	EnvFormat = "LOG_FORMAT"
+	EnvFile   = "LOG_FILE"
+)
+
+type Config struct {
+	Level  zapcore.Level
+	Format string
+	// File receives the log in addition to stderr if set.
+	File string
+}
+
+// ConfigFromEnv reads the logger configuration with getenv. LOG_LEVEL takes
+// precedence over DEBUG, which enables the debug level when set to a true
+// value.
+func ConfigFromEnv(getenv func(string) string) (*Config, error) {
+	conf := &Config{Level: zapcore.InfoLevel, Format: FormatJSON, File: getenv(EnvFile)}
+
+	if value := getenv(EnvDebug); value != "" {
+		debug, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value '%s' in logger.ConfigFromEnv: %w", EnvDebug, value, err)
+		}
+
+		if debug {
+			conf.Level = zapcore.DebugLevel
+		}
+	}
+
+	if value := getenv(EnvLevel); value != "" {
+		if err := conf.Level.UnmarshalText([]byte(strings.ToLower(value))); err != nil {
+			return nil, fmt.Errorf("invalid %s value '%s' in logger.ConfigFromEnv: %w", EnvLevel, value, err)
+		}
+	}
+
+	if value := getenv(EnvFormat); value != "" {
+		switch value = strings.ToLower(value); value {
+		case FormatJSON, FormatConsole:
+			conf.Format = value
+		default:
+			return nil, fmt.Errorf("invalid %s value '%s' in logger.ConfigFromEnv", EnvFormat, value)
+		}
+	}
+
+	return conf, nil
+}
+
+// NewLogger builds a logger from conf. The returned level changes the level
+// of the logger at runtime, it is also an http handler.
+func NewLogger(conf *Config) (Logger, zap.AtomicLevel, error) {
+	level := zap.NewAtomicLevelAt(conf.Level)
+
 	config := zap.NewProductionConfig()
+	config.Level = level
+	config.Encoding = conf.Format
 	config.EncoderConfig.TimeKey = "timestamp"
 	config.EncoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout("Jan 02 15:04:05.000000000")
 	config.EncoderConfig.StacktraceKey = ""
 
+	if conf.Level == zapcore.DebugLevel {
+		config.Sampling = nil
+	}
+
+	if conf.File != "" {
+		config.OutputPaths = append(config.OutputPaths, conf.File)
+		config.ErrorOutputPaths = append(config.ErrorOutputPaths, conf.File)
+	}
+
 	logger, err := config.Build()
 	if err != nil {
-		log.Fatal(err)
+		return nil, level, fmt.Errorf("unable to build logger in logger.NewLogger: %w", err)
+	}
+
+	return logger.Sugar(), level, nil
+}
+
+// ToggleDebugOnSignal switches level between debug and the level it had at
+// the time of the call, or info if that was debug, each time one of the
+// signals is received.
+func ToggleDebugOnSignal(level zap.AtomicLevel, logger Logger, signals ...os.Signal) {
+	initial := level.Level()
+	if initial == zapcore.DebugLevel {
+		initial = zapcore.InfoLevel
 	}
 
-	log := logger.Sugar()
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+
+	go func() {
+		for range ch {
+			next := zapcore.DebugLevel
+			if level.Level() == zapcore.DebugLevel {
+				next = initial
+			}
 
-	return log
+			level.SetLevel(next)
+			logger.Infof("log level changed to %s", next.String())
+		}
+	}()
 }
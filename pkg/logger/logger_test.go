@@ -0,0 +1,96 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := map[string]struct {
+		env      map[string]string
+		expected *Config
+		isErr    bool
+	}{
+		"defaults": {
+			env:      map[string]string{},
+			expected: &Config{Level: zapcore.InfoLevel, Format: FormatJSON},
+		},
+		"debug disabled": {
+			env:      map[string]string{EnvDebug: "0"},
+			expected: &Config{Level: zapcore.InfoLevel, Format: FormatJSON},
+		},
+		"debug enabled": {
+			env:      map[string]string{EnvDebug: "1"},
+			expected: &Config{Level: zapcore.DebugLevel, Format: FormatJSON},
+		},
+		"level overrides debug": {
+			env:      map[string]string{EnvDebug: "true", EnvLevel: "WARN"},
+			expected: &Config{Level: zapcore.WarnLevel, Format: FormatJSON},
+		},
+		"console format and file": {
+			env:      map[string]string{EnvFormat: "Console", EnvFile: "/var/log/ftp-driver.log"},
+			expected: &Config{Level: zapcore.InfoLevel, Format: FormatConsole, File: "/var/log/ftp-driver.log"},
+		},
+		"invalid debug": {
+			env:   map[string]string{EnvDebug: "yes please"},
+			isErr: true,
+		},
+		"invalid level": {
+			env:   map[string]string{EnvLevel: "verbose"},
+			isErr: true,
+		},
+		"invalid format": {
+			env:   map[string]string{EnvFormat: "xml"},
+			isErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf, err := ConfigFromEnv(func(key string) string { return test.env[key] })
+			if test.isErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.Nil(t, err)
+			assert.Equal(t, test.expected, conf)
+		})
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "driver.log")
+
+	logger, level, err := NewLogger(&Config{Level: zapcore.InfoLevel, Format: FormatJSON, File: file})
+	require.Nil(t, err)
+
+	logger.Debug("hidden message")
+	level.SetLevel(zapcore.DebugLevel)
+	logger.Debug("visible message")
+
+	data, err := os.ReadFile(file)
+	require.Nil(t, err)
+	assert.NotContains(t, string(data), "hidden message")
+	assert.Contains(t, string(data), `"msg":"visible message"`)
+}
+
+func TestToggleDebugOnSignal(t *testing.T) {
+	logger, level, err := NewLogger(&Config{Level: zapcore.WarnLevel, Format: FormatConsole, File: filepath.Join(t.TempDir(), "driver.log")})
+	require.Nil(t, err)
+
+	ToggleDebugOnSignal(level, logger, syscall.SIGUSR2)
+
+	require.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+	assert.Eventually(t, func() bool { return level.Level() == zapcore.DebugLevel }, time.Second, 10*time.Millisecond)
+
+	require.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+	assert.Eventually(t, func() bool { return level.Level() == zapcore.WarnLevel }, time.Second, 10*time.Millisecond)
+}